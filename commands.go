@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+const commandUsage = `usage: go-serve-intro [command]
+
+with no command the server is started. commands:
+  promote-admin <email>   give an existing user the admin role`
+
+// runCommand runs an administrative subcommand
+func runCommand(ctx context.Context, store database.Store, args []string) error {
+	switch args[0] {
+	case "promote-admin":
+		if len(args) != 2 {
+			return errors.New(commandUsage)
+		}
+		return promoteAdmin(ctx, store, args[1])
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], commandUsage)
+	}
+}
+
+// promoteAdmin makes a user an admin. it is how the first admin is created;
+// after that admins can change roles through the api.
+func promoteAdmin(ctx context.Context, store database.Store, email string) error {
+	users, err := store.GetUsersByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("no user with email %s; sign up first", email)
+	}
+	user, err := store.UpdateUserRole(ctx, database.UpdateUserRoleParams{
+		ID:        users[0].ID,
+		Role:      auth.RoleAdmin,
+		UpdatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s (%s) is now an admin\n", user.Email, user.ID)
+	return nil
+}
@@ -1,21 +1,52 @@
 package api
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
+	"github.com/landanqrew/go-serve-intro/internal/auth"
 	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/events"
+	"github.com/landanqrew/go-serve-intro/internal/lockout"
+	"github.com/landanqrew/go-serve-intro/internal/mail"
+	"github.com/landanqrew/go-serve-intro/internal/oidc"
 )
 
 type APIConfig struct {
-	fileserverHits atomic.Int32
-	dbQueries      *database.Queries
-	tokenSecret    string
-	polkaKey       string
+	fileserverHits  atomic.Int32
+	dbQueries       database.Store
+	tokenKeys       *auth.Keyring
+	polkaKey        string
+	events          *events.Broker
+	streamHeartbeat time.Duration
+	wsPingInterval  time.Duration
+	mailer          mail.Mailer
+	// baseURL is where users reach the app, used for links in emails
+	baseURL         string
+	// requireVerifiedEmail stops users posting chirps until they have
+	// confirmed their email address
+	requireVerifiedEmail bool
+	// accountLimiter and ipLimiter slow down password guessing against one
+	// account and from one client
+	accountLimiter *lockout.Limiter
+	ipLimiter      *lockout.Limiter
+	// magicLinkLimiter caps the login links sent to one address
+	magicLinkLimiter *lockout.Limiter
+	// passwordParams are the argon2id costs for new hashes; older hashes are
+	// upgraded when their owner logs in
+	passwordParams auth.PasswordParams
+	passwordPolicy *auth.PasswordPolicy
+	tokenLifetimes tokenLifetimes
+	// oidcProviders are the OpenID Connect providers users can log in with,
+	// by the name used in their /api/auth/{provider} urls
+	oidcProviders map[string]*oidc.Provider
 }
 
 func deriveResponseJson[T any](w http.ResponseWriter, r *http.Request) (T, error) {
@@ -59,11 +90,167 @@ func deriveResponseJson[T any](w http.ResponseWriter, r *http.Request) (T, error
 
 
 
-func GetAPIConfig(db *sql.DB) *APIConfig {
+// GetAPIConfig builds the config around any Store: database.New(db) for
+// postgres or database.NewMemoryStore() for tests and local experiments
+func GetAPIConfig(store database.Store) (*APIConfig, error) {
+	tokenKeys, err := loadTokenKeys()
+	if err != nil {
+		return nil, err
+	}
+	mailer, err := loadMailer()
+	if err != nil {
+		return nil, err
+	}
+	accountLimiter, ipLimiter, err := loadLoginLimiters(store)
+	if err != nil {
+		return nil, err
+	}
+	magicLinkLimiter, err := loadMagicLinkLimiter(store)
+	if err != nil {
+		return nil, err
+	}
+	passwordParams, err := loadPasswordParams()
+	if err != nil {
+		return nil, err
+	}
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		return nil, err
+	}
+	tokenLifetimes, err := loadTokenLifetimes()
+	if err != nil {
+		return nil, err
+	}
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	oidcProviders, err := loadOIDCProviders(baseURL)
+	if err != nil {
+		return nil, err
+	}
 	return &APIConfig{
 		fileserverHits: atomic.Int32{},
-		dbQueries:      database.New(db),
-		tokenSecret:    os.Getenv("TOKEN_SECRET"),
+		dbQueries:      store,
+		tokenKeys:      tokenKeys,
 		polkaKey:       os.Getenv("POLKA_KEY"),
+		events:         events.NewBroker(events.DefaultBufferSize, events.DefaultHistorySize),
+		// keeps idle streams from being closed by proxies
+		streamHeartbeat: 15 * time.Second,
+		wsPingInterval:  30 * time.Second,
+		mailer:          mailer,
+		baseURL:         baseURL,
+		requireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+		accountLimiter:  accountLimiter,
+		ipLimiter:       ipLimiter,
+		magicLinkLimiter: magicLinkLimiter,
+		passwordParams:  passwordParams,
+		passwordPolicy:  passwordPolicy,
+		tokenLifetimes:  tokenLifetimes,
+		oidcProviders:   oidcProviders,
+	}, nil
+}
+
+// loadTokenKeys reads the keyring named by JWT_KEYRING_FILE, falling back to
+// signing with TOKEN_SECRET when there isn't one
+func loadTokenKeys() (*auth.Keyring, error) {
+	if path := os.Getenv("JWT_KEYRING_FILE"); path != "" {
+		return auth.LoadKeyring(path)
+	}
+	secret := os.Getenv("TOKEN_SECRET")
+	if secret == "" {
+		return nil, errors.New("either JWT_KEYRING_FILE or TOKEN_SECRET must be set")
+	}
+	return auth.NewKeyring(auth.NewHMACKey("token-secret", []byte(secret)))
+}
+
+// loadMailer sends through the SMTP server at MAIL_SMTP_ADDR when it is set,
+// otherwise it writes messages to MAIL_OUTBOX_DIR for local development
+func loadMailer() (mail.Mailer, error) {
+	if addr := os.Getenv("MAIL_SMTP_ADDR"); addr != "" {
+		from := os.Getenv("MAIL_FROM")
+		if from == "" {
+			return nil, errors.New("MAIL_FROM must be set when MAIL_SMTP_ADDR is")
+		}
+		return mail.NewSMTPMailer(addr, from, os.Getenv("MAIL_SMTP_USERNAME"), os.Getenv("MAIL_SMTP_PASSWORD")), nil
+	}
+	dir := os.Getenv("MAIL_OUTBOX_DIR")
+	if dir == "" {
+		dir = "./outbox"
+	}
+	return mail.NewOutboxMailer(dir)
+}
+
+// loadPasswordParams reads the argon2id costs, starting from the package
+// defaults. PASSWORD_ARGON2_MEMORY is in KiB.
+func loadPasswordParams() (auth.PasswordParams, error) {
+	params := auth.DefaultPasswordParams()
+	memory, iterations, parallelism := int(params.Memory), int(params.Iterations), int(params.Parallelism)
+	if err := envInt("PASSWORD_ARGON2_MEMORY", &memory); err != nil {
+		return params, err
+	}
+	if err := envInt("PASSWORD_ARGON2_ITERATIONS", &iterations); err != nil {
+		return params, err
+	}
+	if err := envInt("PASSWORD_ARGON2_PARALLELISM", &parallelism); err != nil {
+		return params, err
+	}
+	if parallelism > 255 {
+		return params, fmt.Errorf("invalid PASSWORD_ARGON2_PARALLELISM %d, must be at most 255", parallelism)
+	}
+	// argon2 needs at least 8 KiB of memory per lane
+	if memory < 8*parallelism {
+		return params, fmt.Errorf("invalid PASSWORD_ARGON2_MEMORY %d, must be at least 8 KiB per lane", memory)
+	}
+	params.Memory, params.Iterations, params.Parallelism = uint32(memory), uint32(iterations), uint8(parallelism)
+	return params, nil
+}
+
+// loadPasswordPolicy requires PASSWORD_MIN_LENGTH characters, 8 by default,
+// and refuses the passwords listed in PASSWORD_BLOCKLIST_FILE when it is set
+func loadPasswordPolicy() (*auth.PasswordPolicy, error) {
+	minLength := 8
+	if err := envInt("PASSWORD_MIN_LENGTH", &minLength); err != nil {
+		return nil, err
+	}
+	var blocklist []string
+	if path := os.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		var err error
+		blocklist, err = auth.LoadPasswordBlocklist(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return auth.NewPasswordPolicy(minLength, blocklist), nil
+}
+
+// envInt reads a positive integer from the environment into dst, leaving dst
+// alone when the variable isn't set
+func envInt(name string, dst *int) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid %s %q", name, value)
+	}
+	*dst = n
+	return nil
+}
+
+// envDuration reads a positive Go duration such as "15m" from the
+// environment into dst, leaving dst alone when the variable isn't set
+func envDuration(name string, dst *time.Duration) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fmt.Errorf("invalid %s %q", name, value)
 	}
+	*dst = duration
+	return nil
 }
\ No newline at end of file
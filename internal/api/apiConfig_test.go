@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+const (
+	testTokenSecret = "test-secret"
+	testPolkaKey    = "test-polka-key"
+)
+
+// newTestAPIConfig returns a config backed by an empty in-memory store
+func newTestAPIConfig(t *testing.T) *APIConfig {
+	t.Helper()
+	t.Setenv("TOKEN_SECRET", testTokenSecret)
+	t.Setenv("POLKA_KEY", testPolkaKey)
+	t.Setenv("MAIL_SMTP_ADDR", "")
+	t.Setenv("MAIL_OUTBOX_DIR", t.TempDir())
+	cfg, err := GetAPIConfig(database.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("Error building config: %v", err)
+	}
+	return cfg
+}
+
+func newJSONRequest(t *testing.T, method, target string, body any) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("Error encoding request body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func withBearer(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func serve(handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func decodeResponse[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("Error decoding response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("Expected status %d, got %d: %s", want, rec.Code, rec.Body.String())
+	}
+}
+
+// createTestUser signs up and logs in a user, returning the login response
+func createTestUser(t *testing.T, cfg *APIConfig, email, password string) userResponse {
+	t.Helper()
+	rec := serve(cfg.HandleCreateUser, newJSONRequest(t, "POST", "/api/users", map[string]string{
+		"email":    email,
+		"password": password,
+	}))
+	expectStatus(t, rec, http.StatusCreated)
+	return loginTestUser(t, cfg, email, password)
+}
+
+func loginTestUser(t *testing.T, cfg *APIConfig, email, password string) userResponse {
+	t.Helper()
+	rec := serve(cfg.HandleAuthenticateUser, newJSONRequest(t, "POST", "/api/login", map[string]string{
+		"email":    email,
+		"password": password,
+	}))
+	expectStatus(t, rec, http.StatusOK)
+	return decodeResponse[userResponse](t, rec)
+}
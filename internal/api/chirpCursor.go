@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultChirpPageSize = 20
+	maxChirpPageSize     = 100
+)
+
+var (
+	// bounds used in place of a cursor when the client asks for the first page
+	chirpCursorMinTime = time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	chirpCursorMaxTime = time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC)
+)
+
+// chirpCursor is a position in the (created_at, id) ordering of chirps.
+// it is handed to clients as an opaque string and must not be relied on
+// to have any particular shape.
+type chirpCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+type ChirpPage struct {
+	Chirps     []CompleteChirp `json:"chirps"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// newChirpPage builds a response from rows fetched with a page size of
+// limit+1; the extra row only signals that another page exists
+func newChirpPage(chirps []listedChirp, limit int) ChirpPage {
+	page := ChirpPage{Chirps: []CompleteChirp{}}
+	if len(chirps) > limit {
+		chirps = chirps[:limit]
+		page.NextCursor = encodeChirpCursor(chirps[len(chirps)-1].cursor())
+	}
+	for _, listed := range chirps {
+		chirp := newCompleteChirp(listed.chirp)
+		if listed.rechirpedAt.Valid {
+			chirp.RechirpedBy = listed.rechirpedBy
+			chirp.RechirpedAt = &listed.rechirpedAt.Time
+		}
+		page.Chirps = append(page.Chirps, chirp)
+	}
+	return page
+}
+
+func encodeChirpCursor(c chirpCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeChirpCursor(s string) (chirpCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return chirpCursor{}, errors.New("invalid cursor")
+	}
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found || id == "" {
+		return chirpCursor{}, errors.New("invalid cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return chirpCursor{}, errors.New("invalid cursor")
+	}
+	return chirpCursor{CreatedAt: t, ID: id}, nil
+}
+
+// startChirpCursor returns the cursor that sits before the first row for
+// the given sort order, so the first page can use the same query as the rest.
+func startChirpCursor(sortOrder string) chirpCursor {
+	if sortOrder == "desc" {
+		return chirpCursor{CreatedAt: chirpCursorMaxTime}
+	}
+	return chirpCursor{CreatedAt: chirpCursorMinTime}
+}
+
+// parseChirpPageParams reads the limit and after query params
+func parseChirpPageParams(query url.Values, sortOrder string) (int, chirpCursor, error) {
+	limit := defaultChirpPageSize
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed < 1 {
+			return 0, chirpCursor{}, fmt.Errorf("limit must be a positive integer")
+		}
+		limit = min(parsed, maxChirpPageSize)
+	}
+
+	cursor := startChirpCursor(sortOrder)
+	if after := query.Get("after"); after != "" {
+		decoded, err := decodeChirpCursor(after)
+		if err != nil {
+			return 0, chirpCursor{}, err
+		}
+		cursor = decoded
+	}
+	return limit, cursor, nil
+}
+
+// search results are ranked rather than ordered by (created_at, id), so their
+// cursors carry an offset instead of a row position
+func encodeSearchCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset|" + strconv.Itoa(offset)))
+}
+
+func decodeSearchCursor(s string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	prefix, rawOffset, found := strings.Cut(string(raw), "|")
+	if !found || prefix != "offset" {
+		return 0, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(rawOffset)
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
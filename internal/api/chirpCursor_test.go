@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestChirpCursorRoundTrip(t *testing.T) {
+	want := chirpCursor{
+		CreatedAt: time.Date(2024, time.March, 5, 10, 30, 0, 123456000, time.UTC),
+		ID:        "3f1c2a4e-0000-4000-8000-000000000001",
+	}
+	encoded := encodeChirpCursor(want)
+	got, err := decodeChirpCursor(encoded)
+	if err != nil {
+		t.Fatalf("Error decoding cursor: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+		t.Fatalf("Expected cursor %+v, got %+v", want, got)
+	}
+}
+
+func TestDecodeInvalidChirpCursor(t *testing.T) {
+	for _, raw := range []string{"", "not base64!", encodeChirpCursorRaw("no-separator"), encodeChirpCursorRaw("yesterday|id")} {
+		if _, err := decodeChirpCursor(raw); err == nil {
+			t.Errorf("Expected error decoding cursor %q, got nil", raw)
+		}
+	}
+}
+
+func TestParseChirpPageParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		sortOrder string
+		wantLimit int
+		wantTime  time.Time
+		wantErr   bool
+	}{
+		{name: "defaults asc", query: "", sortOrder: "asc", wantLimit: defaultChirpPageSize, wantTime: chirpCursorMinTime},
+		{name: "defaults desc", query: "", sortOrder: "desc", wantLimit: defaultChirpPageSize, wantTime: chirpCursorMaxTime},
+		{name: "limit is capped", query: "limit=5000", sortOrder: "asc", wantLimit: maxChirpPageSize, wantTime: chirpCursorMinTime},
+		{name: "zero limit", query: "limit=0", sortOrder: "asc", wantErr: true},
+		{name: "non numeric limit", query: "limit=ten", sortOrder: "asc", wantErr: true},
+		{name: "bad cursor", query: "after=not-a-cursor", sortOrder: "asc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			limit, cursor, err := parseChirpPageParams(query, tt.sortOrder)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if limit != tt.wantLimit {
+				t.Errorf("Expected limit %d, got %d", tt.wantLimit, limit)
+			}
+			if !cursor.CreatedAt.Equal(tt.wantTime) {
+				t.Errorf("Expected cursor time %v, got %v", tt.wantTime, cursor.CreatedAt)
+			}
+		})
+	}
+}
+
+func encodeChirpCursorRaw(raw string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
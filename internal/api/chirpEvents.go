@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/events"
+)
+
+// publishChirpEvent tells live subscribers about a change to a chirp. it is
+// called after the change is stored, so subscribers never see a chirp that
+// doesn't exist yet.
+func (cfg *APIConfig) publishChirpEvent(ctx context.Context, eventType events.Type, chirp database.Chirp) {
+	payload := newCompleteChirp(chirp)
+	if eventType == events.ChirpDeleted {
+		payload.Body = ""
+		payload.Deleted = true
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	cfg.events.Publish(events.Event{
+		Type:      eventType,
+		ChirpID:   chirp.ID,
+		AuthorID:  chirp.UserID,
+		ThreadIDs: cfg.chirpThreadIDs(ctx, chirp),
+		Data:      data,
+	})
+}
+
+// chirpThreadIDs returns the ids of the chirp and everything above it in its
+// thread, so subscribers to any of those threads hear about it. it starts
+// from the parent because a deleted chirp may already be gone.
+func (cfg *APIConfig) chirpThreadIDs(ctx context.Context, chirp database.Chirp) []string {
+	threadIDs := []string{chirp.ID}
+	if !chirp.ReplyToID.Valid {
+		return threadIDs
+	}
+	threadIDs = append(threadIDs, chirp.ReplyToID.String)
+	// a failed lookup only narrows who hears about the event
+	ancestors, _ := cfg.dbQueries.GetChirpAncestors(ctx, chirp.ReplyToID.String)
+	for _, ancestor := range ancestors {
+		threadIDs = append(threadIDs, ancestor.ID)
+	}
+	return threadIDs
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+// newCompleteChirp converts a chirp row into its response shape. counts are
+// filled in separately by loadChirpCounts so lists can fetch them in one query.
+func newCompleteChirp(chirp database.Chirp) CompleteChirp {
+	return CompleteChirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		ReplyToID: chirp.ReplyToID.String,
+		Deleted:   chirp.DeletedAt.Valid,
+	}
+}
+
+// listedChirp is a chirp as it appears in a listing. chirps that were
+// rechirped are listed under the rechirper at the time of the rechirp.
+type listedChirp struct {
+	chirp       database.Chirp
+	rechirpedBy string
+	rechirpedAt sql.NullTime
+}
+
+// cursor is the position of the chirp in its listing
+func (l listedChirp) cursor() chirpCursor {
+	if l.rechirpedAt.Valid {
+		return chirpCursor{CreatedAt: l.rechirpedAt.Time, ID: l.chirp.ID}
+	}
+	return chirpCursor{CreatedAt: l.chirp.CreatedAt, ID: l.chirp.ID}
+}
+
+func listedChirps(chirps []database.Chirp) []listedChirp {
+	listed := make([]listedChirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		listed = append(listed, listedChirp{chirp: chirp})
+	}
+	return listed
+}
+
+// loadChirpCounts fills in the reply, like and rechirp counts of the given
+// chirps. when viewerID is set it also fills in whether that user liked them.
+func (cfg *APIConfig) loadChirpCounts(ctx context.Context, viewerID string, chirps ...*CompleteChirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+
+	replyRows, err := cfg.dbQueries.CountRepliesByChirpIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	replyCounts := map[string]int64{}
+	for _, row := range replyRows {
+		replyCounts[row.ChirpID] = row.ReplyCount
+	}
+
+	likeRows, err := cfg.dbQueries.CountLikesByChirpIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	likeCounts := map[string]int64{}
+	for _, row := range likeRows {
+		likeCounts[row.ChirpID] = row.LikeCount
+	}
+
+	rechirpRows, err := cfg.dbQueries.CountRechirpsByChirpIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	rechirpCounts := map[string]int64{}
+	for _, row := range rechirpRows {
+		rechirpCounts[row.ChirpID] = row.RechirpCount
+	}
+
+	var liked map[string]bool
+	if viewerID != "" {
+		likedIDs, err := cfg.dbQueries.ListLikedChirpIDs(ctx, database.ListLikedChirpIDsParams{
+			UserID:   viewerID,
+			ChirpIds: ids,
+		})
+		if err != nil {
+			return err
+		}
+		liked = map[string]bool{}
+		for _, id := range likedIDs {
+			liked[id] = true
+		}
+	}
+
+	for _, chirp := range chirps {
+		chirp.ReplyCount = replyCounts[chirp.ID]
+		chirp.LikeCount = likeCounts[chirp.ID]
+		chirp.RechirpCount = rechirpCounts[chirp.ID]
+		if liked != nil {
+			likedByMe := liked[chirp.ID]
+			chirp.LikedByMe = &likedByMe
+		}
+	}
+	return nil
+}
+
+// loadChirpPageCounts is loadChirpCounts for every chirp in a page
+func (cfg *APIConfig) loadChirpPageCounts(ctx context.Context, viewerID string, page ChirpPage) error {
+	chirps := make([]*CompleteChirp, 0, len(page.Chirps))
+	for i := range page.Chirps {
+		chirps = append(chirps, &page.Chirps[i])
+	}
+	return cfg.loadChirpCounts(ctx, viewerID, chirps...)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+// errSelfRechirp is returned by HandleRechirp's action when the user wrote the
+// chirp
+var errSelfRechirp = errors.New("Cannot rechirp your own chirp")
+
+func (cfg *APIConfig) HandleLikeChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.handleChirpEngagement(w, r, func(ctx context.Context, userID string, chirp database.Chirp) error {
+		// liking a chirp twice is a no-op; the primary key keeps the count exact
+		_, err := cfg.dbQueries.CreateLike(ctx, database.CreateLikeParams{
+			UserID:    userID,
+			ChirpID:   chirp.ID,
+			CreatedAt: time.Now().UTC(),
+		})
+		return err
+	})
+}
+
+func (cfg *APIConfig) HandleUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.handleChirpEngagement(w, r, func(ctx context.Context, userID string, chirp database.Chirp) error {
+		_, err := cfg.dbQueries.DeleteLike(ctx, database.DeleteLikeParams{
+			UserID:  userID,
+			ChirpID: chirp.ID,
+		})
+		return err
+	})
+}
+
+func (cfg *APIConfig) HandleRechirp(w http.ResponseWriter, r *http.Request) {
+	cfg.handleChirpEngagement(w, r, func(ctx context.Context, userID string, chirp database.Chirp) error {
+		// the chirp is already in the author's own listing
+		if chirp.UserID == userID {
+			return errSelfRechirp
+		}
+		_, err := cfg.dbQueries.CreateRechirp(ctx, database.CreateRechirpParams{
+			UserID:    userID,
+			ChirpID:   chirp.ID,
+			CreatedAt: time.Now().UTC(),
+		})
+		return err
+	})
+}
+
+func (cfg *APIConfig) HandleUndoRechirp(w http.ResponseWriter, r *http.Request) {
+	cfg.handleChirpEngagement(w, r, func(ctx context.Context, userID string, chirp database.Chirp) error {
+		_, err := cfg.dbQueries.DeleteRechirp(ctx, database.DeleteRechirpParams{
+			UserID:  userID,
+			ChirpID: chirp.ID,
+		})
+		return err
+	})
+}
+
+// handleChirpEngagement authenticates the request, applies action to the
+// chirp in the path and responds with the chirp and its updated counts
+func (cfg *APIConfig) handleChirpEngagement(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, userID string, chirp database.Chirp) error) {
+	userID, err := cfg.scopedUserID(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), r.PathValue("id"))
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: "Chirp not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error getting chirp by id: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	if err := action(r.Context(), userID.String(), chirp); err != nil {
+		if err == errSelfRechirp {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	completeChirp := newCompleteChirp(chirp)
+	if err := cfg.loadChirpCounts(r.Context(), userID.String(), &completeChirp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error loading chirp counts: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	responseJSON, _ := json.Marshal(completeChirp)
+	w.Write(responseJSON)
+}
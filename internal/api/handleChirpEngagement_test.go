@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+func engagementRequest(t *testing.T, method, chirpID, action, token string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, "/api/chirps/"+chirpID+"/"+action, nil)
+	req.SetPathValue("id", chirpID)
+	if token != "" {
+		withBearer(req, token)
+	}
+	return req
+}
+
+func TestHandleLikeChirp(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	author := createTestUser(t, cfg, "author@example.com", "password")
+	fan := createTestUser(t, cfg, "fan@example.com", "password")
+	insertTestChirp(t, cfg, "c1", author.ID, "likeable", time.Now())
+
+	rec := serve(cfg.HandleLikeChirp, engagementRequest(t, "POST", "c1", "like", ""))
+	expectStatus(t, rec, http.StatusUnauthorized)
+	rec = serve(cfg.HandleLikeChirp, engagementRequest(t, "POST", "missing", "like", fan.Token))
+	expectStatus(t, rec, http.StatusNotFound)
+
+	// liking twice only counts once
+	for i := 0; i < 2; i++ {
+		rec = serve(cfg.HandleLikeChirp, engagementRequest(t, "POST", "c1", "like", fan.Token))
+		expectStatus(t, rec, http.StatusOK)
+	}
+	chirp := decodeResponse[CompleteChirp](t, rec)
+	if chirp.LikeCount != 1 || chirp.LikedByMe == nil || !*chirp.LikedByMe {
+		t.Fatalf("Expected one like by me, got %+v", chirp)
+	}
+
+	// liked_by_me is personal and only present with a token
+	rec = serve(cfg.HandleGetChirpByID, withBearer(httptest.NewRequest("GET", "/api/chirps/c1", nil), author.Token))
+	chirp = decodeResponse[CompleteChirp](t, rec)
+	if chirp.LikeCount != 1 || chirp.LikedByMe == nil || *chirp.LikedByMe {
+		t.Fatalf("Expected liked_by_me false for the author, got %+v", chirp)
+	}
+	rec = serve(cfg.HandleGetChirpByID, httptest.NewRequest("GET", "/api/chirps/c1", nil))
+	chirp = decodeResponse[CompleteChirp](t, rec)
+	if chirp.LikedByMe != nil {
+		t.Fatalf("Expected no liked_by_me without a token, got %+v", chirp)
+	}
+
+	for i := 0; i < 2; i++ {
+		rec = serve(cfg.HandleUnlikeChirp, engagementRequest(t, "DELETE", "c1", "like", fan.Token))
+		expectStatus(t, rec, http.StatusOK)
+	}
+	chirp = decodeResponse[CompleteChirp](t, rec)
+	if chirp.LikeCount != 0 || *chirp.LikedByMe {
+		t.Fatalf("Expected like to be removed, got %+v", chirp)
+	}
+}
+
+func TestHandleLikeChirpConcurrent(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	ctx := context.Background()
+	const users = 20
+	var ids, tokens []string
+	for i := 0; i < users; i++ {
+		id := uuid.New()
+		_, err := cfg.dbQueries.CreateUser(ctx, database.CreateUserParams{
+			ID:        id.String(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			Email:     fmt.Sprintf("user%d@example.com", i),
+		})
+		if err != nil {
+			t.Fatalf("Error creating user: %v", err)
+		}
+		token, err := auth.MakeJWT(id, auth.RoleUser, cfg.tokenKeys, time.Hour)
+		if err != nil {
+			t.Fatalf("Error making token: %v", err)
+		}
+		ids = append(ids, id.String())
+		tokens = append(tokens, token)
+	}
+	insertTestChirp(t, cfg, "c1", ids[0], "popular", time.Now())
+
+	// every user likes the chirp several times at once
+	var wg sync.WaitGroup
+	for _, token := range tokens {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(token string) {
+				defer wg.Done()
+				rec := serve(cfg.HandleLikeChirp, engagementRequest(t, "POST", "c1", "like", token))
+				if rec.Code != http.StatusOK {
+					t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+				}
+			}(token)
+		}
+	}
+	wg.Wait()
+
+	rec := serve(cfg.HandleGetChirpByID, httptest.NewRequest("GET", "/api/chirps/c1", nil))
+	if chirp := decodeResponse[CompleteChirp](t, rec); chirp.LikeCount != users {
+		t.Fatalf("Expected %d likes, got %d", users, chirp.LikeCount)
+	}
+}
+
+func TestHandleRechirp(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com", "password")
+	bob := createTestUser(t, cfg, "bob@example.com", "password")
+	base := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	insertTestChirp(t, cfg, "a1", alice.ID, "alice's chirp", base)
+	insertTestChirp(t, cfg, "b1", bob.ID, "bob's first", base.Add(time.Minute))
+	insertTestChirp(t, cfg, "b2", bob.ID, "bob's second", base.Add(3*time.Minute))
+
+	rec := serve(cfg.HandleRechirp, engagementRequest(t, "POST", "a1", "rechirp", bob.Token))
+	expectStatus(t, rec, http.StatusOK)
+	if chirp := decodeResponse[CompleteChirp](t, rec); chirp.RechirpCount != 1 {
+		t.Fatalf("Expected one rechirp, got %+v", chirp)
+	}
+
+	// the rechirp is listed under bob at the time of the rechirp
+	rec = serve(cfg.HandleGetAllChirps, httptest.NewRequest("GET", "/api/chirps?author_id="+bob.ID+"&sort=desc", nil))
+	expectStatus(t, rec, http.StatusOK)
+	page := decodeResponse[ChirpPage](t, rec)
+	if len(page.Chirps) != 3 {
+		t.Fatalf("Expected 3 chirps for bob, got %+v", page.Chirps)
+	}
+	rechirp := page.Chirps[0]
+	if rechirp.ID != "a1" || rechirp.UserID != alice.ID || rechirp.RechirpedBy != bob.ID || rechirp.RechirpedAt == nil {
+		t.Fatalf("Expected a1 rechirped by bob first, got %+v", rechirp)
+	}
+	if page.Chirps[1].ID != "b2" || page.Chirps[1].RechirpedBy != "" {
+		t.Fatalf("Expected b2 second, got %+v", page.Chirps[1])
+	}
+
+	// the original author's listing is unaffected
+	rec = serve(cfg.HandleGetAllChirps, httptest.NewRequest("GET", "/api/chirps?author_id="+alice.ID, nil))
+	if page := decodeResponse[ChirpPage](t, rec); len(page.Chirps) != 1 || page.Chirps[0].RechirpedBy != "" {
+		t.Fatalf("Expected only alice's own chirp, got %+v", page.Chirps)
+	}
+
+	rec = serve(cfg.HandleUndoRechirp, engagementRequest(t, "DELETE", "a1", "rechirp", bob.Token))
+	expectStatus(t, rec, http.StatusOK)
+	rec = serve(cfg.HandleGetAllChirps, httptest.NewRequest("GET", "/api/chirps?author_id="+bob.ID, nil))
+	if page := decodeResponse[ChirpPage](t, rec); len(page.Chirps) != 2 {
+		t.Fatalf("Expected rechirp to be removed, got %+v", page.Chirps)
+	}
+}
+
+func TestHandleRechirpOwnChirp(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com", "password")
+	insertTestChirp(t, cfg, "a1", alice.ID, "alice's chirp", time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC))
+
+	rec := serve(cfg.HandleRechirp, engagementRequest(t, "POST", "a1", "rechirp", alice.Token))
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = serve(cfg.HandleGetAllChirps, httptest.NewRequest("GET", "/api/chirps?author_id="+alice.ID, nil))
+	if page := decodeResponse[ChirpPage](t, rec); len(page.Chirps) != 1 || page.Chirps[0].RechirpedBy != "" {
+		t.Fatalf("Expected alice's chirp listed once, got %+v", page.Chirps)
+	}
+}
+
+func TestHandleRechirpOrderOffUTC(t *testing.T) {
+	withLocalZone(t, time.FixedZone("UTC-7", -7*60*60))
+	cfg := newTestAPIConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com", "password")
+	bob := createTestUser(t, cfg, "bob@example.com", "password")
+	insertTestChirp(t, cfg, "a1", alice.ID, "alice's chirp", time.Now().UTC().Add(-time.Hour))
+
+	// bob rechirps and then chirps, so his own chirp is listed first
+	rec := serve(cfg.HandleRechirp, engagementRequest(t, "POST", "a1", "rechirp", bob.Token))
+	expectStatus(t, rec, http.StatusOK)
+	rec = serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{
+		"body": "after the rechirp",
+	}), bob.Token))
+	expectStatus(t, rec, http.StatusCreated)
+	chirp := decodeResponse[CompleteChirp](t, rec)
+
+	rec = serve(cfg.HandleGetAllChirps, httptest.NewRequest("GET", "/api/chirps?author_id="+bob.ID+"&sort=desc", nil))
+	expectStatus(t, rec, http.StatusOK)
+	page := decodeResponse[ChirpPage](t, rec)
+	if len(page.Chirps) != 2 || page.Chirps[0].ID != chirp.ID || page.Chirps[1].ID != "a1" {
+		t.Fatalf("Expected %s then a1, got %+v", chirp.ID, page.Chirps)
+	}
+}
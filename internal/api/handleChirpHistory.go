@@ -0,0 +1,75 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type ChirpRevision struct {
+	Body string `json:"body"`
+	// CreatedAt is when this version of the body was written
+	CreatedAt time.Time `json:"created_at"`
+	// ReplacedAt is when it was edited, and is omitted for the current body
+	ReplacedAt *time.Time `json:"replaced_at,omitempty"`
+}
+
+type ChirpHistory struct {
+	ChirpID string `json:"chirp_id"`
+	// Revisions runs from the original body to the current one
+	Revisions []ChirpRevision `json:"revisions"`
+}
+
+// HandleGetChirpHistory returns every version of a chirp's body, oldest first.
+// deleted chirps have their history removed along with their body.
+func (cfg *APIConfig) HandleGetChirpHistory(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), id)
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: "Chirp not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error getting chirp by id: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	revisions, err := cfg.dbQueries.ListChirpRevisions(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error listing chirp revisions: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	history := ChirpHistory{ChirpID: chirp.ID, Revisions: make([]ChirpRevision, 0, len(revisions)+1)}
+	for _, revision := range revisions {
+		replacedAt := revision.ReplacedAt
+		history.Revisions = append(history.Revisions, ChirpRevision{
+			Body:       revision.Body,
+			CreatedAt:  revision.CreatedAt,
+			ReplacedAt: &replacedAt,
+		})
+	}
+	history.Revisions = append(history.Revisions, ChirpRevision{
+		Body:      chirp.Body,
+		CreatedAt: chirp.UpdatedAt,
+	})
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	jsonResponse, _ := json.Marshal(history)
+	w.Write(jsonResponse)
+}
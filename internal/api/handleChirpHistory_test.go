@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleGetChirpHistory(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "editor@example.com", "password")
+	insertTestChirp(t, cfg, "c1", user.ID, "first", time.Now().Add(-time.Hour))
+
+	getHistory := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/chirps/"+id+"/history", nil)
+		req.SetPathValue("id", id)
+		return serve(cfg.HandleGetChirpHistory, req)
+	}
+
+	rec := getHistory("c1")
+	expectStatus(t, rec, http.StatusOK)
+	if history := decodeResponse[ChirpHistory](t, rec); len(history.Revisions) != 1 || history.Revisions[0].ReplacedAt != nil {
+		t.Fatalf("Expected only the current body for an unedited chirp, got %+v", history)
+	}
+
+	for _, body := range []string{"second", "third"} {
+		req := withBearer(newJSONRequest(t, "PUT", "/api/chirps/c1", map[string]string{"body": body}), user.Token)
+		req.SetPathValue("id", "c1")
+		expectStatus(t, serve(cfg.HandleUpdateChirp, req), http.StatusOK)
+	}
+
+	rec = getHistory("c1")
+	expectStatus(t, rec, http.StatusOK)
+	history := decodeResponse[ChirpHistory](t, rec)
+	if history.ChirpID != "c1" || len(history.Revisions) != 3 {
+		t.Fatalf("Expected 3 revisions, got %+v", history)
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		revision := history.Revisions[i]
+		if revision.Body != want {
+			t.Fatalf("Expected revision %d to be %q, got %q", i, want, revision.Body)
+		}
+		if i < 2 && (revision.ReplacedAt == nil || revision.ReplacedAt.Before(revision.CreatedAt)) {
+			t.Fatalf("Expected revision %d to be replaced after it was written, got %+v", i, revision)
+		}
+		if i > 0 && !revision.CreatedAt.Equal(*history.Revisions[i-1].ReplacedAt) {
+			t.Fatalf("Expected revision %d to start when the previous one was replaced", i)
+		}
+	}
+	if history.Revisions[2].ReplacedAt != nil {
+		t.Fatalf("Expected the current body to have no replaced_at")
+	}
+
+	expectStatus(t, getHistory("missing"), http.StatusNotFound)
+
+	// deleting a chirp takes its history with it
+	rec = serve(cfg.HandleDeleteChirp, withBearer(httptest.NewRequest("DELETE", "/api/chirps/c1", nil), user.Token))
+	expectStatus(t, rec, http.StatusNoContent)
+	expectStatus(t, getHistory("c1"), http.StatusNotFound)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+const maxSearchQueryLength = 256
+
+type SearchChirpResult struct {
+	CompleteChirp
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type SearchChirpPage struct {
+	Chirps     []SearchChirpResult `json:"chirps"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+func (cfg *APIConfig) HandleSearchChirps(w http.ResponseWriter, r *http.Request) {
+	// query params
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	authorID := r.URL.Query().Get("author_id")
+	if query == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: "q is required"})
+		w.Write(jsonResponse)
+		return
+	}
+	if len(query) > maxSearchQueryLength {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("q must be at most %d characters", maxSearchQueryLength)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	limit := defaultChirpPageSize
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: "limit must be a positive integer"})
+			w.Write(jsonResponse)
+			return
+		}
+		limit = min(parsed, maxChirpPageSize)
+	}
+	offset := 0
+	if after := r.URL.Query().Get("after"); after != "" {
+		decoded, err := decodeSearchCursor(after)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		offset = decoded
+	}
+
+	// fetch one extra row so we know whether there is a next page
+	var rows []database.SearchChirpsRow
+	var err error
+	if authorID != "" {
+		var authorRows []database.SearchChirpsByUserIDRow
+		authorRows, err = cfg.dbQueries.SearchChirpsByUserID(r.Context(), database.SearchChirpsByUserIDParams{
+			Query:      query,
+			UserID:     authorID,
+			PageSize:   int32(limit + 1),
+			PageOffset: int32(offset),
+		})
+		for _, row := range authorRows {
+			rows = append(rows, database.SearchChirpsRow(row))
+		}
+	} else {
+		rows, err = cfg.dbQueries.SearchChirps(r.Context(), database.SearchChirpsParams{
+			Query:      query,
+			PageSize:   int32(limit + 1),
+			PageOffset: int32(offset),
+		})
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error searching chirps: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	page := SearchChirpPage{Chirps: []SearchChirpResult{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		page.NextCursor = encodeSearchCursor(offset + limit)
+	}
+	for _, row := range rows {
+		page.Chirps = append(page.Chirps, SearchChirpResult{
+			CompleteChirp: newCompleteChirp(row.Chirp),
+			Rank:          row.Rank,
+			Snippet:       row.Snippet,
+		})
+	}
+	chirps := make([]*CompleteChirp, 0, len(page.Chirps))
+	for i := range page.Chirps {
+		chirps = append(chirps, &page.Chirps[i].CompleteChirp)
+	}
+	if err := cfg.loadChirpCounts(r.Context(), cfg.viewerID(r), chirps...); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error loading chirp counts: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	responseJSON, _ := json.Marshal(page)
+	w.Write(responseJSON)
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleSearchChirps(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com", "password")
+	bob := createTestUser(t, cfg, "bob@example.com", "password")
+
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	insertTestChirp(t, cfg, "c1", alice.ID, "Coffee first, then code", base)
+	insertTestChirp(t, cfg, "c2", bob.ID, "coffee coffee coffee", base.Add(time.Minute))
+	insertTestChirp(t, cfg, "c3", alice.ID, "Tea is fine too", base.Add(2*time.Minute))
+	insertTestChirp(t, cfg, "c4", bob.ID, "Late night code and coffee", base.Add(3*time.Minute))
+
+	search := func(query string) SearchChirpPage {
+		t.Helper()
+		rec := serve(cfg.HandleSearchChirps, httptest.NewRequest("GET", "/api/chirps/search?"+query, nil))
+		expectStatus(t, rec, http.StatusOK)
+		return decodeResponse[SearchChirpPage](t, rec)
+	}
+	ids := func(page SearchChirpPage) string {
+		got := []string{}
+		for _, chirp := range page.Chirps {
+			got = append(got, chirp.ID)
+		}
+		return strings.Join(got, ",")
+	}
+
+	// c2 ranks highest because every word matches
+	if got := ids(search("q=coffee")); got != "c2,c1,c4" {
+		t.Fatalf("Expected c2,c1,c4, got %s", got)
+	}
+	if got := ids(search("q=coffee+code")); got != "c1,c4" {
+		t.Fatalf("Expected c1,c4, got %s", got)
+	}
+	if got := ids(search("q=coffee&author_id=" + alice.ID)); got != "c1" {
+		t.Fatalf("Expected c1, got %s", got)
+	}
+	if got := ids(search("q=espresso")); got != "" {
+		t.Fatalf("Expected no results, got %s", got)
+	}
+
+	page := search("q=tea")
+	if len(page.Chirps) != 1 || page.Chirps[0].Snippet != "<mark>Tea</mark> is fine too" {
+		t.Fatalf("Expected highlighted snippet, got %+v", page.Chirps)
+	}
+
+	first := search("q=coffee&limit=2")
+	if ids(first) != "c2,c1" || first.NextCursor == "" {
+		t.Fatalf("Unexpected first page: %s next=%q", ids(first), first.NextCursor)
+	}
+	second := search("q=coffee&limit=2&after=" + first.NextCursor)
+	if ids(second) != "c4" || second.NextCursor != "" {
+		t.Fatalf("Unexpected second page: %s next=%q", ids(second), second.NextCursor)
+	}
+
+	for _, query := range []string{"", "q=+", "q=coffee&limit=0", "q=coffee&after=bogus", "q=" + strings.Repeat("a", maxSearchQueryLength+1)} {
+		rec := serve(cfg.HandleSearchChirps, httptest.NewRequest("GET", "/api/chirps/search?"+query, nil))
+		expectStatus(t, rec, http.StatusBadRequest)
+	}
+}
+
+func TestSearchChirpSnippetEscapesBody(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "mallory@example.com", "password")
+	insertTestChirp(t, cfg, "c1", user.ID, `<img src=x onerror="alert(1)"> cats & dogs`, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	rec := serve(cfg.HandleSearchChirps, httptest.NewRequest("GET", "/api/chirps/search?q=cats", nil))
+	expectStatus(t, rec, http.StatusOK)
+	page := decodeResponse[SearchChirpPage](t, rec)
+	want := `&lt;img src=x onerror="alert(1)"&gt; <mark>cats</mark> &amp; dogs`
+	if len(page.Chirps) != 1 || page.Chirps[0].Snippet != want {
+		t.Fatalf("Expected snippet %q, got %+v", want, page.Chirps)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/events"
+)
+
+// HandleChirpStream pushes chirp changes to the client as server-sent events
+// until the client disconnects. clients that reconnect with a Last-Event-ID
+// header are sent the retained events they missed first.
+func (cfg *APIConfig) HandleChirpStream(w http.ResponseWriter, r *http.Request) {
+	authorID := r.URL.Query().Get("author_id")
+
+	var lastEventID uint64
+	resume := false
+	if rawLastEventID := r.Header.Get("Last-Event-ID"); rawLastEventID != "" {
+		parsed, err := strconv.ParseUint(rawLastEventID, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: "Last-Event-ID must be an event id"})
+			w.Write(jsonResponse)
+			return
+		}
+		lastEventID = parsed
+		resume = true
+	}
+
+	// typing indicators are only sent over websockets
+	filter := func(event events.Event) bool {
+		return event.Type != events.Typing && (authorID == "" || event.AuthorID == authorID)
+	}
+	sub := cfg.events.Subscribe(filter, lastEventID, resume)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// stop nginx and friends from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(cfg.streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// dropped for falling behind; the client will reconnect and
+				// resume from the last id it saw
+				return
+			}
+			_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+			if err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type streamEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// openChirpStream connects to the stream over a real server so that
+// flushing and disconnects behave as they do in production
+func openChirpStream(t *testing.T, cfg *APIConfig, query, lastEventID string) (*bufio.Reader, context.CancelFunc) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(cfg.HandleChirpStream))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/chirps/stream"+query, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error opening stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+	return bufio.NewReader(resp.Body), cancel
+}
+
+// readStreamEvent reads the next event, returning comments such as
+// heartbeats as events with only Data set
+func readStreamEvent(t *testing.T, reader *bufio.Reader) streamEvent {
+	t.Helper()
+	var event streamEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Error reading stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return event
+		case strings.HasPrefix(line, ":"):
+			event.Data = line
+		case strings.HasPrefix(line, "id: "):
+			event.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func waitForSubscribers(t *testing.T, cfg *APIConfig, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for cfg.events.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d subscribers, got %d", n, cfg.events.Subscribers())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHandleChirpStream(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com", "password")
+	bob := createTestUser(t, cfg, "bob@example.com", "password")
+
+	all, cancelAll := openChirpStream(t, cfg, "", "")
+	onlyBob, cancelBob := openChirpStream(t, cfg, "?author_id="+bob.ID, "")
+	waitForSubscribers(t, cfg, 2)
+
+	createChirp := func(token, body string) CompleteChirp {
+		rec := serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{"body": body}), token))
+		expectStatus(t, rec, http.StatusCreated)
+		return decodeResponse[CompleteChirp](t, rec)
+	}
+	aliceChirp := createChirp(alice.Token, "from alice")
+	bobChirp := createChirp(bob.Token, "from bob")
+
+	req := withBearer(newJSONRequest(t, "PUT", "/api/chirps/"+bobChirp.ID, map[string]string{"body": "edited"}), bob.Token)
+	req.SetPathValue("id", bobChirp.ID)
+	rec := serve(cfg.HandleUpdateChirp, req)
+	expectStatus(t, rec, http.StatusOK)
+	rec = serve(cfg.HandleDeleteChirp, withBearer(httptest.NewRequest("DELETE", "/api/chirps/"+aliceChirp.ID, nil), alice.Token))
+	expectStatus(t, rec, http.StatusNoContent)
+
+	want := []struct {
+		event   string
+		chirpID string
+	}{
+		{"chirp.created", aliceChirp.ID},
+		{"chirp.created", bobChirp.ID},
+		{"chirp.updated", bobChirp.ID},
+		{"chirp.deleted", aliceChirp.ID},
+	}
+	for i, w := range want {
+		event := readStreamEvent(t, all)
+		var chirp CompleteChirp
+		if err := json.Unmarshal([]byte(event.Data), &chirp); err != nil {
+			t.Fatalf("Error decoding event data %q: %v", event.Data, err)
+		}
+		if event.Event != w.event || chirp.ID != w.chirpID {
+			t.Fatalf("Event %d: expected %s %s, got %s %s", i, w.event, w.chirpID, event.Event, chirp.ID)
+		}
+	}
+
+	// the author filtered stream only sees bob's chirps
+	for _, w := range []string{"chirp.created", "chirp.updated"} {
+		event := readStreamEvent(t, onlyBob)
+		if event.Event != w || !strings.Contains(event.Data, bobChirp.ID) {
+			t.Fatalf("Expected %s for bob's chirp, got %+v", w, event)
+		}
+	}
+
+	// disconnecting unsubscribes
+	cancelAll()
+	cancelBob()
+	waitForSubscribers(t, cfg, 0)
+}
+
+func TestHandleChirpStreamResume(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "resume@example.com", "password")
+	for _, body := range []string{"one", "two", "three"} {
+		rec := serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{"body": body}), user.Token))
+		expectStatus(t, rec, http.StatusCreated)
+	}
+
+	stream, cancel := openChirpStream(t, cfg, "", "1")
+	defer cancel()
+	for _, want := range []string{"2", "3"} {
+		if event := readStreamEvent(t, stream); event.ID != want {
+			t.Fatalf("Expected replayed event %s, got %+v", want, event)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/chirps/stream", nil)
+	req.Header.Set("Last-Event-ID", "not-a-number")
+	expectStatus(t, serve(cfg.HandleChirpStream, req), http.StatusBadRequest)
+}
+
+func TestHandleChirpStreamHeartbeat(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	cfg.streamHeartbeat = 10 * time.Millisecond
+
+	stream, cancel := openChirpStream(t, cfg, "", "")
+	defer cancel()
+	if event := readStreamEvent(t, stream); event.Data != ": heartbeat" {
+		t.Fatalf("Expected a heartbeat, got %+v", event)
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+type ThreadReply struct {
+	CompleteChirp
+	// Depth is 1 for direct replies to the requested chirp
+	Depth int32 `json:"depth"`
+}
+
+type ChirpThread struct {
+	// Ancestors runs from the root of the conversation down to the parent
+	Ancestors  []CompleteChirp `json:"ancestors"`
+	Chirp      CompleteChirp   `json:"chirp"`
+	Replies    []ThreadReply   `json:"replies"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// HandleGetChirpThread returns the conversation around a chirp: every
+// ancestor and a page of its descendants, oldest first. deleted chirps are
+// returned as tombstones so clients can still nest the replies under them.
+func (cfg *APIConfig) HandleGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	limit, cursor, err := parseChirpPageParams(r.URL.Query(), "asc")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: "Chirp not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error getting chirp by id: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	ancestors, err := cfg.dbQueries.GetChirpAncestors(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error getting ancestors: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	// fetch one extra row so we know whether there is a next page
+	descendants, err := cfg.dbQueries.ListChirpDescendants(r.Context(), database.ListChirpDescendantsParams{
+		ID:              id,
+		CursorCreatedAt: cursor.CreatedAt,
+		CursorID:        cursor.ID,
+		PageSize:        int32(limit + 1),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error getting replies: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	thread := ChirpThread{
+		Ancestors: []CompleteChirp{},
+		Chirp:     newCompleteChirp(chirp),
+		Replies:   []ThreadReply{},
+	}
+	if len(descendants) > limit {
+		descendants = descendants[:limit]
+		last := descendants[len(descendants)-1].Chirp
+		thread.NextCursor = encodeChirpCursor(chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	for _, ancestor := range ancestors {
+		thread.Ancestors = append(thread.Ancestors, newCompleteChirp(ancestor))
+	}
+	for _, row := range descendants {
+		thread.Replies = append(thread.Replies, ThreadReply{
+			CompleteChirp: newCompleteChirp(row.Chirp),
+			Depth:         row.Depth,
+		})
+	}
+
+	chirps := []*CompleteChirp{&thread.Chirp}
+	for i := range thread.Ancestors {
+		chirps = append(chirps, &thread.Ancestors[i])
+	}
+	for i := range thread.Replies {
+		chirps = append(chirps, &thread.Replies[i].CompleteChirp)
+	}
+	if err := cfg.loadChirpCounts(r.Context(), cfg.viewerID(r), chirps...); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error loading chirp counts: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	responseJSON, _ := json.Marshal(thread)
+	w.Write(responseJSON)
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+// insertTestReply writes a reply straight to the store
+func insertTestReply(t *testing.T, cfg *APIConfig, id, userID, replyToID string, createdAt time.Time) {
+	t.Helper()
+	_, err := cfg.dbQueries.CreateChirp(context.Background(), database.CreateChirpParams{
+		ID:        id,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Body:      "reply " + id,
+		UserID:    userID,
+		ReplyToID: sql.NullString{String: replyToID, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("Error inserting reply: %v", err)
+	}
+}
+
+func getThread(t *testing.T, cfg *APIConfig, id, query string) ChirpThread {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/chirps/"+id+"/thread"+query, nil)
+	req.SetPathValue("id", id)
+	rec := serve(cfg.HandleGetChirpThread, req)
+	expectStatus(t, rec, http.StatusOK)
+	return decodeResponse[ChirpThread](t, rec)
+}
+
+func TestHandleCreateChirpReply(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "replier@example.com", "password")
+	insertTestChirp(t, cfg, "root", user.ID, "root", time.Now())
+
+	rec := serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{
+		"body":        "a reply",
+		"reply_to_id": "root",
+	}), user.Token))
+	expectStatus(t, rec, http.StatusCreated)
+	reply := decodeResponse[CompleteChirp](t, rec)
+	if reply.ReplyToID != "root" {
+		t.Fatalf("Expected reply_to_id root, got %q", reply.ReplyToID)
+	}
+
+	rec = serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{
+		"body":        "a reply",
+		"reply_to_id": "missing",
+	}), user.Token))
+	expectStatus(t, rec, http.StatusNotFound)
+
+	req := httptest.NewRequest("GET", "/api/chirps/root", nil)
+	rec = serve(cfg.HandleGetChirpByID, req)
+	expectStatus(t, rec, http.StatusOK)
+	if root := decodeResponse[CompleteChirp](t, rec); root.ReplyCount != 1 {
+		t.Fatalf("Expected reply_count 1, got %d", root.ReplyCount)
+	}
+}
+
+func TestHandleGetChirpThread(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "threads@example.com", "password")
+	base := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	insertTestChirp(t, cfg, "root", user.ID, "root", base)
+	insertTestReply(t, cfg, "a", user.ID, "root", base.Add(1*time.Minute))
+	insertTestReply(t, cfg, "b", user.ID, "a", base.Add(2*time.Minute))
+	insertTestReply(t, cfg, "c", user.ID, "root", base.Add(3*time.Minute))
+	insertTestReply(t, cfg, "d", user.ID, "b", base.Add(4*time.Minute))
+
+	thread := getThread(t, cfg, "b", "")
+	if len(thread.Ancestors) != 2 || thread.Ancestors[0].ID != "root" || thread.Ancestors[1].ID != "a" {
+		t.Fatalf("Expected ancestors [root a], got %+v", thread.Ancestors)
+	}
+	if thread.Chirp.ID != "b" || thread.Chirp.ReplyCount != 1 {
+		t.Fatalf("Unexpected chirp: %+v", thread.Chirp)
+	}
+	if len(thread.Replies) != 1 || thread.Replies[0].ID != "d" || thread.Replies[0].Depth != 1 {
+		t.Fatalf("Expected replies [d], got %+v", thread.Replies)
+	}
+
+	// descendants are paged oldest first across every depth
+	var ids []string
+	var depths []int32
+	query := "?limit=2"
+	for page := 0; ; page++ {
+		if page > 3 {
+			t.Fatalf("Too many pages")
+		}
+		thread = getThread(t, cfg, "root", query)
+		if len(thread.Ancestors) != 0 || thread.Chirp.ReplyCount != 2 {
+			t.Fatalf("Unexpected root: %+v %+v", thread.Ancestors, thread.Chirp)
+		}
+		for _, reply := range thread.Replies {
+			ids = append(ids, reply.ID)
+			depths = append(depths, reply.Depth)
+		}
+		if thread.NextCursor == "" {
+			break
+		}
+		query = "?limit=2&after=" + thread.NextCursor
+	}
+	wantIDs := []string{"a", "b", "c", "d"}
+	wantDepths := []int32{1, 2, 1, 3}
+	for i := range wantIDs {
+		if i >= len(ids) || ids[i] != wantIDs[i] || depths[i] != wantDepths[i] {
+			t.Fatalf("Expected %v at depths %v, got %v at depths %v", wantIDs, wantDepths, ids, depths)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/chirps/missing/thread", nil)
+	req.SetPathValue("id", "missing")
+	expectStatus(t, serve(cfg.HandleGetChirpThread, req), http.StatusNotFound)
+}
+
+func TestHandleDeleteChirpTombstonesParent(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "tombstone@example.com", "password")
+	base := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	insertTestChirp(t, cfg, "root", user.ID, "root", base)
+	insertTestReply(t, cfg, "a", user.ID, "root", base.Add(time.Minute))
+
+	rec := serve(cfg.HandleDeleteChirp, withBearer(httptest.NewRequest("DELETE", "/api/chirps/root", nil), user.Token))
+	expectStatus(t, rec, http.StatusNoContent)
+
+	// the parent stays in the thread as a tombstone
+	thread := getThread(t, cfg, "a", "")
+	if len(thread.Ancestors) != 1 || !thread.Ancestors[0].Deleted || thread.Ancestors[0].Body != "" {
+		t.Fatalf("Expected a tombstoned ancestor, got %+v", thread.Ancestors)
+	}
+
+	// but is gone from listings and can't be deleted or replied to again
+	rec = serve(cfg.HandleGetAllChirps, httptest.NewRequest("GET", "/api/chirps", nil))
+	expectStatus(t, rec, http.StatusOK)
+	if page := decodeResponse[ChirpPage](t, rec); len(page.Chirps) != 1 || page.Chirps[0].ID != "a" {
+		t.Fatalf("Expected only the reply to be listed, got %+v", page.Chirps)
+	}
+	rec = serve(cfg.HandleDeleteChirp, withBearer(httptest.NewRequest("DELETE", "/api/chirps/root", nil), user.Token))
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{
+		"body":        "too late",
+		"reply_to_id": "root",
+	}), user.Token))
+	expectStatus(t, rec, http.StatusNotFound)
+
+	// leaf chirps are removed outright
+	rec = serve(cfg.HandleDeleteChirp, withBearer(httptest.NewRequest("DELETE", "/api/chirps/a", nil), user.Token))
+	expectStatus(t, rec, http.StatusNoContent)
+	rec = serve(cfg.HandleGetChirpByID, httptest.NewRequest("GET", "/api/chirps/a", nil))
+	expectStatus(t, rec, http.StatusNotFound)
+}
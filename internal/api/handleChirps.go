@@ -1,11 +1,14 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"sort"
 	"strings"
 	"time"
@@ -13,6 +16,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/landanqrew/go-serve-intro/internal/auth"
 	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/events"
 )
 
 type ChirpError struct {
@@ -29,6 +33,19 @@ type CompleteChirp struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body      string    `json:"body"`
 	UserID    string    `json:"user_id"`
+	ReplyToID string    `json:"reply_to_id,omitempty"`
+	// ReplyCount only counts direct replies that have not been deleted
+	ReplyCount int64 `json:"reply_count"`
+	// Deleted marks a tombstone left behind so a thread keeps its shape
+	Deleted      bool  `json:"deleted,omitempty"`
+	LikeCount    int64 `json:"like_count"`
+	RechirpCount int64 `json:"rechirp_count"`
+	// LikedByMe is only set when the request carries a valid bearer token
+	LikedByMe *bool `json:"liked_by_me,omitempty"`
+	// RechirpedBy and RechirpedAt are set when the chirp appears in an
+	// author listing because that author rechirped it
+	RechirpedBy string     `json:"rechirped_by,omitempty"`
+	RechirpedAt *time.Time `json:"rechirped_at,omitempty"`
 }
 
 type SuccessMessage struct {
@@ -74,8 +91,32 @@ func (cfg *APIConfig) HandleGetAllChirps(w http.ResponseWriter, r *http.Request)
 	if sortOrder != "asc" && sortOrder != "desc" {
 		sortOrder = "asc"
 	}
+	limit, cursor, err := parseChirpPageParams(r.URL.Query(), sortOrder)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	since, until, err := parseChirpTimeRange(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
 
-	chirps, err := cfg.dbQueries.GetAllChirps(r.Context())
+	// fetch one extra row so we know whether there is a next page
+	chirps, err := cfg.listChirps(r.Context(), chirpListFilter{
+		AuthorID:  authorID,
+		SortOrder: sortOrder,
+		Since:     since,
+		Until:     until,
+		Cursor:    cursor,
+		PageSize:  limit + 1,
+	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
@@ -84,35 +125,113 @@ func (cfg *APIConfig) HandleGetAllChirps(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// return all chirps
+	page := newChirpPage(chirps, limit)
+	if err := cfg.loadChirpPageCounts(r.Context(), cfg.viewerID(r), page); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error loading chirp counts: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
-	responseChirps := []CompleteChirp{}
-	for _, chirp := range chirps {
-		if authorID != "" && (chirp.UserID != authorID || chirp.UserID == "") {
-			continue
+	responseJSON, _ := json.Marshal(page)
+	w.Write(responseJSON)
+}
+
+type chirpListFilter struct {
+	AuthorID  string
+	SortOrder string
+	Since     time.Time
+	Until     time.Time
+	Cursor    chirpCursor
+	PageSize  int
+}
+
+// listChirps picks the query matching the filter so that author lookups use
+// the (user_id, created_at) index and sorting happens in postgres. author
+// listings also include the chirps the author rechirped.
+func (cfg *APIConfig) listChirps(ctx context.Context, filter chirpListFilter) ([]listedChirp, error) {
+	switch {
+	case filter.AuthorID != "" && filter.SortOrder == "desc":
+		rows, err := cfg.dbQueries.ListChirpsByUserIDDesc(ctx, database.ListChirpsByUserIDDescParams{
+			UserID:          filter.AuthorID,
+			CursorCreatedAt: filter.Cursor.CreatedAt,
+			CursorID:        filter.Cursor.ID,
+			Since:           filter.Since,
+			Until:           filter.Until,
+			PageSize:        int32(filter.PageSize),
+		})
+		if err != nil {
+			return nil, err
 		}
-		responseChirps = append(responseChirps, CompleteChirp{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
+		listed := make([]listedChirp, 0, len(rows))
+		for _, row := range rows {
+			listed = append(listed, listedChirp{chirp: row.Chirp, rechirpedBy: filter.AuthorID, rechirpedAt: row.RechirpedAt})
+		}
+		return listed, nil
+	case filter.AuthorID != "":
+		rows, err := cfg.dbQueries.ListChirpsByUserIDAsc(ctx, database.ListChirpsByUserIDAscParams{
+			UserID:          filter.AuthorID,
+			CursorCreatedAt: filter.Cursor.CreatedAt,
+			CursorID:        filter.Cursor.ID,
+			Since:           filter.Since,
+			Until:           filter.Until,
+			PageSize:        int32(filter.PageSize),
 		})
-	}
-	// sort chirps by created_at (asc by default, desc if sort_order is desc)
-	if sortOrder == "desc" {
-		// fmt.Println("sorting chirps in descending order")
-		// fmt.Printf("before: responseChirps: %+v\n", responseChirps)
-		sort.Slice(responseChirps, func(i, j int) bool {
-			return responseChirps[i].CreatedAt.After(responseChirps[j].CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		listed := make([]listedChirp, 0, len(rows))
+		for _, row := range rows {
+			listed = append(listed, listedChirp{chirp: row.Chirp, rechirpedBy: filter.AuthorID, rechirpedAt: row.RechirpedAt})
+		}
+		return listed, nil
+	case filter.SortOrder == "desc":
+		chirps, err := cfg.dbQueries.ListChirpsDesc(ctx, database.ListChirpsDescParams{
+			CursorCreatedAt: filter.Cursor.CreatedAt,
+			CursorID:        filter.Cursor.ID,
+			Since:           filter.Since,
+			Until:           filter.Until,
+			PageSize:        int32(filter.PageSize),
 		})
-		// fmt.Printf("after: responseChirps: %+v\n", responseChirps)
+		return listedChirps(chirps), err
+	default:
+		chirps, err := cfg.dbQueries.ListChirpsAsc(ctx, database.ListChirpsAscParams{
+			CursorCreatedAt: filter.Cursor.CreatedAt,
+			CursorID:        filter.Cursor.ID,
+			Since:           filter.Since,
+			Until:           filter.Until,
+			PageSize:        int32(filter.PageSize),
+		})
+		return listedChirps(chirps), err
 	}
-	// sortChirpsByCreatedAt(responseChirps, sortOrder)
-	responseChirpsJSON, _ := json.Marshal(responseChirps)
-	w.Write(responseChirpsJSON)
+}
 
+// parseChirpTimeRange reads the optional since (inclusive) and until
+// (exclusive) RFC3339 query params, defaulting to an unbounded range
+func parseChirpTimeRange(query url.Values) (time.Time, time.Time, error) {
+	since := chirpCursorMinTime
+	until := chirpCursorMaxTime
+	if rawSince := query.Get("since"); rawSince != "" {
+		parsed, err := time.Parse(time.RFC3339, rawSince)
+		if err != nil {
+			return since, until, errors.New("since must be an RFC3339 timestamp")
+		}
+		since = parsed.UTC()
+	}
+	if rawUntil := query.Get("until"); rawUntil != "" {
+		parsed, err := time.Parse(time.RFC3339, rawUntil)
+		if err != nil {
+			return since, until, errors.New("until must be an RFC3339 timestamp")
+		}
+		until = parsed.UTC()
+	}
+	if !since.Before(until) {
+		return since, until, errors.New("since must be before until")
+	}
+	return since, until, nil
 }
 
 func (cfg *APIConfig) HandleGetChirpByID(w http.ResponseWriter, r *http.Request) {
@@ -135,37 +254,28 @@ func (cfg *APIConfig) HandleGetChirpByID(w http.ResponseWriter, r *http.Request)
 		w.Write(jsonResponse)
 		return
 	}
+	completeChirp := newCompleteChirp(chirp)
+	if err := cfg.loadChirpCounts(r.Context(), cfg.viewerID(r), &completeChirp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error loading chirp counts: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
-	responseChirp, _ := json.Marshal(CompleteChirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
+	responseChirp, _ := json.Marshal(completeChirp)
 	w.Write(responseChirp)
 }
 
 func (cfg *APIConfig) HandleCreateChirp(w http.ResponseWriter, r *http.Request) {
 	type ValidChirpRequest struct {
-		Body string `json:"body"`
+		Body      string `json:"body"`
+		ReplyToID string `json:"reply_to_id"`
 	}
-	bearerToken, err := auth.GetBearerToken(r.Header)
+	userID, err := cfg.scopedUserID(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(jwtError{Error: err.Error()})
-		w.Write(jsonResponse)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(bearerToken, cfg.tokenSecret)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(jwtError{Error: err.Error()})
-		w.Write(jsonResponse)
+		writeAuthError(w, err)
 		return
 	}
 	fmt.Println("userID [HandleCreateChirp]:\n", userID)
@@ -179,6 +289,24 @@ func (cfg *APIConfig) HandleCreateChirp(w http.ResponseWriter, r *http.Request)
 
 	userIDString := userID.String()
 
+	if cfg.requireVerifiedEmail {
+		user, err := cfg.dbQueries.GetUserByID(r.Context(), userIDString)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		if !user.EmailVerifiedAt.Valid {
+			w.WriteHeader(http.StatusForbidden)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(forbiddenError{Error: "Verify your email address before posting"})
+			w.Write(jsonResponse)
+			return
+		}
+	}
+
 	// validate content type
 	postBody := &ValidChirpRequest{}
 	if r.Header.Get("Content-Type") != "application/json" {
@@ -239,13 +367,35 @@ func (cfg *APIConfig) HandleCreateChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// replies must point at a chirp that still exists
+	replyToID := sql.NullString{}
+	if postBody.ReplyToID != "" {
+		parent, err := cfg.dbQueries.GetChirpByID(r.Context(), postBody.ReplyToID)
+		if err != nil && err != sql.ErrNoRows {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error getting parent chirp: %v", err)})
+			w.Write(jsonResponse)
+			return
+		}
+		if err == sql.ErrNoRows || parent.DeletedAt.Valid {
+			w.WriteHeader(http.StatusNotFound)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: "Parent chirp not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		replyToID = sql.NullString{String: parent.ID, Valid: true}
+	}
+
 	// create chirp
 	chirp, err := cfg.dbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
 		ID:        uuid.New().String(),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
 		Body:      cleanedBody,
 		UserID:    userIDString,
+		ReplyToID: replyToID,
 	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -254,26 +404,27 @@ func (cfg *APIConfig) HandleCreateChirp(w http.ResponseWriter, r *http.Request)
 		w.Write(jsonResponse)
 		return
 	}
+	cfg.publishChirpEvent(r.Context(), events.ChirpCreated, chirp)
 
 	// return valid chirp response
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
-	fullChirp, _ := json.Marshal(CompleteChirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
+	fullChirp, _ := json.Marshal(newCompleteChirp(chirp))
 	w.Write(fullChirp)
 }
 
 func (cfg *APIConfig) HandleUpdateChirp(w http.ResponseWriter, r *http.Request) {
 	type ValidChirpRequest struct {
-		ID   string `json:"id"`
 		Body string `json:"body"`
 	}
 
+	userID, err := cfg.scopedUserID(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	id := r.PathValue("id")
+
 	// validate content type
 	postBody := &ValidChirpRequest{}
 	if r.Header.Get("Content-Type") != "application/json" {
@@ -318,7 +469,10 @@ func (cfg *APIConfig) HandleUpdateChirp(w http.ResponseWriter, r *http.Request)
 	cleanedBody := cleanChirpBody(postBody.Body)
 
 	// check if chirp exists
-	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), postBody.ID)
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), id)
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			w.WriteHeader(http.StatusNotFound)
@@ -334,12 +488,29 @@ func (cfg *APIConfig) HandleUpdateChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// update chirp
-	chirp, err = cfg.dbQueries.UpdateChirp(r.Context(), database.UpdateChirpParams{
-		ID:        postBody.ID,
-		Body:      cleanedBody,
-		UpdatedAt: time.Now(),
+	if chirp.UserID != userID.String() {
+		w.WriteHeader(http.StatusForbidden)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: "You are not authorized to update this chirp"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	// update chirp, keeping the previous body in its edit history
+	chirp, err = cfg.dbQueries.UpdateChirpWithRevision(r.Context(), database.UpdateChirpWithRevisionParams{
+		ID:         id,
+		RevisionID: uuid.New().String(),
+		UpdatedAt:  time.Now().UTC(),
+		Body:       cleanedBody,
 	})
+	if err == sql.ErrNoRows {
+		// deleted since we looked it up
+		w.WriteHeader(http.StatusNotFound)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: "Chirp not found"})
+		w.Write(jsonResponse)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
@@ -347,36 +518,27 @@ func (cfg *APIConfig) HandleUpdateChirp(w http.ResponseWriter, r *http.Request)
 		w.Write(jsonResponse)
 		return
 	}
+	cfg.publishChirpEvent(r.Context(), events.ChirpUpdated, chirp)
 
 	// return updated chirp
+	completeChirp := newCompleteChirp(chirp)
+	if err := cfg.loadChirpCounts(r.Context(), cfg.viewerID(r), &completeChirp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error loading chirp counts: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
-	fullChirp, _ := json.Marshal(CompleteChirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
+	fullChirp, _ := json.Marshal(completeChirp)
 	w.Write(fullChirp)
 }
 
 func (cfg *APIConfig) HandleDeleteChirp(w http.ResponseWriter, r *http.Request) {
-	bearerToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(jwtError{Error: err.Error()})
-		w.Write(jsonResponse)
-		return
-	}
-
-	userID, err := auth.ValidateJWT(bearerToken, cfg.tokenSecret)
+	userID, err := cfg.scopedUserID(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(jwtError{Error: err.Error()})
-		w.Write(jsonResponse)
+		writeAuthError(w, err)
 		return
 	}
 	if userID == uuid.Nil {
@@ -392,6 +554,9 @@ func (cfg *APIConfig) HandleDeleteChirp(w http.ResponseWriter, r *http.Request)
 	id := strings.TrimSpace(strings.Split(path, "/")[len(strings.Split(path, "/"))-1])
 	// fmt.Println("id:", id)
 	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), id)
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			w.WriteHeader(http.StatusNotFound)
@@ -415,9 +580,7 @@ func (cfg *APIConfig) HandleDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// delete chirp
-	err = cfg.dbQueries.DeleteChirp(r.Context(), id)
-	if err != nil {
+	if err := cfg.removeChirp(r.Context(), chirp); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
 		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error deleting chirp: %v", err)})
@@ -488,3 +651,21 @@ func (cfg *APIConfig) ValidateChirpRequest(w http.ResponseWriter, r *http.Reques
 	validatedChirp, _ := json.Marshal(ValidatedChirpResponse{Body: cleanedBody})
 	w.Write(validatedChirp)
 }
+
+// removeChirp deletes a chirp, leaving a tombstone in its place if it has
+// replies so the rest of the thread is not orphaned
+func (cfg *APIConfig) removeChirp(ctx context.Context, chirp database.Chirp) error {
+	deleted, err := cfg.dbQueries.DeleteChirpIfNoReplies(ctx, chirp.ID)
+	if err == nil && deleted == 0 {
+		_, err = cfg.dbQueries.TombstoneChirp(ctx, database.TombstoneChirpParams{
+			ID:        chirp.ID,
+			DeletedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+			UpdatedAt: time.Now().UTC(),
+		})
+	}
+	if err != nil {
+		return err
+	}
+	cfg.publishChirpEvent(ctx, events.ChirpDeleted, chirp)
+	return nil
+}
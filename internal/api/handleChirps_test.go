@@ -1,8 +1,15 @@
 package api
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
 )
 
 func TestSortChirpsByCreatedAt(t *testing.T) {
@@ -120,3 +127,273 @@ func TestSortChirpsByCreatedAt(t *testing.T) {
 		})
 	}
 }
+
+func TestParseChirpTimeRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantSince time.Time
+		wantUntil time.Time
+		wantErr   bool
+	}{
+		{
+			name:      "unbounded",
+			query:     "",
+			wantSince: chirpCursorMinTime,
+			wantUntil: chirpCursorMaxTime,
+		},
+		{
+			name:      "since only",
+			query:     "since=2024-01-01T00:00:00Z",
+			wantSince: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			wantUntil: chirpCursorMaxTime,
+		},
+		{
+			name:      "both bounds with offset",
+			query:     "since=2024-01-01T00:00:00Z&until=2024-01-02T02:00:00%2B02:00",
+			wantSince: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			wantUntil: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "since after until",
+			query:   "since=2024-02-01T00:00:00Z&until=2024-01-01T00:00:00Z",
+			wantErr: true,
+		},
+		{
+			name:    "not a timestamp",
+			query:   "until=yesterday",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			since, until, err := parseChirpTimeRange(query)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !since.Equal(tt.wantSince) {
+				t.Errorf("Expected since %v, got %v", tt.wantSince, since)
+			}
+			if !until.Equal(tt.wantUntil) {
+				t.Errorf("Expected until %v, got %v", tt.wantUntil, until)
+			}
+		})
+	}
+}
+
+// insertTestChirp writes a chirp straight to the store so tests can control
+// created_at
+func insertTestChirp(t *testing.T, cfg *APIConfig, id, userID, body string, createdAt time.Time) {
+	t.Helper()
+	_, err := cfg.dbQueries.CreateChirp(context.Background(), database.CreateChirpParams{
+		ID:        id,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Body:      body,
+		UserID:    userID,
+	})
+	if err != nil {
+		t.Fatalf("Error inserting chirp: %v", err)
+	}
+}
+
+func TestHandleCreateChirp(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "gus@example.com", "los-pollos")
+
+	rec := serve(cfg.HandleCreateChirp, newJSONRequest(t, "POST", "/api/chirps", map[string]string{"body": "hello"}))
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{
+		"body": strings.Repeat("a", 141),
+	}), user.Token))
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{
+		"body": "what a kerfuffle today",
+	}), user.Token))
+	expectStatus(t, rec, http.StatusCreated)
+	chirp := decodeResponse[CompleteChirp](t, rec)
+	if chirp.Body != "what a **** today" || chirp.UserID != user.ID {
+		t.Fatalf("Unexpected chirp: %+v", chirp)
+	}
+
+	rec = serve(cfg.HandleGetChirpByID, httptest.NewRequest("GET", "/api/chirps/"+chirp.ID, nil))
+	expectStatus(t, rec, http.StatusOK)
+	if got := decodeResponse[CompleteChirp](t, rec); got.ID != chirp.ID {
+		t.Fatalf("Expected chirp %s, got %s", chirp.ID, got.ID)
+	}
+
+	rec = serve(cfg.HandleGetChirpByID, httptest.NewRequest("GET", "/api/chirps/missing", nil))
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestHandleGetAllChirpsPagination(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com", "password")
+	bob := createTestUser(t, cfg, "bob@example.com", "password")
+
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	insertTestChirp(t, cfg, "c1", alice.ID, "one", base)
+	insertTestChirp(t, cfg, "c2", bob.ID, "two", base.Add(time.Minute))
+	// c3 and c4 share a timestamp so the id breaks the tie
+	insertTestChirp(t, cfg, "c3", alice.ID, "three", base.Add(2*time.Minute))
+	insertTestChirp(t, cfg, "c4", alice.ID, "four", base.Add(2*time.Minute))
+	insertTestChirp(t, cfg, "c5", bob.ID, "five", base.Add(3*time.Minute))
+
+	collect := func(query string) []string {
+		t.Helper()
+		ids := []string{}
+		after := ""
+		for pages := 0; pages < 10; pages++ {
+			target := "/api/chirps?" + query
+			if after != "" {
+				target += "&after=" + after
+			}
+			rec := serve(cfg.HandleGetAllChirps, httptest.NewRequest("GET", target, nil))
+			expectStatus(t, rec, http.StatusOK)
+			page := decodeResponse[ChirpPage](t, rec)
+			for _, chirp := range page.Chirps {
+				ids = append(ids, chirp.ID)
+			}
+			if page.NextCursor == "" {
+				return ids
+			}
+			after = page.NextCursor
+		}
+		t.Fatalf("Pagination did not terminate for %q", query)
+		return nil
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "limit=2", want: []string{"c1", "c2", "c3", "c4", "c5"}},
+		{query: "limit=2&sort=desc", want: []string{"c5", "c4", "c3", "c2", "c1"}},
+		{query: "limit=1&author_id=" + alice.ID, want: []string{"c1", "c3", "c4"}},
+		{query: "limit=2&sort=desc&author_id=" + bob.ID, want: []string{"c5", "c2"}},
+		{query: "since=2024-01-01T00:01:00Z&until=2024-01-01T00:03:00Z", want: []string{"c2", "c3", "c4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := collect(tt.query)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	rec := serve(cfg.HandleGetAllChirps, httptest.NewRequest("GET", "/api/chirps?after=garbage", nil))
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+// withLocalZone runs the rest of the test as if the server's time zone were
+// zone, since TIMESTAMP columns store whatever wall clock they are given
+func withLocalZone(t *testing.T, zone *time.Location) {
+	t.Helper()
+	local := time.Local
+	time.Local = zone
+	t.Cleanup(func() { time.Local = local })
+}
+
+func TestHandleGetAllChirpsTimeRangeOffUTC(t *testing.T) {
+	withLocalZone(t, time.FixedZone("UTC-7", -7*60*60))
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "saul@example.com", "its-all-good")
+	rec := serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{
+		"body": "better call",
+	}), user.Token))
+	expectStatus(t, rec, http.StatusCreated)
+	chirp := decodeResponse[CompleteChirp](t, rec)
+
+	// a range given in a third zone still finds the chirp
+	zone := time.FixedZone("UTC+5", 5*60*60)
+	now := time.Now().In(zone)
+	query := url.Values{
+		"since": {now.Add(-time.Minute).Format(time.RFC3339)},
+		"until": {now.Add(time.Minute).Format(time.RFC3339)},
+	}
+	rec = serve(cfg.HandleGetAllChirps, httptest.NewRequest("GET", "/api/chirps?"+query.Encode(), nil))
+	expectStatus(t, rec, http.StatusOK)
+	page := decodeResponse[ChirpPage](t, rec)
+	if len(page.Chirps) != 1 || page.Chirps[0].ID != chirp.ID {
+		t.Fatalf("Expected chirp %s in the range, got %+v", chirp.ID, page.Chirps)
+	}
+	if !page.Chirps[0].CreatedAt.Equal(chirp.CreatedAt) || chirp.CreatedAt.Before(now.Add(-time.Minute)) {
+		t.Fatalf("Expected the chirp to be stored at the time it was made, got %v", chirp.CreatedAt)
+	}
+}
+
+func TestHandleUpdateChirp(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "mike@example.com", "half-measures")
+	other := createTestUser(t, cfg, "gus@example.com", "los-pollos")
+	insertTestChirp(t, cfg, "c1", user.ID, "before", time.Now())
+
+	update := func(id, token string) *httptest.ResponseRecorder {
+		req := newJSONRequest(t, "PUT", "/api/chirps/"+id, map[string]string{"body": "after"})
+		if token != "" {
+			req = withBearer(req, token)
+		}
+		req.SetPathValue("id", id)
+		return serve(cfg.HandleUpdateChirp, req)
+	}
+
+	expectStatus(t, update("c1", ""), http.StatusUnauthorized)
+	expectStatus(t, update("missing", user.Token), http.StatusNotFound)
+	expectStatus(t, update("c1", other.Token), http.StatusForbidden)
+
+	rec := update("c1", user.Token)
+	expectStatus(t, rec, http.StatusOK)
+	if chirp := decodeResponse[CompleteChirp](t, rec); chirp.Body != "after" {
+		t.Fatalf("Expected updated body, got %q", chirp.Body)
+	}
+}
+
+func TestHandleDeleteChirp(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	owner := createTestUser(t, cfg, "owner@example.com", "password")
+	other := createTestUser(t, cfg, "other@example.com", "password")
+	insertTestChirp(t, cfg, "c1", owner.ID, "mine", time.Now())
+
+	rec := serve(cfg.HandleDeleteChirp, httptest.NewRequest("DELETE", "/api/chirps/c1", nil))
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = serve(cfg.HandleDeleteChirp, withBearer(httptest.NewRequest("DELETE", "/api/chirps/c1", nil), other.Token))
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = serve(cfg.HandleDeleteChirp, withBearer(httptest.NewRequest("DELETE", "/api/chirps/missing", nil), owner.Token))
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(cfg.HandleDeleteChirp, withBearer(httptest.NewRequest("DELETE", "/api/chirps/c1", nil), owner.Token))
+	expectStatus(t, rec, http.StatusNoContent)
+
+	rec = serve(cfg.HandleGetChirpByID, httptest.NewRequest("GET", "/api/chirps/c1", nil))
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestValidateChirpRequest(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+
+	rec := serve(cfg.ValidateChirpRequest, newJSONRequest(t, "POST", "/api/validate_chirp", map[string]string{
+		"body": "Sharbert is great",
+	}))
+	expectStatus(t, rec, http.StatusOK)
+	if got := decodeResponse[ValidatedChirpResponse](t, rec); got.Body != "**** is great" {
+		t.Fatalf("Expected cleaned body, got %q", got.Body)
+	}
+
+	rec = serve(cfg.ValidateChirpRequest, newJSONRequest(t, "POST", "/api/validate_chirp", map[string]string{
+		"body": strings.Repeat("a", 141),
+	}))
+	expectStatus(t, rec, http.StatusBadRequest)
+}
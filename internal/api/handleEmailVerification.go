@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/mail"
+)
+
+// emailVerificationTokenTTL is how long a verification link works for
+const emailVerificationTokenTTL = 24 * time.Hour
+
+// sendEmailVerification emails a link that proves the user owns email, which
+// is either their current address or one they want to change to. only the
+// latest link works, so an old link can't switch the email back after a later
+// change. a failure to send is logged rather than returned, since the user
+// can ask for another link.
+func (cfg *APIConfig) sendEmailVerification(ctx context.Context, user database.User, email string) error {
+	err := cfg.dbQueries.DeleteEmailVerificationTokensByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	_, err = cfg.dbQueries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(emailVerificationTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the page at verify-email/index.html posts the token to HandleVerifyEmail
+	link := fmt.Sprintf("%s/app/verify-email/?token=%s", cfg.baseURL, url.QueryEscape(token))
+	err = cfg.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your email address for Chirpy",
+		Body: fmt.Sprintf("Follow this link within the next %d hours to confirm that this is your email address:\n\n%s\n\n"+
+			"If you didn't sign up for Chirpy or change your email, you can ignore this email.\n",
+			int(emailVerificationTokenTTL.Hours()), link),
+	})
+	if err != nil {
+		log.Printf("error sending verification email to user %s: %v", user.ID, err)
+	}
+	return nil
+}
+
+// emailTakenByOther reports whether a user other than userID has the email
+func (cfg *APIConfig) emailTakenByOther(ctx context.Context, email, userID string) (bool, error) {
+	users, err := cfg.dbQueries.GetUsersByEmail(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	for _, user := range users {
+		if user.ID != userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HandleVerifyEmail confirms an address with the token from a verification
+// email. when the address is one the user asked to change to, this is the
+// point the change happens.
+func (cfg *APIConfig) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type verifyEmailParams struct {
+		Token string `json:"token"`
+	}
+
+	params, err := deriveResponseJson[verifyEmailParams](w, r)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	verification, err := cfg.dbQueries.ConsumeEmailVerificationToken(r.Context(), database.ConsumeEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(params.Token),
+		UsedAt:    sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid or expired verification token"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	// someone may have signed up with the address since the link was sent
+	taken, err := cfg.emailTakenByOther(r.Context(), verification.Email, verification.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if taken {
+		w.WriteHeader(http.StatusConflict)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: "Email is already in use"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	previous, err := cfg.dbQueries.GetUserByID(r.Context(), verification.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	user, err := cfg.dbQueries.SetUserVerifiedEmail(r.Context(), database.SetUserVerifiedEmailParams{
+		ID:              verification.UserID,
+		Email:           verification.Email,
+		EmailVerifiedAt: sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if previous.Email != user.Email {
+		err = cfg.recordSecurityEvent(r.Context(), user.ID, securityEventEmailChanged,
+			fmt.Sprintf("email changed from %s to %s", previous.Email, user.Email))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userResponse{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	})
+}
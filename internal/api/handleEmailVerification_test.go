@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// verificationToken returns the token from the latest email sent to address
+func verificationToken(t *testing.T, cfg *APIConfig, address string) string {
+	t.Helper()
+	messages := sentMail(t, cfg)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To == address {
+			expectAppPageLink(t, cfg, messages[i], "verify-email")
+			return tokenFromMail(t, messages[i])
+		}
+	}
+	t.Fatalf("Expected an email to %s, got %+v", address, messages)
+	return ""
+}
+
+func verifyEmail(t *testing.T, cfg *APIConfig, token string) *userResponse {
+	t.Helper()
+	rec := serve(cfg.HandleVerifyEmail, newJSONRequest(t, "POST", "/api/email/verify", map[string]string{"token": token}))
+	if rec.Code != http.StatusOK {
+		return nil
+	}
+	user := decodeResponse[userResponse](t, rec)
+	return &user
+}
+
+func changeEmail(t *testing.T, cfg *APIConfig, accessToken, email string) {
+	t.Helper()
+	rec := serve(cfg.HandleUpdateUser, withBearer(newJSONRequest(t, "PUT", "/api/users", map[string]string{"email": email}), accessToken))
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestHandleVerifyEmailOnSignup(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "marie@example.com", "purple-rain")
+	if user.EmailVerified {
+		t.Fatalf("Expected a new user to be unverified")
+	}
+
+	token := verificationToken(t, cfg, user.Email)
+	verified := verifyEmail(t, cfg, token)
+	if verified == nil || !verified.EmailVerified || verified.Email != user.Email {
+		t.Fatalf("Expected the email to be verified, got %+v", verified)
+	}
+	if again := verifyEmail(t, cfg, token); again != nil {
+		t.Fatalf("Expected the token to only work once")
+	}
+	if login := loginTestUser(t, cfg, user.Email, "purple-rain"); !login.EmailVerified {
+		t.Fatalf("Expected login to report the email as verified")
+	}
+}
+
+func TestHandleVerifyEmailOnChange(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "walt@example.com", "chemistry")
+	verifyEmail(t, cfg, verificationToken(t, cfg, user.Email))
+
+	changeEmail(t, cfg, user.Token, "heisenberg@example.com")
+	// the old address keeps working until the new one is confirmed
+	loginTestUser(t, cfg, "walt@example.com", "chemistry")
+
+	verified := verifyEmail(t, cfg, verificationToken(t, cfg, "heisenberg@example.com"))
+	if verified == nil || verified.Email != "heisenberg@example.com" || !verified.EmailVerified {
+		t.Fatalf("Expected the new email to replace the old one, got %+v", verified)
+	}
+	loginTestUser(t, cfg, "heisenberg@example.com", "chemistry")
+	rec := serve(cfg.HandleAuthenticateUser, newJSONRequest(t, "POST", "/api/login", map[string]string{
+		"email":    "walt@example.com",
+		"password": "chemistry",
+	}))
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	events, err := cfg.dbQueries.ListSecurityEventsByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error listing security events: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != securityEventEmailChanged {
+		t.Fatalf("Expected an email change event, got %+v", events)
+	}
+}
+
+func TestHandleVerifyEmailOnlyLatestLinkWorks(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "jesse@example.com", "science-yo")
+
+	changeEmail(t, cfg, user.Token, "capn.cook@example.com")
+	first := verificationToken(t, cfg, "capn.cook@example.com")
+	changeEmail(t, cfg, user.Token, "pinkman@example.com")
+
+	if verified := verifyEmail(t, cfg, first); verified != nil {
+		t.Fatalf("Expected an earlier link to stop working, got %+v", verified)
+	}
+	if verified := verifyEmail(t, cfg, verificationToken(t, cfg, "pinkman@example.com")); verified == nil || verified.Email != "pinkman@example.com" {
+		t.Fatalf("Expected the latest link to work, got %+v", verified)
+	}
+}
+
+func TestHandleUpdateUserEmailTaken(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	createTestUser(t, cfg, "gus@example.com", "chicken-man")
+	user := createTestUser(t, cfg, "mike@example.com", "parking-lot")
+
+	rec := serve(cfg.HandleUpdateUser, withBearer(newJSONRequest(t, "PUT", "/api/users", map[string]string{"email": "gus@example.com"}), user.Token))
+	expectStatus(t, rec, http.StatusConflict)
+
+	// someone signs up with an address while a change to it is pending
+	changeEmail(t, cfg, user.Token, "ehrmantraut@example.com")
+	token := verificationToken(t, cfg, "ehrmantraut@example.com")
+	createTestUser(t, cfg, "ehrmantraut@example.com", "quick-fix")
+	rec = serve(cfg.HandleVerifyEmail, newJSONRequest(t, "POST", "/api/email/verify", map[string]string{"token": token}))
+	expectStatus(t, rec, http.StatusConflict)
+}
+
+func TestHandleCreateChirpRequiresVerifiedEmail(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	cfg.requireVerifiedEmail = true
+	user := createTestUser(t, cfg, "lydia@example.com", "stevia-tea")
+
+	rec := serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{"body": "hello"}), user.Token))
+	expectStatus(t, rec, http.StatusForbidden)
+
+	verifyEmail(t, cfg, verificationToken(t, cfg, user.Email))
+	rec = serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{"body": "hello"}), user.Token))
+	expectStatus(t, rec, http.StatusCreated)
+}
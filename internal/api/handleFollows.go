@@ -0,0 +1,227 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+type FollowedUser struct {
+	UserID     string    `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type FollowPage struct {
+	Users      []FollowedUser `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+func (cfg *APIConfig) HandleFollowUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.scopedUserID(r, auth.ScopeUsersWrite)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	followeeID := r.PathValue("id")
+	if followeeID == userID.String() {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(jsonReadError{Error: "You cannot follow yourself"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	userExists, err := cfg.checkUserExists(followeeID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if !userExists {
+		w.WriteHeader(http.StatusNotFound)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(notFoundError{Error: "User not found"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	// following someone twice is a no-op
+	_, err = cfg.dbQueries.CreateFollow(r.Context(), database.CreateFollowParams{
+		FollowerID: userID.String(),
+		FolloweeID: followeeID,
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("")) // empty response body
+}
+
+func (cfg *APIConfig) HandleUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.scopedUserID(r, auth.ScopeUsersWrite)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	// unfollowing someone you don't follow is a no-op
+	_, err = cfg.dbQueries.DeleteFollow(r.Context(), database.DeleteFollowParams{
+		FollowerID: userID.String(),
+		FolloweeID: r.PathValue("id"),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("")) // empty response body
+}
+
+func (cfg *APIConfig) HandleGetFollowers(w http.ResponseWriter, r *http.Request) {
+	cfg.handleListFollows(w, r, true)
+}
+
+func (cfg *APIConfig) HandleGetFollowing(w http.ResponseWriter, r *http.Request) {
+	cfg.handleListFollows(w, r, false)
+}
+
+// handleListFollows lists who follows the user in the path (followers) or
+// who that user follows, newest first
+func (cfg *APIConfig) handleListFollows(w http.ResponseWriter, r *http.Request, followers bool) {
+	userID := r.PathValue("id")
+	limit, cursor, err := parseChirpPageParams(r.URL.Query(), "desc")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(jsonReadError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	_, err = cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(notFoundError{Error: "User not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	// fetch one extra row so we know whether there is a next page
+	params := database.ListFollowersParams{
+		UserID:          userID,
+		CursorCreatedAt: cursor.CreatedAt,
+		CursorID:        cursor.ID,
+		PageSize:        int32(limit + 1),
+	}
+	var follows []database.Follow
+	if followers {
+		follows, err = cfg.dbQueries.ListFollowers(r.Context(), params)
+	} else {
+		follows, err = cfg.dbQueries.ListFollowing(r.Context(), database.ListFollowingParams(params))
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: fmt.Sprintf("Error listing follows: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	other := func(follow database.Follow) string {
+		if followers {
+			return follow.FollowerID
+		}
+		return follow.FolloweeID
+	}
+	page := FollowPage{Users: []FollowedUser{}}
+	if len(follows) > limit {
+		follows = follows[:limit]
+		last := follows[len(follows)-1]
+		page.NextCursor = encodeChirpCursor(chirpCursor{CreatedAt: last.CreatedAt, ID: other(last)})
+	}
+	for _, follow := range follows {
+		page.Users = append(page.Users, FollowedUser{
+			UserID:     other(follow),
+			FollowedAt: follow.CreatedAt,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	responseJSON, _ := json.Marshal(page)
+	w.Write(responseJSON)
+}
+
+func (cfg *APIConfig) HandleGetTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.scopedUserID(r, auth.ScopeChirpsRead)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	limit, cursor, err := parseChirpPageParams(r.URL.Query(), "desc")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	// fetch one extra row so we know whether there is a next page
+	chirps, err := cfg.dbQueries.ListTimelineChirps(r.Context(), database.ListTimelineChirpsParams{
+		FollowerID:      userID.String(),
+		CursorCreatedAt: cursor.CreatedAt,
+		CursorID:        cursor.ID,
+		PageSize:        int32(limit + 1),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error getting timeline: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	page := newChirpPage(listedChirps(chirps), limit)
+	if err := cfg.loadChirpPageCounts(r.Context(), userID.String(), page); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error loading chirp counts: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	responseJSON, _ := json.Marshal(page)
+	w.Write(responseJSON)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func followRequest(method, userID, token string) *http.Request {
+	req := httptest.NewRequest(method, "/api/users/"+userID+"/follow", nil)
+	req.SetPathValue("id", userID)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestHandleFollowUser(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com", "password")
+	bob := createTestUser(t, cfg, "bob@example.com", "password")
+
+	expectStatus(t, serve(cfg.HandleFollowUser, followRequest("POST", bob.ID, "")), http.StatusUnauthorized)
+	expectStatus(t, serve(cfg.HandleFollowUser, followRequest("POST", alice.ID, alice.Token)), http.StatusBadRequest)
+	expectStatus(t, serve(cfg.HandleFollowUser, followRequest("POST", "missing", alice.Token)), http.StatusNotFound)
+	expectStatus(t, serve(cfg.HandleFollowUser, followRequest("POST", bob.ID, alice.Token)), http.StatusNoContent)
+	// following twice is fine
+	expectStatus(t, serve(cfg.HandleFollowUser, followRequest("POST", bob.ID, alice.Token)), http.StatusNoContent)
+
+	list := func(handler http.HandlerFunc, userID string) []string {
+		req := httptest.NewRequest("GET", "/api/users/"+userID+"/x", nil)
+		req.SetPathValue("id", userID)
+		rec := serve(handler, req)
+		expectStatus(t, rec, http.StatusOK)
+		ids := []string{}
+		for _, user := range decodeResponse[FollowPage](t, rec).Users {
+			ids = append(ids, user.UserID)
+		}
+		return ids
+	}
+	if got := list(cfg.HandleGetFollowers, bob.ID); len(got) != 1 || got[0] != alice.ID {
+		t.Fatalf("Expected bob to be followed by alice, got %v", got)
+	}
+	if got := list(cfg.HandleGetFollowing, alice.ID); len(got) != 1 || got[0] != bob.ID {
+		t.Fatalf("Expected alice to follow bob, got %v", got)
+	}
+	if got := list(cfg.HandleGetFollowers, alice.ID); len(got) != 0 {
+		t.Fatalf("Expected alice to have no followers, got %v", got)
+	}
+
+	expectStatus(t, serve(cfg.HandleUnfollowUser, followRequest("DELETE", bob.ID, alice.Token)), http.StatusNoContent)
+	if got := list(cfg.HandleGetFollowing, alice.ID); len(got) != 0 {
+		t.Fatalf("Expected alice to follow nobody, got %v", got)
+	}
+}
+
+func TestHandleGetTimeline(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com", "password")
+	bob := createTestUser(t, cfg, "bob@example.com", "password")
+	carol := createTestUser(t, cfg, "carol@example.com", "password")
+
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	insertTestChirp(t, cfg, "b1", bob.ID, "bob one", base)
+	insertTestChirp(t, cfg, "c1", carol.ID, "carol one", base.Add(time.Minute))
+	insertTestChirp(t, cfg, "a1", alice.ID, "alice one", base.Add(2*time.Minute))
+	insertTestChirp(t, cfg, "b2", bob.ID, "bob two", base.Add(3*time.Minute))
+
+	expectStatus(t, serve(cfg.HandleGetTimeline, httptest.NewRequest("GET", "/api/timeline", nil)), http.StatusUnauthorized)
+
+	timeline := func(query string) ChirpPage {
+		rec := serve(cfg.HandleGetTimeline, withBearer(httptest.NewRequest("GET", "/api/timeline?"+query, nil), alice.Token))
+		expectStatus(t, rec, http.StatusOK)
+		return decodeResponse[ChirpPage](t, rec)
+	}
+	if page := timeline(""); len(page.Chirps) != 0 {
+		t.Fatalf("Expected empty timeline before following anyone, got %+v", page.Chirps)
+	}
+
+	expectStatus(t, serve(cfg.HandleFollowUser, followRequest("POST", bob.ID, alice.Token)), http.StatusNoContent)
+	expectStatus(t, serve(cfg.HandleFollowUser, followRequest("POST", carol.ID, alice.Token)), http.StatusNoContent)
+
+	ids := []string{}
+	page := timeline("limit=2")
+	for _, chirp := range page.Chirps {
+		ids = append(ids, chirp.ID)
+	}
+	page = timeline("limit=2&after=" + page.NextCursor)
+	for _, chirp := range page.Chirps {
+		ids = append(ids, chirp.ID)
+	}
+	if got := strings.Join(ids, ","); got != "b2,c1,b1" || page.NextCursor != "" {
+		t.Fatalf("Expected b2,c1,b1 newest first, got %s (next %q)", got, page.NextCursor)
+	}
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HandleJWKS publishes the public keys access tokens are signed with, so
+// other services can verify them without holding a secret
+func (cfg *APIConfig) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	jsonResponse, _ := json.Marshal(cfg.tokenKeys.JWKS())
+	w.Header().Set("Content-Type", "application/json")
+	// short enough that a newly scheduled key is picked up well before it
+	// starts signing
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+)
+
+func TestHandleJWKS(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	cfg.tokenKeys, err = auth.NewKeyring(auth.NewEd25519Key("2025", private))
+	if err != nil {
+		t.Fatalf("Error making keyring: %v", err)
+	}
+
+	rec := serve(cfg.HandleJWKS, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	expectStatus(t, rec, http.StatusOK)
+	jwks := decodeResponse[auth.JWKS](t, rec)
+	if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "2025" {
+		t.Fatalf("Expected one published key, got %+v", jwks)
+	}
+
+	// another service can verify our tokens with nothing but the JWKS
+	user := createTestUser(t, cfg, "verifier@example.com", "password")
+	published, err := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+	if err != nil || !public.Equal(ed25519.PublicKey(published)) {
+		t.Fatalf("Expected the published key to be our public key")
+	}
+	claims := jwt.RegisteredClaims{}
+	_, err = jwt.ParseWithClaims(user.Token, &claims, func(token *jwt.Token) (any, error) {
+		return ed25519.PublicKey(published), nil
+	}, jwt.WithValidMethods([]string{jwks.Keys[0].Algorithm}), jwt.WithIssuer(auth.Issuer))
+	if err != nil || claims.Subject != user.ID {
+		t.Fatalf("Expected the token to verify with the published key: %v", err)
+	}
+}
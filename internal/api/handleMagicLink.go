@@ -0,0 +1,272 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/lockout"
+	"github.com/landanqrew/go-serve-intro/internal/mail"
+)
+
+// magicLinkTokenTTL is how long a login link works for
+const magicLinkTokenTTL = 15 * time.Minute
+
+// loadMagicLinkLimiter builds the limiter on login links sent to one address,
+// so the endpoint can't be used to flood someone's inbox. an address gets a
+// link every 30 seconds and MAGIC_LINK_RATE_LIMIT of them an hour.
+func loadMagicLinkLimiter(store database.Store) (*lockout.Limiter, error) {
+	tracker, err := loadAttemptTracker(store)
+	if err != nil {
+		return nil, err
+	}
+	policy := lockout.Policy{
+		BackoffAfter:     1,
+		BaseDelay:        30 * time.Second,
+		MaxDelay:         30 * time.Second,
+		LockoutThreshold: 5,
+		LockoutDuration:  time.Hour,
+		Window:           time.Hour,
+	}
+	if err := envInt("MAGIC_LINK_RATE_LIMIT", &policy.LockoutThreshold); err != nil {
+		return nil, err
+	}
+	return lockout.NewLimiter(tracker, policy), nil
+}
+
+// magicLinkKey is prefixed to keep it apart from login keys in a shared
+// tracker
+func magicLinkKey(email string) string {
+	return "magic:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// HandleRequestMagicLink emails a login link to the address if it belongs to a
+// user. like HandleForgotPassword it answers 202 either way, and the rate
+// limit counts unknown addresses too, so neither tells which emails have
+// accounts.
+func (cfg *APIConfig) HandleRequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	type requestMagicLinkParams struct {
+		Email string `json:"email"`
+	}
+
+	params, err := deriveResponseJson[requestMagicLinkParams](w, r)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	key := magicLinkKey(params.Email)
+	wait, err := cfg.magicLinkLimiter.RetryAfter(r.Context(), key, now)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if wait > 0 {
+		writeTooManyRequests(w, wait, "Too many login links requested")
+		return
+	}
+	if _, err := cfg.magicLinkLimiter.Fail(r.Context(), key, now); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	users, err := cfg.dbQueries.GetUsersByEmail(r.Context(), params.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if len(users) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	user := users[0]
+
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(hashError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	// the link isn't signed; it doesn't need to be. the token is 256 random
+	// bits that can't be guessed, and its expiry and single use are enforced
+	// by its row rather than carried in the link. only the hash is stored, so
+	// a leaked table can't be used to log in.
+	_, err = cfg.dbQueries.CreateMagicLinkToken(r.Context(), database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(magicLinkTokenTTL),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	// the link opens the page at magic-login/index.html, which calls
+	// HandleConfirmMagicLinkLogin when the user clicks. linking to the api
+	// directly would let mail scanners that open links use it up.
+	link := fmt.Sprintf("%s/app/magic-login/?token=%s", cfg.baseURL, url.QueryEscape(token))
+	err = cfg.mailer.Send(r.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf("Follow this link within the next %d minutes to log in to Chirpy:\n\n%s\n\n"+
+			"The link works once. If you didn't ask for it, you can ignore this email.\n",
+			int(magicLinkTokenTTL.Minutes()), link),
+	})
+	if err != nil {
+		// failing here would tell the caller the account exists
+		log.Printf("error sending login link to user %s: %v", user.ID, err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleMagicLinkLogin logs in with the token from a HandleRequestMagicLink
+// email, answering with tokens the way HandleAuthenticateUser does. it never
+// sets cookies: another site could link a browser here to log it in to an
+// account of the attacker's choosing, so cookie logins go through
+// HandleConfirmMagicLinkLogin instead.
+func (cfg *APIConfig) HandleMagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	expiresInSeconds := 0
+	if value := query.Get("expires_in_seconds"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(jsonReadError{Error: "Invalid expires_in_seconds"})
+			w.Write(jsonResponse)
+			return
+		}
+		expiresInSeconds = n
+	}
+	cfg.magicLinkLogin(w, r, query.Get("token"), expiresInSeconds, false)
+}
+
+// HandleConfirmMagicLinkLogin logs in with a login link token sent in the
+// body, and is the only way to have the session set as cookies. it needs the
+// double-submit CSRF pair like other cookie requests; before it has a session
+// the app makes up the CSRF cookie itself, and logging in replaces it.
+func (cfg *APIConfig) HandleConfirmMagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	type confirmMagicLinkParams struct {
+		Token            string `json:"token"`
+		ExpiresInSeconds int    `json:"expires_in_seconds,omitempty"`
+		UseCookies       bool   `json:"use_cookies,omitempty"`
+	}
+
+	if err := auth.CheckCSRF(r); err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	params, err := deriveResponseJson[confirmMagicLinkParams](w, r)
+	if err != nil {
+		return
+	}
+	cfg.magicLinkLogin(w, r, params.Token, params.ExpiresInSeconds, params.UseCookies)
+}
+
+// magicLinkLogin uses up the login link token and logs its user in. the token
+// is used up in the same statement that checks it, so it logs in once however
+// many times it is presented.
+func (cfg *APIConfig) magicLinkLogin(w http.ResponseWriter, r *http.Request, token string, expiresInSeconds int, useCookies bool) {
+	accessTTL := cfg.tokenLifetimes.accessTTL(expiresInSeconds)
+
+	now := time.Now().UTC()
+	magicLink, err := cfg.dbQueries.ConsumeMagicLinkToken(r.Context(), database.ConsumeMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UsedAt:    sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid or expired login link"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), magicLink.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	// a link sent to an address the account no longer has shouldn't log in
+	if user.Email != magicLink.Email {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid or expired login link"})
+		w.Write(jsonResponse)
+		return
+	}
+	// following the link proves the address is theirs
+	if !user.EmailVerifiedAt.Valid {
+		user, err = cfg.dbQueries.SetUserVerifiedEmail(r.Context(), database.SetUserVerifiedEmailParams{
+			ID:              user.ID,
+			Email:           user.Email,
+			EmailVerifiedAt: sql.NullTime{Time: now, Valid: true},
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+	}
+	// any other links that were sent are no longer needed
+	err = cfg.dbQueries.DeleteMagicLinkTokensByUserID(r.Context(), user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	twoFactor, err := cfg.twoFactorEnabled(r.Context(), user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if twoFactor {
+		// the link stands in for the password, not for the second factor
+		cfg.writeTwoFactorChallenge(w, r, user, int(accessTTL/time.Second))
+		return
+	}
+	cfg.writeLoginResponse(w, r, user, accessTTL, useCookies)
+}
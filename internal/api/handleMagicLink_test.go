@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/lockout"
+)
+
+// requestMagicLink asks for a login email and returns the token in it
+func requestMagicLink(t *testing.T, cfg *APIConfig, email string) string {
+	t.Helper()
+	before := len(sentMail(t, cfg))
+	rec := serve(cfg.HandleRequestMagicLink, newJSONRequest(t, "POST", "/api/login/magic", map[string]string{"email": email}))
+	expectStatus(t, rec, http.StatusAccepted)
+	messages := sentMail(t, cfg)
+	if len(messages) != before+1 || messages[len(messages)-1].To != email {
+		t.Fatalf("Expected one login email to %s, got %+v", email, messages[before:])
+	}
+	expectAppPageLink(t, cfg, messages[len(messages)-1], "magic-login")
+	return tokenFromMail(t, messages[len(messages)-1])
+}
+
+func magicLinkLogin(cfg *APIConfig, token, extra string) *httptest.ResponseRecorder {
+	target := "/api/login/magic/verify?token=" + url.QueryEscape(token) + extra
+	return serve(cfg.HandleMagicLinkLogin, httptest.NewRequest("GET", target, nil))
+}
+
+// unlimitedMagicLinks lets a test ask for links back to back
+func unlimitedMagicLinks(cfg *APIConfig) {
+	cfg.magicLinkLimiter = lockout.NewLimiter(lockout.NewMemoryTracker(), lockout.Policy{})
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "jesse@example.com", "yeah-science")
+	token := requestMagicLink(t, cfg, user.Email)
+
+	rec := magicLinkLogin(cfg, token, "")
+	expectStatus(t, rec, http.StatusOK)
+	login := decodeResponse[userResponse](t, rec)
+	if login.ID != user.ID || login.Token == "" || login.RefreshToken == "" {
+		t.Fatalf("Expected tokens for %s, got %s", user.ID, rec.Body.String())
+	}
+	// following the link proves the address
+	if !login.EmailVerified {
+		t.Fatalf("Expected the email to be verified by the link")
+	}
+	rec = serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), login.RefreshToken))
+	expectStatus(t, rec, http.StatusOK)
+
+	// the link only works once
+	expectStatus(t, magicLinkLogin(cfg, token, ""), http.StatusUnauthorized)
+	expectStatus(t, magicLinkLogin(cfg, "made-up", ""), http.StatusUnauthorized)
+	expectStatus(t, magicLinkLogin(cfg, token, "&expires_in_seconds=soon"), http.StatusBadRequest)
+}
+
+func TestMagicLinkLoginUsesUpOtherLinks(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	unlimitedMagicLinks(cfg)
+	user := createTestUser(t, cfg, "skinny@example.com", "pete-piano")
+	first := requestMagicLink(t, cfg, user.Email)
+	second := requestMagicLink(t, cfg, user.Email)
+
+	expectStatus(t, magicLinkLogin(cfg, second, ""), http.StatusOK)
+	expectStatus(t, magicLinkLogin(cfg, first, ""), http.StatusUnauthorized)
+}
+
+func TestMagicLinkLoginAfterEmailChange(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "badger@example.com", "star-trek")
+	token := requestMagicLink(t, cfg, user.Email)
+
+	_, err := cfg.dbQueries.SetUserVerifiedEmail(context.Background(), database.SetUserVerifiedEmailParams{
+		ID:              user.ID,
+		Email:           "brandon@example.com",
+		EmailVerifiedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("Error changing email: %v", err)
+	}
+	expectStatus(t, magicLinkLogin(cfg, token, ""), http.StatusUnauthorized)
+}
+
+func TestMagicLinkLoginCookies(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	unlimitedMagicLinks(cfg)
+	createTestUser(t, cfg, "jane@example.com", "apartment-2")
+
+	// following a link never sets cookies, so another site can't log the
+	// browser in by linking to it
+	token := requestMagicLink(t, cfg, "jane@example.com")
+	rec := magicLinkLogin(cfg, token, "&use_cookies=true")
+	expectStatus(t, rec, http.StatusOK)
+	if login := decodeResponse[userResponse](t, rec); login.Token == "" || login.RefreshToken == "" {
+		t.Fatalf("Expected a token pair in the body, got %s", rec.Body.String())
+	}
+	if cookies := responseCookies(rec); len(cookies) != 0 {
+		t.Fatalf("Expected no cookies, got %+v", cookies)
+	}
+
+	confirm := func(token string, csrfCookie, csrfHeader string) *httptest.ResponseRecorder {
+		req := newJSONRequest(t, "POST", "/api/login/magic/verify", map[string]any{
+			"token":       token,
+			"use_cookies": true,
+		})
+		cookies := map[string]*http.Cookie{}
+		if csrfCookie != "" {
+			cookies[auth.CSRFCookie] = &http.Cookie{Name: auth.CSRFCookie, Value: csrfCookie}
+		}
+		return serve(cfg.HandleConfirmMagicLinkLogin, withCookies(req, cookies, csrfHeader))
+	}
+	// the confirmation needs the CSRF cookie and a matching header, and a
+	// refused one leaves the link working
+	token = requestMagicLink(t, cfg, "jane@example.com")
+	expectStatus(t, confirm(token, "", ""), http.StatusForbidden)
+	expectStatus(t, confirm(token, "made-up-by-the-app", "something-else"), http.StatusForbidden)
+
+	rec = confirm(token, "made-up-by-the-app", "made-up-by-the-app")
+	expectStatus(t, rec, http.StatusOK)
+	login := decodeResponse[userResponse](t, rec)
+	if login.Token != "" || login.RefreshToken != "" || login.CSRFToken == "" {
+		t.Fatalf("Expected only a CSRF token in the body, got %s", rec.Body.String())
+	}
+	cookies := responseCookies(rec)
+	if cookies[auth.AccessTokenCookie] == nil || cookies[auth.RefreshTokenCookie] == nil {
+		t.Fatalf("Expected session cookies, got %+v", cookies)
+	}
+	if c := cookies[auth.CSRFCookie]; c == nil || c.Value != login.CSRFToken {
+		t.Fatalf("Expected the login to replace the CSRF cookie, got %+v", c)
+	}
+}
+
+func TestMagicLinkLoginTwoFactor(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "tuco@example.com", "tight-tight")
+	secret, _, _ := enableTwoFactor(t, cfg, user.Token)
+	token := requestMagicLink(t, cfg, user.Email)
+
+	rec := magicLinkLogin(cfg, token, "")
+	expectStatus(t, rec, http.StatusOK)
+	challenge := decodeResponse[twoFactorChallengeResponse](t, rec)
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("Expected a two-factor challenge, got %s", rec.Body.String())
+	}
+	if code := finishTwoFactorLogin(t, cfg, challenge.ChallengeToken, totpCode(t, secret, 1)); code != http.StatusOK {
+		t.Fatalf("Expected the challenge to finish the login, got %d", code)
+	}
+}
+
+func TestRequestMagicLinkRateLimit(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	createTestUser(t, cfg, "marie@example.com", "minerals")
+	requestMagicLink(t, cfg, "marie@example.com")
+	sent := len(sentMail(t, cfg))
+
+	// too soon after the last link, whatever the case of the address
+	rec := serve(cfg.HandleRequestMagicLink, newJSONRequest(t, "POST", "/api/login/magic", map[string]string{"email": "Marie@example.com"}))
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected a Retry-After header")
+	}
+
+	// unknown addresses are limited the same way, so the limit doesn't give
+	// away which have accounts
+	for _, want := range []int{http.StatusAccepted, http.StatusTooManyRequests} {
+		rec = serve(cfg.HandleRequestMagicLink, newJSONRequest(t, "POST", "/api/login/magic", map[string]string{"email": "nobody@example.com"}))
+		expectStatus(t, rec, want)
+	}
+	if messages := sentMail(t, cfg); len(messages) != sent {
+		t.Fatalf("Expected no more email, got %+v", messages[sent:])
+	}
+}
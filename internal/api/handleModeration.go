@@ -0,0 +1,161 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+// HandleModeratorDeleteChirp removes any user's chirp. it is served behind
+// MiddlewareRequireRole, so the caller is known to be a moderator.
+func (cfg *APIConfig) HandleModeratorDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	moderatorID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), r.PathValue("id"))
+	if err == nil && chirp.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(ChirpError{Error: "Chirp not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error getting chirp by id: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+
+	if err := cfg.removeChirp(r.Context(), chirp); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(ChirpError{Error: fmt.Sprintf("Error deleting chirp: %v", err)})
+		w.Write(jsonResponse)
+		return
+	}
+	err = cfg.recordSecurityEvent(r.Context(), chirp.UserID, securityEventChirpModerated,
+		fmt.Sprintf("chirp %s removed by moderator %s", chirp.ID, moderatorID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleUpdateUserRole sets another user's role. it is served behind
+// MiddlewareRequireRole, so the caller is known to be an admin.
+func (cfg *APIConfig) HandleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	type updateUserRoleParams struct {
+		Role string `json:"role"`
+	}
+
+	adminID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	params, err := deriveResponseJson[updateUserRoleParams](w, r)
+	if err != nil {
+		return
+	}
+	if !auth.ValidRole(params.Role) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(jsonReadError{Error: fmt.Sprintf("Unknown role %q", params.Role)})
+		w.Write(jsonResponse)
+		return
+	}
+	userID := r.PathValue("id")
+	if userID == adminID.String() {
+		// stops the last admin from locking everyone out by accident
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(jsonReadError{Error: "You cannot change your own role"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	user, err := cfg.dbQueries.UpdateUserRole(r.Context(), database.UpdateUserRoleParams{
+		ID:        userID,
+		Role:      params.Role,
+		UpdatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(notFoundError{Error: "User not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	err = cfg.recordSecurityEvent(r.Context(), user.ID, securityEventRoleChanged,
+		fmt.Sprintf("role set to %s by admin %s", user.Role, adminID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userResponse{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	})
+}
+
+// HandleAdminReset resets the metrics and deletes every user but the admin
+// making the request, so there is still someone who can use /admin
+// afterwards. it is served behind MiddlewareRequireRole, so the caller is
+// known to be an admin.
+func (cfg *APIConfig) HandleAdminReset(w http.ResponseWriter, r *http.Request) {
+	adminID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	if err := cfg.dbQueries.DeleteUsersExcept(r.Context(), adminID.String()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	cfg.ResetFileserverHits()
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("OK"))
+}
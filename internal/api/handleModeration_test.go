@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+)
+
+func TestHandleModeratorDeleteChirp(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	author := createTestUser(t, cfg, "author@example.com", "password")
+	moderator := createTestUserWithRole(t, cfg, "moderator@example.com", auth.RoleModerator)
+	insertTestChirp(t, cfg, "c1", author.ID, "against the rules", time.Now())
+
+	remove := func(id string) *httptest.ResponseRecorder {
+		req := withBearer(httptest.NewRequest("DELETE", "/admin/chirps/"+id, nil), moderator.Token)
+		req.SetPathValue("id", id)
+		return serve(cfg.HandleModeratorDeleteChirp, req)
+	}
+	expectStatus(t, remove("missing"), http.StatusNotFound)
+	expectStatus(t, remove("c1"), http.StatusNoContent)
+	expectStatus(t, remove("c1"), http.StatusNotFound)
+
+	events, err := cfg.dbQueries.ListSecurityEventsByUserID(context.Background(), author.ID)
+	if err != nil {
+		t.Fatalf("Error listing security events: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != securityEventChirpModerated {
+		t.Fatalf("Expected the author to be told about the removal, got %+v", events)
+	}
+}
+
+func TestHandleUpdateUserRole(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	admin := createTestUserWithRole(t, cfg, "admin@example.com", auth.RoleAdmin)
+	user := createTestUser(t, cfg, "user@example.com", "password")
+
+	update := func(id, role string) *httptest.ResponseRecorder {
+		req := withBearer(newJSONRequest(t, "PUT", "/admin/users/"+id+"/role", map[string]string{"role": role}), admin.Token)
+		req.SetPathValue("id", id)
+		return serve(cfg.HandleUpdateUserRole, req)
+	}
+	expectStatus(t, update(user.ID, "superuser"), http.StatusBadRequest)
+	expectStatus(t, update("missing", auth.RoleModerator), http.StatusNotFound)
+	expectStatus(t, update(admin.ID, auth.RoleUser), http.StatusBadRequest)
+
+	rec := update(user.ID, auth.RoleModerator)
+	expectStatus(t, rec, http.StatusOK)
+	if updated := decodeResponse[userResponse](t, rec); updated.Role != auth.RoleModerator {
+		t.Fatalf("Expected moderator, got %q", updated.Role)
+	}
+	if relogged := loginTestUser(t, cfg, "user@example.com", "password"); relogged.Role != auth.RoleModerator {
+		t.Fatalf("Expected the new role on login, got %q", relogged.Role)
+	}
+}
+
+func TestHandleAdminResetKeepsCaller(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	admin := createTestUserWithRole(t, cfg, "admin@example.com", auth.RoleAdmin)
+	user := createTestUser(t, cfg, "user@example.com", "password")
+
+	rec := serve(cfg.HandleAdminReset, withBearer(httptest.NewRequest("POST", "/admin/reset", nil), admin.Token))
+	expectStatus(t, rec, http.StatusOK)
+
+	if _, err := cfg.dbQueries.GetUserByID(context.Background(), user.ID); err == nil {
+		t.Fatalf("Expected other users to be deleted")
+	}
+	// the admin can still reach /admin
+	handler := cfg.MiddlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(cfg.HandleAdminReset))
+	expectStatus(t, serve(handler.ServeHTTP, withBearer(httptest.NewRequest("POST", "/admin/reset", nil), admin.Token)), http.StatusOK)
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/oidc"
+)
+
+const (
+	// oidcLoginCookie carries the state, PKCE verifier and nonce of a login
+	// from the start endpoint to the callback, tying the callback to the
+	// browser that started it
+	oidcLoginCookie = "chirpy_oidc_login"
+	// oidcLoginTTL is how long the user has to get through the provider
+	oidcLoginTTL = 10 * time.Minute
+	// securityEventIdentityLinked is recorded when a provider account is
+	// linked to an existing user by its email
+	securityEventIdentityLinked = "identity_linked"
+)
+
+var (
+	oidcProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+	// errIdentityNoEmail and errIdentityEmailTaken are why a provider login
+	// can't be matched to a user
+	errIdentityNoEmail    = errors.New("The provider did not share an email address")
+	errIdentityEmailTaken = errors.New("An account with this email exists but the address isn't verified on both sides, so it can't be linked. Log in with your password and verify your email first")
+)
+
+// loadOIDCProviders reads the providers named in OIDC_PROVIDERS, a comma
+// separated list such as "google,okta". each is configured by
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and
+// optionally OIDC_<NAME>_SCOPES, with the name upper cased and dashes made
+// underscores.
+func loadOIDCProviders(baseURL string) (map[string]*oidc.Provider, error) {
+	providers := map[string]*oidc.Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !oidcProviderName.MatchString(name) {
+			return nil, fmt.Errorf("invalid OIDC provider name %q, use lower case letters, digits and dashes", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/api/auth/" + name + "/callback",
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID must be set for OIDC provider %q", prefix, prefix, name)
+		}
+		providers[name] = oidc.NewProvider(config)
+	}
+	return providers, nil
+}
+
+// oidcProvider returns the provider named in the path, writing a 404 when
+// there isn't one
+func (cfg *APIConfig) oidcProvider(w http.ResponseWriter, r *http.Request) (string, *oidc.Provider, bool) {
+	name := r.PathValue("provider")
+	provider, ok := cfg.oidcProviders[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(notFoundError{Error: "Unknown login provider"})
+		w.Write(jsonResponse)
+		return "", nil, false
+	}
+	return name, provider, true
+}
+
+func oidcLoginCookiePath(name string) string {
+	return "/api/auth/" + name + "/callback"
+}
+
+// HandleOIDCStart sends the browser to the provider to log in
+func (cfg *APIConfig) HandleOIDCStart(w http.ResponseWriter, r *http.Request) {
+	name, provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(hashError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		values[i] = value
+	}
+	state, codeVerifier, nonce := values[0], values[1], values[2]
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, oidc.CodeChallenge(codeVerifier))
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(unauthorizedError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	// SameSite=Lax rather than Strict, because the browser arrives at the
+	// callback from the provider's site
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookie,
+		Value:    strings.Join(values[:], "."),
+		Path:     oidcLoginCookiePath(name),
+		MaxAge:   int(oidcLoginTTL / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleOIDCCallback finishes a provider login. the browser gets session
+// cookies and is sent to the app, or to the app's two-factor step when the
+// user has two-factor enabled.
+func (cfg *APIConfig) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	name, provider, ok := cfg.oidcProvider(w, r)
+	if !ok {
+		return
+	}
+
+	// the cookie is for one attempt, whatever happens
+	var state, codeVerifier, nonce string
+	if c, err := r.Cookie(oidcLoginCookie); err == nil {
+		if parts := strings.Split(c.Value, "."); len(parts) == 3 {
+			state, codeVerifier, nonce = parts[0], parts[1], parts[2]
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcLoginCookie,
+		Path:     oidcLoginCookiePath(name),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Login refused by provider: " + providerError})
+		w.Write(jsonResponse)
+		return
+	}
+	// the state has to match the one this browser was sent off with, so
+	// nobody can log a victim in to the attacker's account
+	if state == "" || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(jsonReadError{Error: "Invalid or expired login state"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	idToken, err := provider.Exchange(r.Context(), query.Get("code"), codeVerifier, nonce)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(unauthorizedError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	user, err := cfg.userForIdentity(r.Context(), name, idToken)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, errIdentityNoEmail):
+			status = http.StatusBadRequest
+		case errors.Is(err, errIdentityEmailTaken):
+			status = http.StatusConflict
+		}
+		w.WriteHeader(status)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	twoFactor, err := cfg.twoFactorEnabled(r.Context(), user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if twoFactor {
+		// the provider stands in for the password only. the challenge goes in
+		// the fragment, which browsers don't send to servers or in referers,
+		// for the page at two-factor/index.html to finish the login with
+		token, _, err := cfg.createTwoFactorChallenge(r.Context(), user, int(cfg.tokenLifetimes.Access/time.Second))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		http.Redirect(w, r, cfg.baseURL+"/app/two-factor/#two_factor_challenge="+url.QueryEscape(token), http.StatusSeeOther)
+		return
+	}
+
+	tokens, err := cfg.startSession(r, user, cfg.tokenLifetimes.Access)
+	if err == nil {
+		_, err = setSessionCookies(w, r, tokens.AccessToken, tokens.AccessExpiresAt, tokens.RefreshToken, tokens.RefreshExpiresAt)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(refreshTokenError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	http.Redirect(w, r, cfg.baseURL+"/app/", http.StatusSeeOther)
+}
+
+// userForIdentity finds the user a provider login belongs to. a known
+// identity logs in its user. otherwise it is linked to the user with the same
+// email, but only when both the provider and we have verified that email, or
+// else a new user is made for it.
+func (cfg *APIConfig) userForIdentity(ctx context.Context, provider string, token *oidc.IDToken) (database.User, error) {
+	now := time.Now().UTC()
+	email := strings.TrimSpace(token.Email)
+	identity, err := cfg.dbQueries.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  token.Subject,
+	})
+	if err == nil {
+		err = cfg.dbQueries.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+			ID:          identity.ID,
+			Email:       email,
+			LastLoginAt: now,
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+		return cfg.dbQueries.GetUserByID(ctx, identity.UserID)
+	}
+	if err != sql.ErrNoRows {
+		return database.User{}, err
+	}
+
+	if email == "" {
+		return database.User{}, errIdentityNoEmail
+	}
+	users, err := cfg.dbQueries.GetUsersByEmail(ctx, email)
+	if err != nil && err != sql.ErrNoRows {
+		return database.User{}, err
+	}
+
+	var user database.User
+	if len(users) > 0 {
+		// linking on an address nobody has proven would let whoever signed
+		// up with it first into the other's account
+		user = users[0]
+		if !token.EmailVerified || !user.EmailVerifiedAt.Valid {
+			return database.User{}, errIdentityEmailTaken
+		}
+		err = cfg.recordSecurityEvent(ctx, user.ID, securityEventIdentityLinked, fmt.Sprintf("linked a %s account", provider))
+		if err != nil {
+			return database.User{}, err
+		}
+	} else {
+		user, err = cfg.createPasswordlessUser(ctx, email, token.EmailVerified)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+
+	_, err = cfg.dbQueries.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Provider:  provider,
+		Subject:   token.Subject,
+		Email:     email,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, nil
+}
+
+// createPasswordlessUser signs up a user who logs in some other way. the
+// password hash is of a random secret nobody knows, so password login stays
+// shut until they set one through a password reset.
+func (cfg *APIConfig) createPasswordlessUser(ctx context.Context, email string, emailVerified bool) (database.User, error) {
+	secret, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	hashedPassword, err := cfg.hashPassword(secret)
+	if err != nil {
+		return database.User{}, err
+	}
+	now := time.Now().UTC()
+	user, err := cfg.dbQueries.CreateUser(ctx, database.CreateUserParams{
+		ID:             uuid.New().String(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Email:          email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	if emailVerified {
+		return cfg.dbQueries.SetUserVerifiedEmail(ctx, database.SetUserVerifiedEmailParams{
+			ID:              user.ID,
+			Email:           email,
+			EmailVerifiedAt: sql.NullTime{Time: now, Valid: true},
+		})
+	}
+	// the account is usable straight away, as with a password signup
+	if err := cfg.sendEmailVerification(ctx, user, user.Email); err != nil {
+		log.Printf("error starting email verification for user %s: %v", user.ID, err)
+	}
+	return user, nil
+}
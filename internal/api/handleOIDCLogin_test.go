@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/oidc/oidctest"
+)
+
+// newOIDCTestConfig configures a provider named "test" backed by a stand-in
+// provider
+func newOIDCTestConfig(t *testing.T) (*APIConfig, *oidctest.Server) {
+	t.Helper()
+	server := oidctest.NewServer(t)
+	t.Setenv("OIDC_PROVIDERS", "test")
+	t.Setenv("OIDC_TEST_ISSUER", server.Issuer())
+	t.Setenv("OIDC_TEST_CLIENT_ID", server.ClientID)
+	t.Setenv("OIDC_TEST_CLIENT_SECRET", server.ClientSecret)
+	return newTestAPIConfig(t), server
+}
+
+// providerCallback starts a login and follows the provider back to the
+// callback, returning the callback request with the browser's login cookie
+func providerCallback(t *testing.T, cfg *APIConfig) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/auth/test/start", nil)
+	req.SetPathValue("provider", "test")
+	rec := serve(cfg.HandleOIDCStart, req)
+	expectStatus(t, rec, http.StatusFound)
+	cookies := responseCookies(rec)
+	if c := cookies[oidcLoginCookie]; c == nil || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode || c.Path != "/api/auth/test/callback" {
+		t.Fatalf("Expected a login cookie for the callback, got %+v", c)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Error following the provider: %v", err)
+	}
+	res.Body.Close()
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || location.Path != "/api/auth/test/callback" {
+		t.Fatalf("Expected the provider to send us back to the callback, got %d %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	callback := httptest.NewRequest("GET", location.RequestURI(), nil)
+	callback.SetPathValue("provider", "test")
+	callback.AddCookie(&http.Cookie{Name: oidcLoginCookie, Value: cookies[oidcLoginCookie].Value})
+	return callback
+}
+
+// providerLogin logs in through the provider and returns the id of the user
+// the session is for
+func providerLogin(t *testing.T, cfg *APIConfig) string {
+	t.Helper()
+	rec := serve(cfg.HandleOIDCCallback, providerCallback(t, cfg))
+	expectStatus(t, rec, http.StatusSeeOther)
+	if location := rec.Header().Get("Location"); location != cfg.baseURL+"/app/" {
+		t.Fatalf("Expected to be sent to the app, got %q", location)
+	}
+	access := responseCookies(rec)[auth.AccessTokenCookie]
+	if access == nil {
+		t.Fatalf("Expected session cookies, got %+v", rec.Result().Cookies())
+	}
+	userID, err := auth.ValidateJWT(access.Value, cfg.tokenKeys)
+	if err != nil {
+		t.Fatalf("Error validating access token: %v", err)
+	}
+	return userID.String()
+}
+
+func TestOIDCLoginSignsUp(t *testing.T) {
+	cfg, server := newOIDCTestConfig(t)
+	server.SetUser(oidctest.User{Subject: "hector-1", Email: "hector@example.com", EmailVerified: true})
+
+	userID := providerLogin(t, cfg)
+	user, err := cfg.dbQueries.GetUserByID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("Error getting user: %v", err)
+	}
+	if user.Email != "hector@example.com" || !user.EmailVerifiedAt.Valid {
+		t.Fatalf("Expected a user with the provider's verified email, got %+v", user)
+	}
+	// there is no password to log in with
+	rec := serve(cfg.HandleAuthenticateUser, newJSONRequest(t, "POST", "/api/login", map[string]string{
+		"email":    "hector@example.com",
+		"password": "hector-password",
+	}))
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	// the identity is matched by subject even after the email changes
+	server.SetUser(oidctest.User{Subject: "hector-1", Email: "tio@example.com", EmailVerified: true})
+	if again := providerLogin(t, cfg); again != userID {
+		t.Fatalf("Expected the same user on the next login, got %s and %s", userID, again)
+	}
+}
+
+func TestOIDCLoginLinksVerifiedEmail(t *testing.T) {
+	cfg, server := newOIDCTestConfig(t)
+	user := createTestUser(t, cfg, "lalo@example.com", "salamanca")
+	server.SetUser(oidctest.User{Subject: "lalo-1", Email: "lalo@example.com", EmailVerified: true})
+
+	// not verified here yet, so it could be anyone's account
+	rec := serve(cfg.HandleOIDCCallback, providerCallback(t, cfg))
+	expectStatus(t, rec, http.StatusConflict)
+
+	_, err := cfg.dbQueries.SetUserVerifiedEmail(context.Background(), database.SetUserVerifiedEmailParams{
+		ID:              user.ID,
+		Email:           user.Email,
+		EmailVerifiedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("Error verifying email: %v", err)
+	}
+	// nor when the provider hasn't verified it
+	server.SetUser(oidctest.User{Subject: "lalo-1", Email: "lalo@example.com", EmailVerified: false})
+	rec = serve(cfg.HandleOIDCCallback, providerCallback(t, cfg))
+	expectStatus(t, rec, http.StatusConflict)
+
+	server.SetUser(oidctest.User{Subject: "lalo-1", Email: "lalo@example.com", EmailVerified: true})
+	if linked := providerLogin(t, cfg); linked != user.ID {
+		t.Fatalf("Expected the provider login to link to %s, got %s", user.ID, linked)
+	}
+	events, err := cfg.dbQueries.ListSecurityEventsByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error listing security events: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != securityEventIdentityLinked {
+		t.Fatalf("Expected an identity linked event, got %+v", events)
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	cfg, _ := newOIDCTestConfig(t)
+
+	// without the cookie from the start endpoint
+	callback := providerCallback(t, cfg)
+	bare := httptest.NewRequest("GET", callback.URL.RequestURI(), nil)
+	bare.SetPathValue("provider", "test")
+	expectStatus(t, serve(cfg.HandleOIDCCallback, bare), http.StatusBadRequest)
+
+	// with another login's state
+	other := providerCallback(t, cfg)
+	mixed := httptest.NewRequest("GET", other.URL.RequestURI(), nil)
+	mixed.SetPathValue("provider", "test")
+	c, _ := callback.Cookie(oidcLoginCookie)
+	mixed.AddCookie(c)
+	expectStatus(t, serve(cfg.HandleOIDCCallback, mixed), http.StatusBadRequest)
+
+	// codes work once
+	expectStatus(t, serve(cfg.HandleOIDCCallback, other), http.StatusSeeOther)
+	replay := httptest.NewRequest("GET", other.URL.RequestURI(), nil)
+	replay.SetPathValue("provider", "test")
+	c, _ = other.Cookie(oidcLoginCookie)
+	replay.AddCookie(c)
+	expectStatus(t, serve(cfg.HandleOIDCCallback, replay), http.StatusUnauthorized)
+
+	unknown := httptest.NewRequest("GET", "/api/auth/nope/start", nil)
+	unknown.SetPathValue("provider", "nope")
+	expectStatus(t, serve(cfg.HandleOIDCStart, unknown), http.StatusNotFound)
+}
+
+func TestOIDCLoginTwoFactor(t *testing.T) {
+	cfg, server := newOIDCTestConfig(t)
+	server.SetUser(oidctest.User{Subject: "gus-1", Email: "gus@example.com", EmailVerified: true})
+	userID := providerLogin(t, cfg)
+	user, err := cfg.dbQueries.GetUserByID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("Error getting user: %v", err)
+	}
+	accessToken, err := auth.MakeJWT(uuid.MustParse(user.ID), user.Role, cfg.tokenKeys, time.Hour)
+	if err != nil {
+		t.Fatalf("Error making token: %v", err)
+	}
+	secret, _, _ := enableTwoFactor(t, cfg, accessToken)
+
+	rec := serve(cfg.HandleOIDCCallback, providerCallback(t, cfg))
+	expectStatus(t, rec, http.StatusSeeOther)
+	location := rec.Header().Get("Location")
+	prefix := cfg.baseURL + "/app/two-factor/#two_factor_challenge="
+	if !strings.HasPrefix(location, prefix) || len(responseCookies(rec)) != 1 {
+		t.Fatalf("Expected a two-factor challenge and no session, got %q %+v", location, rec.Result().Cookies())
+	}
+	if _, err := os.Stat(filepath.Join("..", "..", "two-factor", "index.html")); err != nil {
+		t.Fatalf("Expected the two-factor page to exist: %v", err)
+	}
+	challenge, _ := url.QueryUnescape(strings.TrimPrefix(location, prefix))
+	if code := finishTwoFactorLogin(t, cfg, challenge, totpCode(t, secret, 1)); code != http.StatusOK {
+		t.Fatalf("Expected the challenge to finish the login, got %d", code)
+	}
+}
+
+func TestLoadOIDCProviders(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "")
+	if providers, err := loadOIDCProviders("http://localhost:8080"); err != nil || len(providers) != 0 {
+		t.Fatalf("Expected no providers, got %v %v", providers, err)
+	}
+	t.Setenv("OIDC_PROVIDERS", "Bad Name")
+	if _, err := loadOIDCProviders("http://localhost:8080"); err == nil {
+		t.Fatalf("Expected an invalid name to be refused")
+	}
+	t.Setenv("OIDC_PROVIDERS", "my-idp")
+	t.Setenv("OIDC_MY_IDP_ISSUER", "")
+	if _, err := loadOIDCProviders("http://localhost:8080"); err == nil {
+		t.Fatalf("Expected a provider without an issuer to be refused")
+	}
+	t.Setenv("OIDC_MY_IDP_ISSUER", "https://idp.example.com")
+	t.Setenv("OIDC_MY_IDP_CLIENT_ID", "chirpy")
+	if providers, err := loadOIDCProviders("http://localhost:8080"); err != nil || providers["my-idp"] == nil {
+		t.Fatalf("Expected the provider to load, got %v %v", providers, err)
+	}
+}
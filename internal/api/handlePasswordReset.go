@@ -0,0 +1,197 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/mail"
+)
+
+// passwordResetTokenTTL is how long a reset link works for
+const passwordResetTokenTTL = time.Hour
+
+// HandleForgotPassword emails a reset link to the address if it belongs to a
+// user. it answers 202 either way so that it can't be used to find out which
+// emails have accounts.
+func (cfg *APIConfig) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type forgotPasswordParams struct {
+		Email string `json:"email"`
+	}
+
+	params, err := deriveResponseJson[forgotPasswordParams](w, r)
+	if err != nil {
+		return
+	}
+
+	users, err := cfg.dbQueries.GetUsersByEmail(r.Context(), params.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if len(users) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	user := users[0]
+
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(hashError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	now := time.Now().UTC()
+	// only the hash is stored, so a leaked table can't be used to reset
+	// anyone's password
+	_, err = cfg.dbQueries.CreatePasswordResetToken(r.Context(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	// the page at reset-password/index.html asks for the new password and
+	// posts it with the token to HandleResetPassword
+	link := fmt.Sprintf("%s/app/reset-password/?token=%s", cfg.baseURL, url.QueryEscape(token))
+	err = cfg.mailer.Send(r.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Follow this link within the next %d minutes to choose a new one:\n\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.\n",
+			int(passwordResetTokenTTL.Minutes()), link),
+	})
+	if err != nil {
+		// failing here would tell the caller the account exists
+		log.Printf("error sending password reset email to user %s: %v", user.ID, err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleResetPassword sets a new password using a token from
+// HandleForgotPassword. every session is logged out, since whoever else might
+// have had the old password could have logged in with it.
+func (cfg *APIConfig) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	type resetPasswordParams struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	params, err := deriveResponseJson[resetPasswordParams](w, r)
+	if err != nil {
+		return
+	}
+	if params.Password == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(jsonReadError{Error: "Password is required"})
+		w.Write(jsonResponse)
+		return
+	}
+	if !cfg.checkPasswordPolicy(w, params.Password) {
+		return
+	}
+
+	// hash before using up the token so that a failure here doesn't cost the
+	// user their link
+	hashedPassword, err := cfg.hashPassword(params.Password)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(hashError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	now := time.Now().UTC()
+	resetToken, err := cfg.dbQueries.ConsumePasswordResetToken(r.Context(), database.ConsumePasswordResetTokenParams{
+		TokenHash: auth.HashToken(params.Token),
+		UsedAt:    sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid or expired reset token"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), resetToken.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	_, err = cfg.dbQueries.UpdateUserPasswordByEmail(r.Context(), database.UpdateUserPasswordByEmailParams{
+		Email:          user.Email,
+		HashedPassword: hashedPassword,
+		UpdatedAt:      now,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	_, err = cfg.dbQueries.RevokeAllRefreshTokensByUserID(r.Context(), database.RevokeAllRefreshTokensByUserIDParams{
+		UserID:    user.ID,
+		RevokedAt: sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	// any other links that were sent are no longer needed
+	err = cfg.dbQueries.DeletePasswordResetTokensByUserID(r.Context(), user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	err = cfg.recordSecurityEvent(r.Context(), user.ID, securityEventPasswordReset,
+		"password reset with an emailed token; all sessions revoked")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/mail"
+)
+
+// sentMail returns everything the config's outbox mailer has sent
+func sentMail(t *testing.T, cfg *APIConfig) []mail.Message {
+	t.Helper()
+	outbox, ok := cfg.mailer.(*mail.OutboxMailer)
+	if !ok {
+		t.Fatalf("Expected an outbox mailer, got %T", cfg.mailer)
+	}
+	messages, err := outbox.Messages()
+	if err != nil {
+		t.Fatalf("Error reading outbox: %v", err)
+	}
+	return messages
+}
+
+var linkTokenPattern = regexp.MustCompile(`https?://\S+[?&]token=([^\s&]+)`)
+
+// tokenFromMail pulls the token out of the link in an email
+func tokenFromMail(t *testing.T, msg mail.Message) string {
+	t.Helper()
+	match := linkTokenPattern.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("Expected a link with a token in %q", msg.Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatalf("Error unescaping token: %v", err)
+	}
+	return token
+}
+
+// expectAppPageLink checks that msg links to the app page that handles its
+// token, and that the page is there for /app/ to serve from the repo root
+func expectAppPageLink(t *testing.T, cfg *APIConfig, msg mail.Message, page string) {
+	t.Helper()
+	if !strings.Contains(msg.Body, cfg.baseURL+"/app/"+page+"/?token=") {
+		t.Fatalf("Expected a link to the %s page, got %q", page, msg.Body)
+	}
+	if _, err := os.Stat(filepath.Join("..", "..", page, "index.html")); err != nil {
+		t.Fatalf("Expected the %s page to exist: %v", page, err)
+	}
+}
+
+// requestPasswordReset asks for a reset email and returns the token in it
+func requestPasswordReset(t *testing.T, cfg *APIConfig, email string) string {
+	t.Helper()
+	before := len(sentMail(t, cfg))
+	rec := serve(cfg.HandleForgotPassword, newJSONRequest(t, "POST", "/api/password/forgot", map[string]string{"email": email}))
+	expectStatus(t, rec, http.StatusAccepted)
+	messages := sentMail(t, cfg)
+	if len(messages) != before+1 || messages[len(messages)-1].To != email {
+		t.Fatalf("Expected one reset email to %s, got %+v", email, messages[before:])
+	}
+	expectAppPageLink(t, cfg, messages[len(messages)-1], "reset-password")
+	return tokenFromMail(t, messages[len(messages)-1])
+}
+
+func TestHandleResetPassword(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "forgetful@example.com", "old-password")
+
+	token := requestPasswordReset(t, cfg, user.Email)
+	rec := serve(cfg.HandleResetPassword, newJSONRequest(t, "POST", "/api/password/reset", map[string]string{
+		"token":    token,
+		"password": "new-password",
+	}))
+	expectStatus(t, rec, http.StatusNoContent)
+
+	loginTestUser(t, cfg, user.Email, "new-password")
+	rec = serve(cfg.HandleAuthenticateUser, newJSONRequest(t, "POST", "/api/login", map[string]string{
+		"email":    user.Email,
+		"password": "old-password",
+	}))
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	// sessions from before the reset are logged out
+	rec = serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	// the token only works once
+	rec = serve(cfg.HandleResetPassword, newJSONRequest(t, "POST", "/api/password/reset", map[string]string{
+		"token":    token,
+		"password": "another-password",
+	}))
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	events, err := cfg.dbQueries.ListSecurityEventsByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error listing security events: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != securityEventPasswordReset {
+		t.Fatalf("Expected a password reset event, got %+v", events)
+	}
+}
+
+func TestHandleForgotPasswordUnknownEmail(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	rec := serve(cfg.HandleForgotPassword, newJSONRequest(t, "POST", "/api/password/forgot", map[string]string{"email": "nobody@example.com"}))
+	expectStatus(t, rec, http.StatusAccepted)
+	if messages := sentMail(t, cfg); len(messages) != 0 {
+		t.Fatalf("Expected no email, got %+v", messages)
+	}
+}
+
+func TestHandleResetPasswordStoresOnlyTheHash(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "hashed@example.com", "old-password")
+	token := requestPasswordReset(t, cfg, user.Email)
+
+	// the raw token isn't a key in the table, its hash is
+	_, err := cfg.dbQueries.ConsumePasswordResetToken(context.Background(), database.ConsumePasswordResetTokenParams{
+		TokenHash: token,
+		UsedAt:    sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err == nil {
+		t.Fatalf("Expected the raw token not to be stored")
+	}
+	_, err = cfg.dbQueries.ConsumePasswordResetToken(context.Background(), database.ConsumePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UsedAt:    sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("Expected the hashed token to be stored: %v", err)
+	}
+}
+
+func TestHandleResetPasswordExpiredToken(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "slow@example.com", "old-password")
+
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		t.Fatalf("Error making token: %v", err)
+	}
+	created := time.Now().UTC().Add(-2 * passwordResetTokenTTL)
+	_, err = cfg.dbQueries.CreatePasswordResetToken(context.Background(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		CreatedAt: created,
+		ExpiresAt: created.Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		t.Fatalf("Error creating reset token: %v", err)
+	}
+
+	rec := serve(cfg.HandleResetPassword, newJSONRequest(t, "POST", "/api/password/reset", map[string]string{
+		"token":    token,
+		"password": "new-password",
+	}))
+	expectStatus(t, rec, http.StatusBadRequest)
+	loginTestUser(t, cfg, user.Email, "old-password")
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+// personalAccessTokenNameMaxLength matches the name column
+const personalAccessTokenNameMaxLength = 100
+
+// PersonalAccessToken describes a token without revealing it. Token is only
+// filled in when the token is created.
+type PersonalAccessToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func newPersonalAccessToken(token database.PersonalAccessToken) PersonalAccessToken {
+	response := PersonalAccessToken{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    auth.ParseScopes(token.Scopes),
+		CreatedAt: token.CreatedAt,
+	}
+	if token.ExpiresAt.Valid {
+		response.ExpiresAt = &token.ExpiresAt.Time
+	}
+	if token.LastUsedAt.Valid {
+		response.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return response
+}
+
+// HandleCreatePersonalAccessToken makes a named token with the requested
+// scopes. it needs a login, so one token can't be used to mint another with
+// more access.
+func (cfg *APIConfig) HandleCreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	type createTokenParams struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		// ExpiresInSeconds is optional; without it the token lasts until it
+		// is revoked
+		ExpiresInSeconds int `json:"expires_in_seconds,omitempty"`
+	}
+
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	params, err := deriveResponseJson[createTokenParams](w, r)
+	if err != nil {
+		return
+	}
+	var invalid string
+	switch {
+	case params.Name == "":
+		invalid = "Name is required"
+	case len(params.Name) > personalAccessTokenNameMaxLength:
+		invalid = fmt.Sprintf("Name must be at most %d characters", personalAccessTokenNameMaxLength)
+	case len(params.Scopes) == 0:
+		invalid = "At least one scope is required"
+	case params.ExpiresInSeconds < 0:
+		invalid = "expires_in_seconds must be positive"
+	}
+	for _, scope := range params.Scopes {
+		if invalid == "" && !auth.ValidScope(scope) {
+			invalid = fmt.Sprintf("Unknown scope %q", scope)
+		}
+	}
+	if invalid != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(jsonReadError{Error: invalid})
+		w.Write(jsonResponse)
+		return
+	}
+
+	secret, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(hashError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	now := time.Now().UTC()
+	var expiresAt sql.NullTime
+	if params.ExpiresInSeconds > 0 {
+		expiresAt = sql.NullTime{Time: now.Add(time.Duration(params.ExpiresInSeconds) * time.Second), Valid: true}
+	}
+	token, err := cfg.dbQueries.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		ID:        uuid.New().String(),
+		UserID:    userID.String(),
+		Name:      params.Name,
+		TokenHash: auth.HashToken(secret),
+		Scopes:    auth.FormatScopes(params.Scopes),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	response := newPersonalAccessToken(token)
+	response.Token = secret
+	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("Content-Type", "application/json")
+	jsonResponse, _ := json.Marshal(response)
+	w.Write(jsonResponse)
+}
+
+// HandleListPersonalAccessTokens returns the caller's tokens, newest first
+func (cfg *APIConfig) HandleListPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	tokens, err := cfg.dbQueries.ListPersonalAccessTokensByUserID(r.Context(), userID.String())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	response := make([]PersonalAccessToken, 0, len(tokens))
+	for _, token := range tokens {
+		response = append(response, newPersonalAccessToken(token))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	jsonResponse, _ := json.Marshal(response)
+	w.Write(jsonResponse)
+}
+
+// HandleRevokePersonalAccessToken deletes one of the caller's tokens. it stops
+// working straight away.
+func (cfg *APIConfig) HandleRevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	deleted, err := cfg.dbQueries.DeletePersonalAccessToken(r.Context(), database.DeletePersonalAccessTokenParams{
+		ID:     r.PathValue("id"),
+		UserID: userID.String(),
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(notFoundError{Error: "Token not found"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
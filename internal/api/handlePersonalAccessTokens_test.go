@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+func createPersonalAccessToken(t *testing.T, cfg *APIConfig, accessToken string, body map[string]any) PersonalAccessToken {
+	t.Helper()
+	rec := serve(cfg.HandleCreatePersonalAccessToken, withBearer(newJSONRequest(t, "POST", "/api/tokens", body), accessToken))
+	expectStatus(t, rec, http.StatusCreated)
+	token := decodeResponse[PersonalAccessToken](t, rec)
+	if !auth.IsPersonalAccessToken(token.Token) {
+		t.Fatalf("Expected the new token in the response, got %+v", token)
+	}
+	return token
+}
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "badger@example.com", "star-trek-pitch")
+	readOnly := createPersonalAccessToken(t, cfg, user.Token, map[string]any{
+		"name":   "reader bot",
+		"scopes": []string{auth.ScopeChirpsRead},
+	})
+	writer := createPersonalAccessToken(t, cfg, user.Token, map[string]any{
+		"name":   "poster bot",
+		"scopes": []string{auth.ScopeChirpsWrite, auth.ScopeChirpsRead, auth.ScopeChirpsWrite},
+	})
+	if len(writer.Scopes) != 2 {
+		t.Fatalf("Expected duplicate scopes to be dropped, got %v", writer.Scopes)
+	}
+
+	post := func(token string) int {
+		req := withBearer(newJSONRequest(t, "POST", "/api/chirps", map[string]string{"body": "from a script"}), token)
+		return serve(cfg.HandleCreateChirp, req).Code
+	}
+	if code := post(readOnly.Token); code != http.StatusForbidden {
+		t.Fatalf("Expected a read only token to be refused, got %d", code)
+	}
+	if code := post(writer.Token); code != http.StatusCreated {
+		t.Fatalf("Expected a write token to post, got %d", code)
+	}
+	rec := serve(cfg.HandleGetTimeline, withBearer(newJSONRequest(t, "GET", "/api/timeline", nil), readOnly.Token))
+	expectStatus(t, rec, http.StatusOK)
+
+	// tokens can't manage the account, whatever their scopes
+	follower := createPersonalAccessToken(t, cfg, user.Token, map[string]any{
+		"name":   "follow bot",
+		"scopes": []string{auth.ScopeUsersWrite},
+	})
+	rec = serve(cfg.HandleUpdateUser, withBearer(newJSONRequest(t, "PUT", "/api/users", map[string]string{"password": "stolen-by-a-bot"}), follower.Token))
+	expectStatus(t, rec, http.StatusUnauthorized)
+	rec = serve(cfg.HandleCreatePersonalAccessToken, withBearer(newJSONRequest(t, "POST", "/api/tokens", map[string]any{
+		"name":   "escalated",
+		"scopes": []string{auth.ScopeUsersWrite},
+	}), writer.Token))
+	expectStatus(t, rec, http.StatusUnauthorized)
+	rec = serve(cfg.HandleListSessions, withBearer(newJSONRequest(t, "GET", "/api/sessions", nil), writer.Token))
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = serve(cfg.HandleListPersonalAccessTokens, withBearer(newJSONRequest(t, "GET", "/api/tokens", nil), user.Token))
+	expectStatus(t, rec, http.StatusOK)
+	listed := decodeResponse[[]PersonalAccessToken](t, rec)
+	if len(listed) != 3 {
+		t.Fatalf("Expected three tokens, got %+v", listed)
+	}
+	for _, token := range listed {
+		if token.Token != "" {
+			t.Fatalf("Expected tokens to be listed without their secrets, got %+v", token)
+		}
+		if token.ID == writer.ID && token.LastUsedAt == nil {
+			t.Fatalf("Expected last_used_at to be recorded, got %+v", token)
+		}
+	}
+}
+
+func TestPersonalAccessTokenStoredHashed(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "skinny.pete@example.com", "keyboard-solo")
+	token := createPersonalAccessToken(t, cfg, user.Token, map[string]any{
+		"name":   "ci",
+		"scopes": []string{auth.ScopeChirpsRead},
+	})
+	stored, err := cfg.dbQueries.ListPersonalAccessTokensByUserID(context.Background(), user.ID)
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("Expected one stored token, got %v %v", stored, err)
+	}
+	if stored[0].TokenHash == token.Token || stored[0].TokenHash != auth.HashToken(token.Token) {
+		t.Fatalf("Expected only the digest to be stored")
+	}
+}
+
+func TestPersonalAccessTokenExpiryAndRevoke(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "combo@example.com", "corner-store")
+	token := createPersonalAccessToken(t, cfg, user.Token, map[string]any{
+		"name":               "short lived",
+		"scopes":             []string{auth.ScopeChirpsRead},
+		"expires_in_seconds": 60,
+	})
+	if token.ExpiresAt == nil {
+		t.Fatalf("Expected an expiry, got %+v", token)
+	}
+	timeline := func(secret string) int {
+		return serve(cfg.HandleGetTimeline, withBearer(newJSONRequest(t, "GET", "/api/timeline", nil), secret)).Code
+	}
+	if code := timeline(token.Token); code != http.StatusOK {
+		t.Fatalf("Expected the token to work, got %d", code)
+	}
+
+	// one that has already run out
+	expired, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("Error making token: %v", err)
+	}
+	_, err = cfg.dbQueries.CreatePersonalAccessToken(context.Background(), database.CreatePersonalAccessTokenParams{
+		ID:        "expired-token",
+		UserID:    user.ID,
+		Name:      "old",
+		TokenHash: auth.HashToken(expired),
+		Scopes:    auth.ScopeChirpsRead,
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("Error storing token: %v", err)
+	}
+	if code := timeline(expired); code != http.StatusUnauthorized {
+		t.Fatalf("Expected an expired token to be refused, got %d", code)
+	}
+
+	other := createTestUser(t, cfg, "jane@example.com", "apartment-two")
+	revoke := func(accessToken, id string) int {
+		req := withBearer(newJSONRequest(t, "DELETE", "/api/tokens/"+id, nil), accessToken)
+		req.SetPathValue("id", id)
+		return serve(cfg.HandleRevokePersonalAccessToken, req).Code
+	}
+	if code := revoke(other.Token, token.ID); code != http.StatusNotFound {
+		t.Fatalf("Expected another user's token to be out of reach, got %d", code)
+	}
+	if code := revoke(user.Token, token.ID); code != http.StatusNoContent {
+		t.Fatalf("Expected the owner to revoke the token, got %d", code)
+	}
+	if code := timeline(token.Token); code != http.StatusUnauthorized {
+		t.Fatalf("Expected a revoked token to be refused, got %d", code)
+	}
+}
+
+func TestCreatePersonalAccessTokenValidation(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "saul@example.com", "slippin-jimmy")
+	for _, body := range []map[string]any{
+		{"scopes": []string{auth.ScopeChirpsRead}},
+		{"name": "no scopes"},
+		{"name": "bad scope", "scopes": []string{"admin:everything"}},
+		{"name": "negative", "scopes": []string{auth.ScopeChirpsRead}, "expires_in_seconds": -5},
+	} {
+		rec := serve(cfg.HandleCreatePersonalAccessToken, withBearer(newJSONRequest(t, "POST", "/api/tokens", body), user.Token))
+		expectStatus(t, rec, http.StatusBadRequest)
+	}
+}
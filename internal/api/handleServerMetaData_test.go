@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareMetricsInc(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	handler := cfg.MiddlewareMetricsInc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/app/", nil))
+	}
+	if hits := cfg.GetFileserverHits(); hits != 3 {
+		t.Fatalf("Expected 3 hits, got %d", hits)
+	}
+
+	cfg.ResetFileserverHits()
+	if hits := cfg.GetFileserverHits(); hits != 0 {
+		t.Fatalf("Expected 0 hits after reset, got %d", hits)
+	}
+}
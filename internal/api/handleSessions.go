@@ -0,0 +1,121 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+// Session is one login. its id is the refresh token family id, so it stays
+// the same as the refresh token is rotated.
+type Session struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastUsedAt is when the session last logged in or refreshed its tokens
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+func newSession(token database.RefreshToken) Session {
+	return Session{
+		ID:        token.FamilyID,
+		CreatedAt: token.FamilyCreatedAt,
+		// the live token in a family was issued the last time it was used
+		LastUsedAt: token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		UserAgent:  token.UserAgent,
+		IPAddress:  token.IPAddress,
+	}
+}
+
+// HandleListSessions returns the caller's active sessions, most recently used
+// first
+func (cfg *APIConfig) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	// sessions past their maximum lifetime or idle timeout can't be refreshed
+	// any more, so they aren't listed
+	tokens, err := cfg.dbQueries.ListActiveRefreshTokensByUserID(r.Context(), cfg.tokenLifetimes.liveSessionsParams(userID.String(), time.Now().UTC()))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, newSession(token))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	jsonResponse, _ := json.Marshal(sessions)
+	w.Write(jsonResponse)
+}
+
+// HandleRevokeSession logs the caller out of one session. access tokens it
+// has already been issued stay valid until they expire.
+func (cfg *APIConfig) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	revoked, err := cfg.dbQueries.RevokeRefreshTokenFamilyByUserID(r.Context(), database.RevokeRefreshTokenFamilyByUserIDParams{
+		UserID:    userID.String(),
+		FamilyID:  r.PathValue("id"),
+		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if revoked == 0 {
+		// another user's session looks the same as one that doesn't exist
+		w.WriteHeader(http.StatusNotFound)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(notFoundError{Error: "Session not found"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRevokeAllSessions logs the caller out everywhere, including the
+// session making the request
+func (cfg *APIConfig) HandleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	_, err = cfg.dbQueries.RevokeAllRefreshTokensByUserID(r.Context(), database.RevokeAllRefreshTokensByUserIDParams{
+		UserID:    userID.String(),
+		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
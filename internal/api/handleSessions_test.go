@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func listSessions(t *testing.T, cfg *APIConfig, token string) []Session {
+	t.Helper()
+	rec := serve(cfg.HandleListSessions, withBearer(httptest.NewRequest("GET", "/api/sessions", nil), token))
+	expectStatus(t, rec, http.StatusOK)
+	return decodeResponse[[]Session](t, rec)
+}
+
+func TestHandleListSessions(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	rec := serve(cfg.HandleListSessions, httptest.NewRequest("GET", "/api/sessions", nil))
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	user := createTestUser(t, cfg, "jesse@example.com", "yeah-science")
+	req := newJSONRequest(t, "POST", "/api/login", map[string]string{
+		"email":    "jesse@example.com",
+		"password": "yeah-science",
+	})
+	req.Header.Set("User-Agent", "chirpy-ios/1.0")
+	req.RemoteAddr = "203.0.113.7:51234"
+	rec = serve(cfg.HandleAuthenticateUser, req)
+	expectStatus(t, rec, http.StatusOK)
+	phone := decodeResponse[userResponse](t, rec)
+
+	findPhone := func(sessions []Session) Session {
+		t.Helper()
+		if len(sessions) != 2 {
+			t.Fatalf("Expected 2 sessions, got %+v", sessions)
+		}
+		for _, session := range sessions {
+			if session.UserAgent == "chirpy-ios/1.0" {
+				return session
+			}
+		}
+		t.Fatalf("Expected a session with the login user agent, got %+v", sessions)
+		return Session{}
+	}
+	session := findPhone(listSessions(t, cfg, user.Token))
+	if session.IPAddress != "203.0.113.7" {
+		t.Fatalf("Expected the login ip address, got %q", session.IPAddress)
+	}
+
+	// refreshing keeps the session id and moves last_used_at along
+	rec = serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), phone.RefreshToken))
+	expectStatus(t, rec, http.StatusOK)
+	refreshed := findPhone(listSessions(t, cfg, user.Token))
+	if refreshed.ID != session.ID || !refreshed.CreatedAt.Equal(session.CreatedAt) || refreshed.LastUsedAt.Before(session.LastUsedAt) {
+		t.Fatalf("Expected the same session with a later last_used_at, got %+v then %+v", session, refreshed)
+	}
+}
+
+func TestHandleListSessionsHidesExpired(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "hector@example.com", "ding-ding")
+	if sessions := listSessions(t, cfg, user.Token); len(sessions) != 1 {
+		t.Fatalf("Expected 1 session, got %+v", sessions)
+	}
+
+	// sessions that can no longer be refreshed aren't listed
+	cfg.tokenLifetimes.RefreshIdle = time.Nanosecond
+	if sessions := listSessions(t, cfg, user.Token); len(sessions) != 0 {
+		t.Fatalf("Expected the idle session to be hidden, got %+v", sessions)
+	}
+	cfg.tokenLifetimes.RefreshIdle = 0
+	cfg.tokenLifetimes.RefreshAbsolute = time.Nanosecond
+	if sessions := listSessions(t, cfg, user.Token); len(sessions) != 0 {
+		t.Fatalf("Expected the session past its maximum lifetime to be hidden, got %+v", sessions)
+	}
+}
+
+func TestHandleRevokeSession(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "gale@example.com", "lab-notes")
+	other := createTestUser(t, cfg, "gustavo@example.com", "chicken-man")
+	second := loginTestUser(t, cfg, "gale@example.com", "lab-notes")
+
+	revoke := func(id, token string) *httptest.ResponseRecorder {
+		req := withBearer(httptest.NewRequest("DELETE", "/api/sessions/"+id, nil), token)
+		req.SetPathValue("id", id)
+		return serve(cfg.HandleRevokeSession, req)
+	}
+
+	if sessions := listSessions(t, cfg, user.Token); len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %+v", sessions)
+	}
+	record, err := cfg.getRefreshToken(context.Background(), second.RefreshToken)
+	if err != nil {
+		t.Fatalf("Error getting refresh token: %v", err)
+	}
+	target := record.FamilyID
+
+	expectStatus(t, revoke(target, other.Token), http.StatusNotFound)
+	expectStatus(t, revoke("missing", user.Token), http.StatusNotFound)
+	expectStatus(t, revoke(target, user.Token), http.StatusNoContent)
+	expectStatus(t, revoke(target, user.Token), http.StatusNotFound)
+
+	if remaining := listSessions(t, cfg, user.Token); len(remaining) != 1 || remaining[0].ID == target {
+		t.Fatalf("Expected one other session to remain, got %+v", remaining)
+	}
+	rec := serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), second.RefreshToken))
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestHandleRevokeAllSessions(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "lydia@example.com", "stevia-tea")
+	loginTestUser(t, cfg, "lydia@example.com", "stevia-tea")
+	other := createTestUser(t, cfg, "todd@example.com", "tarantula")
+
+	rec := serve(cfg.HandleRevokeAllSessions, withBearer(httptest.NewRequest("POST", "/api/sessions/revoke-all", nil), user.Token))
+	expectStatus(t, rec, http.StatusNoContent)
+
+	if sessions := listSessions(t, cfg, user.Token); len(sessions) != 0 {
+		t.Fatalf("Expected no sessions, got %+v", sessions)
+	}
+	rec = serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+	expectStatus(t, rec, http.StatusUnauthorized)
+	if sessions := listSessions(t, cfg, other.Token); len(sessions) != 1 {
+		t.Fatalf("Expected other users to keep their sessions, got %+v", sessions)
+	}
+}
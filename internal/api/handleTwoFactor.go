@@ -0,0 +1,548 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+const (
+	// totpIssuer names the account in authenticator apps
+	totpIssuer = "Chirpy"
+	// twoFactorChallengeTTL is how long a user has to enter their code after
+	// their password is accepted
+	twoFactorChallengeTTL = 5 * time.Minute
+	// twoFactorMaxAttempts is how many codes can be tried against one
+	// challenge, which stops six digit codes being guessed
+	twoFactorMaxAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// twoFactorEnabled reports whether a user has confirmed TOTP two-factor, so
+// proving who they are some other way isn't enough to log in
+func (cfg *APIConfig) twoFactorEnabled(ctx context.Context, userID string) (bool, error) {
+	totp, err := cfg.dbQueries.GetUserTOTP(ctx, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.EnabledAt.Valid, nil
+}
+
+// createTwoFactorChallenge starts the second step of a login. the challenge
+// token it returns stands in for the first factor when the code is sent to
+// HandleLoginTwoFactor.
+func (cfg *APIConfig) createTwoFactorChallenge(ctx context.Context, user database.User, expiresInSeconds int) (string, database.TwoFactorChallenge, error) {
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return "", database.TwoFactorChallenge{}, err
+	}
+	now := time.Now().UTC()
+	challenge, err := cfg.dbQueries.CreateTwoFactorChallenge(ctx, database.CreateTwoFactorChallengeParams{
+		TokenHash:        auth.HashToken(token),
+		UserID:           user.ID,
+		ExpiresInSeconds: int32(expiresInSeconds),
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(twoFactorChallengeTTL),
+	})
+	if err != nil {
+		return "", database.TwoFactorChallenge{}, err
+	}
+	return token, challenge, nil
+}
+
+// writeTwoFactorChallenge answers a correct password for a user with
+// two-factor enabled
+func (cfg *APIConfig) writeTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user database.User, expiresInSeconds int) {
+	token, challenge, err := cfg.createTwoFactorChallenge(r.Context(), user, expiresInSeconds)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(twoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresAt:         challenge.ExpiresAt,
+	})
+}
+
+// verifySecondFactor checks a code from the user's authenticator app or one of
+// their recovery codes, using it up either way. it returns the security event
+// to record when a recovery code was used, and "" otherwise.
+func (cfg *APIConfig) verifySecondFactor(ctx context.Context, userID, code string) (bool, string, error) {
+	totp, err := cfg.dbQueries.GetUserTOTP(ctx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, "", nil
+		}
+		return false, "", err
+	}
+	if !totp.EnabledAt.Valid {
+		return false, "", nil
+	}
+
+	if step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now()); ok {
+		accepted, err := cfg.dbQueries.UpdateUserTOTPLastUsedStep(ctx, database.UpdateUserTOTPLastUsedStepParams{
+			UserID:       userID,
+			LastUsedStep: step,
+		})
+		if err != nil {
+			return false, "", err
+		}
+		// a code at or before the last accepted one has been used already
+		return accepted == 1, "", nil
+	}
+
+	normalized := auth.NormalizeRecoveryCode(code)
+	if len(normalized) != len("xxxx-xxxx") {
+		// not shaped like a recovery code, so skip the slow hash checks
+		return false, "", nil
+	}
+	codes, err := cfg.dbQueries.ListUnusedRecoveryCodesByUserID(ctx, userID)
+	if err != nil {
+		return false, "", err
+	}
+	for _, recoveryCode := range codes {
+		same, err := auth.CheckPasswordHash(normalized, recoveryCode.CodeHash)
+		if err != nil {
+			return false, "", err
+		}
+		if !same {
+			continue
+		}
+		used, err := cfg.dbQueries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			ID:     recoveryCode.ID,
+			UsedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		})
+		if err != nil {
+			return false, "", err
+		}
+		return used == 1, securityEventRecoveryCodeUsed, nil
+	}
+	return false, "", nil
+}
+
+// replaceRecoveryCodes throws away the user's recovery codes and returns a new
+// set. only their argon2id hashes are stored, like passwords.
+func (cfg *APIConfig) replaceRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.dbQueries.DeleteRecoveryCodesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	for _, code := range codes {
+		hash, err := cfg.hashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		_, err = cfg.dbQueries.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			CodeHash:  hash,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// HandleEnrollTwoFactor starts two-factor enrollment with a new secret. it
+// isn't enabled until HandleConfirmTwoFactor sees a code made with it.
+func (cfg *APIConfig) HandleEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type enrollTwoFactorResponse struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID.String())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(hashError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	_, err = cfg.dbQueries.UpsertUserTOTP(r.Context(), database.UpsertUserTOTPParams{
+		UserID:    user.ID,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusConflict)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(jsonReadError{Error: "Two-factor authentication is already enabled"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollTwoFactorResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// HandleConfirmTwoFactor enables two-factor once the user shows they can make
+// codes with the enrolled secret, and returns their recovery codes. this is
+// the only time the codes are shown.
+func (cfg *APIConfig) HandleConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type confirmTwoFactorParams struct {
+		Code string `json:"code"`
+	}
+
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	params, err := deriveResponseJson[confirmTwoFactorParams](w, r)
+	if err != nil {
+		return
+	}
+
+	totp, err := cfg.dbQueries.GetUserTOTP(r.Context(), userID.String())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(jsonReadError{Error: "Start two-factor enrollment first"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if totp.EnabledAt.Valid {
+		w.WriteHeader(http.StatusConflict)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(jsonReadError{Error: "Two-factor authentication is already enabled"})
+		w.Write(jsonResponse)
+		return
+	}
+	step, ok := auth.ValidateTOTP(totp.Secret, params.Code, time.Now())
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(jsonReadError{Error: "Invalid two-factor code"})
+		w.Write(jsonResponse)
+		return
+	}
+
+	_, err = cfg.dbQueries.EnableUserTOTP(r.Context(), database.EnableUserTOTPParams{
+		UserID:    totp.UserID,
+		EnabledAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		// the confirming code can't then be used to log in
+		LastUsedStep: step,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// a concurrent confirm got there first
+			w.WriteHeader(http.StatusConflict)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(jsonReadError{Error: "Two-factor authentication is already enabled"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	codes, err := cfg.replaceRecoveryCodes(r.Context(), totp.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	err = cfg.recordSecurityEvent(r.Context(), totp.UserID, securityEventTwoFactorEnabled, "two-factor authentication enabled")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// HandleRegenerateRecoveryCodes replaces the caller's recovery codes, for when
+// they have used or lost them. it takes a current code so that an access token
+// alone can't be turned into a way past two-factor.
+func (cfg *APIConfig) HandleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	type regenerateRecoveryCodesParams struct {
+		Code string `json:"code"`
+	}
+
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	params, err := deriveResponseJson[regenerateRecoveryCodesParams](w, r)
+	if err != nil {
+		return
+	}
+
+	ok, _, err := cfg.verifySecondFactor(r.Context(), userID.String(), params.Code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(forbiddenError{Error: "Invalid two-factor code"})
+		w.Write(jsonResponse)
+		return
+	}
+	codes, err := cfg.replaceRecoveryCodes(r.Context(), userID.String())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// HandleDisableTwoFactor turns two-factor off. like regenerating recovery
+// codes it needs a current code.
+func (cfg *APIConfig) HandleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type disableTwoFactorParams struct {
+		Code string `json:"code"`
+	}
+
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	params, err := deriveResponseJson[disableTwoFactorParams](w, r)
+	if err != nil {
+		return
+	}
+
+	ok, _, err := cfg.verifySecondFactor(r.Context(), userID.String(), params.Code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(forbiddenError{Error: "Invalid two-factor code"})
+		w.Write(jsonResponse)
+		return
+	}
+	err = cfg.dbQueries.DeleteUserTOTP(r.Context(), userID.String())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	err = cfg.dbQueries.DeleteRecoveryCodesByUserID(r.Context(), userID.String())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	err = cfg.recordSecurityEvent(r.Context(), userID.String(), securityEventTwoFactorDisabled, "two-factor authentication disabled")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleLoginTwoFactor finishes a login that HandleAuthenticateUser answered
+// with a challenge, issuing tokens once the code checks out
+func (cfg *APIConfig) HandleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	type loginTwoFactorParams struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		UseCookies     bool   `json:"use_cookies"`
+	}
+
+	params, err := deriveResponseJson[loginTwoFactorParams](w, r)
+	if err != nil {
+		return
+	}
+
+	challengeHash := auth.HashToken(params.ChallengeToken)
+	// the attempt is counted before the code is checked, so parallel guesses
+	// can't get past the limit
+	challenge, err := cfg.dbQueries.RecordTwoFactorChallengeAttempt(r.Context(), database.RecordTwoFactorChallengeAttemptParams{
+		TokenHash:   challengeHash,
+		Now:         time.Now().UTC(),
+		MaxAttempts: twoFactorMaxAttempts,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid or expired challenge"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), challenge.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	// wrong codes count against the same limits as wrong passwords, or new
+	// challenges would give unlimited guesses at the code
+	wait, err := cfg.loginRetryAfter(r, user.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+
+	ok, event, err := cfg.verifySecondFactor(r.Context(), challenge.UserID, params.Code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if !ok {
+		if err := cfg.recordLoginFailure(r, user.Email, []database.User{user}); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid two-factor code"})
+		w.Write(jsonResponse)
+		return
+	}
+	consumed, err := cfg.dbQueries.ConsumeTwoFactorChallenge(r.Context(), database.ConsumeTwoFactorChallengeParams{
+		TokenHash: challengeHash,
+		UsedAt:    sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if consumed == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid or expired challenge"})
+		w.Write(jsonResponse)
+		return
+	}
+	if event != "" {
+		err = cfg.recordSecurityEvent(r.Context(), challenge.UserID, event, "logged in with a recovery code")
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+	}
+
+	cfg.writeLoginResponse(w, r, user, time.Duration(challenge.ExpiresInSeconds)*time.Second, params.UseCookies)
+}
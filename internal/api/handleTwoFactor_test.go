@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/lockout"
+)
+
+// totpCode makes the code for a step offset from now
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now())+offset)
+	if err != nil {
+		t.Fatalf("Error making code: %v", err)
+	}
+	return code
+}
+
+// enableTwoFactor enrolls and confirms two-factor for a user, returning the
+// secret, the code that confirmed it and the recovery codes
+func enableTwoFactor(t *testing.T, cfg *APIConfig, accessToken string) (string, string, []string) {
+	t.Helper()
+	rec := serve(cfg.HandleEnrollTwoFactor, withBearer(newJSONRequest(t, "POST", "/api/2fa/enroll", nil), accessToken))
+	expectStatus(t, rec, http.StatusOK)
+	enrolled := decodeResponse[struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}](t, rec)
+	uri, err := url.Parse(enrolled.OTPAuthURI)
+	if err != nil || uri.Scheme != "otpauth" || uri.Query().Get("secret") != enrolled.Secret {
+		t.Fatalf("Expected an otpauth uri carrying the secret, got %q", enrolled.OTPAuthURI)
+	}
+
+	confirmed := totpCode(t, enrolled.Secret, 0)
+	rec = serve(cfg.HandleConfirmTwoFactor, withBearer(newJSONRequest(t, "POST", "/api/2fa/confirm", map[string]string{"code": confirmed}), accessToken))
+	expectStatus(t, rec, http.StatusOK)
+	codes := decodeResponse[recoveryCodesResponse](t, rec).RecoveryCodes
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %v", recoveryCodeCount, codes)
+	}
+	return enrolled.Secret, confirmed, codes
+}
+
+// startTwoFactorLogin logs in with a password and returns the challenge token
+func startTwoFactorLogin(t *testing.T, cfg *APIConfig, email, password string) string {
+	t.Helper()
+	rec := serve(cfg.HandleAuthenticateUser, newJSONRequest(t, "POST", "/api/login", map[string]string{
+		"email":    email,
+		"password": password,
+	}))
+	expectStatus(t, rec, http.StatusOK)
+	challenge := decodeResponse[twoFactorChallengeResponse](t, rec)
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("Expected a two-factor challenge, got %s", rec.Body.String())
+	}
+	return challenge.ChallengeToken
+}
+
+func finishTwoFactorLogin(t *testing.T, cfg *APIConfig, challengeToken, code string) int {
+	t.Helper()
+	rec := serve(cfg.HandleLoginTwoFactor, newJSONRequest(t, "POST", "/api/login/2fa", map[string]string{
+		"challenge_token": challengeToken,
+		"code":            code,
+	}))
+	if rec.Code == http.StatusOK {
+		login := decodeResponse[userResponse](t, rec)
+		if login.Token == "" || login.RefreshToken == "" {
+			t.Fatalf("Expected tokens after two-factor, got %s", rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "saul@example.com", "better-call")
+
+	rec := serve(cfg.HandleEnrollTwoFactor, withBearer(newJSONRequest(t, "POST", "/api/2fa/enroll", nil), user.Token))
+	expectStatus(t, rec, http.StatusOK)
+	rec = serve(cfg.HandleConfirmTwoFactor, withBearer(newJSONRequest(t, "POST", "/api/2fa/confirm", map[string]string{"code": "000000x"}), user.Token))
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	secret, confirmed, _ := enableTwoFactor(t, cfg, user.Token)
+	rec = serve(cfg.HandleEnrollTwoFactor, withBearer(newJSONRequest(t, "POST", "/api/2fa/enroll", nil), user.Token))
+	expectStatus(t, rec, http.StatusConflict)
+
+	challenge := startTwoFactorLogin(t, cfg, user.Email, "better-call")
+	// the code that confirmed enrollment has been used
+	if code := finishTwoFactorLogin(t, cfg, challenge, confirmed); code != http.StatusUnauthorized {
+		t.Fatalf("Expected a used code to be rejected, got %d", code)
+	}
+	if code := finishTwoFactorLogin(t, cfg, challenge, totpCode(t, secret, 1)); code != http.StatusOK {
+		t.Fatalf("Expected the next code to log in, got %d", code)
+	}
+	// a challenge only logs in once
+	if code := finishTwoFactorLogin(t, cfg, challenge, totpCode(t, secret, 1)); code != http.StatusUnauthorized {
+		t.Fatalf("Expected a used challenge to be rejected, got %d", code)
+	}
+}
+
+func TestTwoFactorRecoveryCode(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "kim@example.com", "wexler-law")
+	_, _, codes := enableTwoFactor(t, cfg, user.Token)
+
+	challenge := startTwoFactorLogin(t, cfg, user.Email, "wexler-law")
+	if code := finishTwoFactorLogin(t, cfg, challenge, codes[0]); code != http.StatusOK {
+		t.Fatalf("Expected a recovery code to log in, got %d", code)
+	}
+	challenge = startTwoFactorLogin(t, cfg, user.Email, "wexler-law")
+	if code := finishTwoFactorLogin(t, cfg, challenge, codes[0]); code != http.StatusUnauthorized {
+		t.Fatalf("Expected a recovery code to work once, got %d", code)
+	}
+
+	events, err := cfg.dbQueries.ListSecurityEventsByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error listing security events: %v", err)
+	}
+	if len(events) != 2 || events[0].EventType != securityEventRecoveryCodeUsed || events[1].EventType != securityEventTwoFactorEnabled {
+		t.Fatalf("Expected enable and recovery code events, got %+v", events)
+	}
+}
+
+func TestTwoFactorChallengeAttemptLimit(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "nacho@example.com", "nacho-varga")
+	secret, _, _ := enableTwoFactor(t, cfg, user.Token)
+	// wrong codes count against the account too; take that out of the way to
+	// see the challenge's own limit
+	cfg.accountLimiter = lockout.NewLimiter(lockout.NewMemoryTracker(), lockout.Policy{})
+
+	challenge := startTwoFactorLogin(t, cfg, user.Email, "nacho-varga")
+	wrong := totpCode(t, secret, 5)
+	for range twoFactorMaxAttempts {
+		if code := finishTwoFactorLogin(t, cfg, challenge, wrong); code != http.StatusUnauthorized {
+			t.Fatalf("Expected a wrong code to be rejected, got %d", code)
+		}
+	}
+	if code := finishTwoFactorLogin(t, cfg, challenge, totpCode(t, secret, 1)); code != http.StatusUnauthorized {
+		t.Fatalf("Expected the challenge to be locked after %d attempts, got %d", twoFactorMaxAttempts, code)
+	}
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "chuck@example.com", "hhm-partner")
+	secret, _, _ := enableTwoFactor(t, cfg, user.Token)
+
+	rec := serve(cfg.HandleDisableTwoFactor, withBearer(newJSONRequest(t, "DELETE", "/api/2fa", map[string]string{"code": totpCode(t, secret, 5)}), user.Token))
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = serve(cfg.HandleDisableTwoFactor, withBearer(newJSONRequest(t, "DELETE", "/api/2fa", map[string]string{"code": totpCode(t, secret, 1)}), user.Token))
+	expectStatus(t, rec, http.StatusNoContent)
+
+	// the password is enough again
+	if login := loginTestUser(t, cfg, user.Email, "hhm-partner"); login.Token == "" {
+		t.Fatalf("Expected tokens from a password login")
+	}
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "howard@example.com", "hamlin-hhm")
+	secret, _, old := enableTwoFactor(t, cfg, user.Token)
+
+	rec := serve(cfg.HandleRegenerateRecoveryCodes, withBearer(newJSONRequest(t, "POST", "/api/2fa/recovery-codes", map[string]string{"code": totpCode(t, secret, 1)}), user.Token))
+	expectStatus(t, rec, http.StatusOK)
+	codes := decodeResponse[recoveryCodesResponse](t, rec).RecoveryCodes
+
+	challenge := startTwoFactorLogin(t, cfg, user.Email, "hamlin-hhm")
+	if code := finishTwoFactorLogin(t, cfg, challenge, old[0]); code != http.StatusUnauthorized {
+		t.Fatalf("Expected old recovery codes to stop working, got %d", code)
+	}
+	if code := finishTwoFactorLogin(t, cfg, challenge, codes[0]); code != http.StatusOK {
+		t.Fatalf("Expected a new recovery code to work, got %d", code)
+	}
+}
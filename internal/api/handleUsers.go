@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -20,7 +21,10 @@ type userResponse struct {
 	Email string `json:"email"`
 	Token string `json:"token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken string `json:"csrf_token,omitempty"`
 	IsChirpyRed bool `json:"is_chirpy_red"`
+	Role string `json:"role"`
+	EmailVerified bool `json:"email_verified"`
 }
 
 type updateUserEmailAndPasswordParams struct {
@@ -48,6 +52,9 @@ type databaseError struct {
 type unauthorizedError struct {
 	Error string `json:"error"`
 }
+type forbiddenError struct {
+	Error string `json:"error"`
+}
 type hashError struct {
 	Error string `json:"error"`
 }
@@ -83,9 +90,12 @@ func (cfg *APIConfig) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 		w.Write(jsonResponse)
 		return
 	}
+	if !cfg.checkPasswordPolicy(w, params.Password) {
+		return
+	}
 
 	// hash password
-	hashedPassword, err := auth.HashPassword(params.Password)
+	hashedPassword, err := cfg.hashPassword(params.Password)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
@@ -109,6 +119,12 @@ func (cfg *APIConfig) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 		w.Write(jsonResponse)
 		return
 	}
+	// the account is usable straight away; failing to send the link only
+	// means the user has to ask for another one
+	err = cfg.sendEmailVerification(r.Context(), user, user.Email)
+	if err != nil {
+		log.Printf("error starting email verification for user %s: %v", user.ID, err)
+	}
 	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
 	userResponse := userResponse{
@@ -117,14 +133,19 @@ func (cfg *APIConfig) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
 		IsChirpyRed: user.IsChirpyRed,
+		Role: user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 	}
 	json.NewEncoder(w).Encode(userResponse)
 }
 
 func (cfg *APIConfig) HandleUpdateUserPassword(w http.ResponseWriter, r *http.Request, params updateUserPasswordParams) {
+	if !cfg.checkPasswordPolicy(w, params.Password) {
+		return
+	}
 
 	// hash password
-	hashedPassword, err := auth.HashPassword(params.Password)
+	hashedPassword, err := cfg.hashPassword(params.Password)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
@@ -137,6 +158,7 @@ func (cfg *APIConfig) HandleUpdateUserPassword(w http.ResponseWriter, r *http.Re
 	user, err := cfg.dbQueries.UpdateUserPasswordByID(r.Context(), database.UpdateUserPasswordByIDParams{
 		ID: params.UserID,
 		HashedPassword: hashedPassword,
+		UpdatedAt: time.Now(),
 	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -162,14 +184,12 @@ func (cfg *APIConfig) HandleUpdateUserPassword(w http.ResponseWriter, r *http.Re
 	w.Write(res)
 }
 
+// HandleUpdateUserEmail starts changing the user's email. the new address
+// only replaces the old one once it is confirmed with HandleVerifyEmail, so
+// until then the user keeps logging in with the old one. asking for the
+// current address again resends its verification link.
 func (cfg *APIConfig) HandleUpdateUserEmail(w http.ResponseWriter, r *http.Request, params updateUserEmailParams) {
-
-	// update email
-	user, err := cfg.dbQueries.UpdateUserEmailByID(r.Context(), database.UpdateUserEmailByIDParams{
-		ID: params.UserID,
-		Email: params.Email,
-		UpdatedAt: time.Now(),
-	})
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), params.UserID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
@@ -177,6 +197,34 @@ func (cfg *APIConfig) HandleUpdateUserEmail(w http.ResponseWriter, r *http.Reque
 		w.Write(jsonResponse)
 		return
 	}
+
+	pendingEmail := ""
+	if params.Email != user.Email || !user.EmailVerifiedAt.Valid {
+		taken, err := cfg.emailTakenByOther(r.Context(), params.Email, user.ID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		if taken {
+			w.WriteHeader(http.StatusConflict)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(databaseError{Error: "Email is already in use"})
+			w.Write(jsonResponse)
+			return
+		}
+		err = cfg.sendEmailVerification(r.Context(), user, params.Email)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		pendingEmail = params.Email
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	userResponse := struct {
@@ -184,11 +232,15 @@ func (cfg *APIConfig) HandleUpdateUserEmail(w http.ResponseWriter, r *http.Reque
 		CreatedAt time.Time `json:"created_at"`
 		UpdatedAt time.Time `json:"updated_at"`
 		Email string `json:"email"`
+		EmailVerified bool `json:"email_verified"`
+		PendingEmail string `json:"pending_email,omitempty"`
 	}{
 		ID: user.ID,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail: pendingEmail,
 	}
 	res, _ :=json.Marshal(userResponse)
 	w.Write(res)
@@ -196,9 +248,30 @@ func (cfg *APIConfig) HandleUpdateUserEmail(w http.ResponseWriter, r *http.Reque
 
 
 func (cfg *APIConfig) HandleUpdateUserEmailAndPassword(w http.ResponseWriter, r *http.Request, params updateUserEmailAndPasswordParams) {
+	if !cfg.checkPasswordPolicy(w, params.Password) {
+		return
+	}
+
+	// check the email before changing anything, so a conflict leaves the
+	// password as it was
+	taken, err := cfg.emailTakenByOther(r.Context(), params.Email, params.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if taken {
+		w.WriteHeader(http.StatusConflict)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: "Email is already in use"})
+		w.Write(jsonResponse)
+		return
+	}
 
 	// hash password
-	hashedPassword, err := auth.HashPassword(params.Password)
+	hashedPassword, err := cfg.hashPassword(params.Password)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
@@ -207,10 +280,9 @@ func (cfg *APIConfig) HandleUpdateUserEmailAndPassword(w http.ResponseWriter, r
 		return
 	}
 
-	// update email and password
-	user, err := cfg.dbQueries.UpdateUser(r.Context(), database.UpdateUserParams{
+	// update password now; the email waits for verification
+	_, err = cfg.dbQueries.UpdateUserPasswordByID(r.Context(), database.UpdateUserPasswordByIDParams{
 		ID: params.UserID,
-		Email: params.Email,
 		HashedPassword: hashedPassword,
 		UpdatedAt: time.Now(),
 	})
@@ -221,21 +293,10 @@ func (cfg *APIConfig) HandleUpdateUserEmailAndPassword(w http.ResponseWriter, r
 		w.Write(jsonResponse)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	userResponse := struct {
-		ID string `json:"id"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
-		Email string `json:"email"`
-	}{
-		ID: user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email: user.Email,
-	}
-	res, _ :=json.Marshal(userResponse)
-	w.Write(res)
+	cfg.HandleUpdateUserEmail(w, r, updateUserEmailParams{
+		UserID: params.UserID,
+		Email: params.Email,
+	})
 }
 
 func (cfg *APIConfig) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
@@ -261,24 +322,11 @@ func (cfg *APIConfig) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// get bearer token
-	token, err := auth.GetBearerToken(r.Header)
+	// get userID. a personal access token can't change the email or
+	// password, or a leaked one would hand over the whole account
+	userID, err := cfg.authenticatedUserID(r)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid Authorization Token"})
-		w.Write(jsonResponse)
-		return
-	}
-	fmt.Println("token [HandleUpdateUser]:", token)
-
-	// get userID
-	userID, err := auth.ValidateJWT(token, cfg.tokenSecret)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid Authorization Token"})
-		w.Write(jsonResponse)
+		writeAuthError(w, err)
 		return
 	}
 	fmt.Println("userID [HandleUpdateUser]:", userID)
@@ -332,6 +380,8 @@ func (cfg *APIConfig) HandleAuthenticateUser(w http.ResponseWriter, r *http.Requ
 		Email string `json:"email"`
 		Password string `json:"password"`
 		ExpiresInSeconds int `json:"expires_in_seconds,omitempty"`
+		// browsers get their tokens as cookies instead of in the body
+		UseCookies bool `json:"use_cookies,omitempty"`
 	}
 	params, err := deriveResponseJson[authenticateUserParams](w, r)
 	if err != nil {
@@ -341,20 +391,26 @@ func (cfg *APIConfig) HandleAuthenticateUser(w http.ResponseWriter, r *http.Requ
 		w.Write(jsonResponse)
 		return
 	}
-	// set default expires in seconds to 3600 if not provided
-	if params.ExpiresInSeconds == 0 {
-		params.ExpiresInSeconds = 3600
+	// the client can ask for a shorter or longer access token, within limits
+	accessTTL := cfg.tokenLifetimes.accessTTL(params.ExpiresInSeconds)
+
+	// checked before the password so a locked out guesser doesn't get to
+	// make us run argon2id
+	wait, err := cfg.loginRetryAfter(r, params.Email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
 	}
 
 	users, err := cfg.dbQueries.GetUsersByEmail(r.Context(), params.Email)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Header().Set("Content-Type", "application/json")
-			jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid email or password"})
-			w.Write(jsonResponse)
-			return
-		}
+	if err != nil && err != sql.ErrNoRows {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
 		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
@@ -372,74 +428,183 @@ func (cfg *APIConfig) HandleAuthenticateUser(w http.ResponseWriter, r *http.Requ
 			return
 		}
 		if same {
-			// authorized
-			// create JWT
-			token, err := auth.MakeJWT(uuid.MustParse(user.ID), cfg.tokenSecret, time.Duration(params.ExpiresInSeconds)*time.Second)
+			// authorized. failures are only reset once tokens are issued, so
+			// a password alone can't keep clearing the count while the
+			// second factor is guessed
+			cfg.upgradePasswordHash(r, user, params.Password)
+			twoFactor, err := cfg.twoFactorEnabled(r.Context(), user.ID)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				w.Header().Set("Content-Type", "application/json")
-				jsonResponse, _ := json.Marshal(jwtError{Error: err.Error()})
+				jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
 				w.Write(jsonResponse)
 				return
 			}
-
-			// create refresh token
-			refreshToken, err := auth.MakeRefreshToken()
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Header().Set("Content-Type", "application/json")
-				jsonResponse, _ := json.Marshal(refreshTokenError{Error: err.Error()})
-				w.Write(jsonResponse)
+			if twoFactor {
+				// the password alone isn't enough; tokens come from HandleLoginTwoFactor
+				cfg.writeTwoFactorChallenge(w, r, user, int(accessTTL/time.Second))
 				return
 			}
+			cfg.writeLoginResponse(w, r, user, accessTTL, params.UseCookies)
+			return
+		}
+	}
+	// not authorized. unknown emails count too, so guessing can't tell them
+	// apart from real accounts
+	if err := cfg.recordLoginFailure(r, params.Email, users); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Header().Set("Content-Type", "application/json")
+	jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid email or password"})
+	w.Write(jsonResponse)
+}
 
-			// create refresh token record
-			_, err = cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-				Token: refreshToken,
-				CreatedAt: time.Now().UTC(),
-				UpdatedAt: time.Now().UTC(),
-				UserID: user.ID,
-				ExpiresAt: time.Now().UTC().Add(time.Duration(params.ExpiresInSeconds)*time.Second),
-			})
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Header().Set("Content-Type", "application/json")
-				jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
-				w.Write(jsonResponse)
-				return
-			}
+// sessionTokens are the tokens a login hands out
+type sessionTokens struct {
+	AccessToken string
+	AccessExpiresAt time.Time
+	RefreshToken string
+	RefreshExpiresAt time.Time
+}
+
+// startSession issues an access token and starts a new refresh token family
+// for a user who has proven who they are
+func (cfg *APIConfig) startSession(r *http.Request, user database.User, expiresIn time.Duration) (sessionTokens, error) {
+	// create JWT
+	now := time.Now().UTC()
+	token, err := auth.MakeJWT(uuid.MustParse(user.ID), user.Role, cfg.tokenKeys, expiresIn)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	// create refresh token
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	// create refresh token record. its lifetime is the server's to decide,
+	// whatever the client asked of the access token
+	refreshExpiresAt := cfg.tokenLifetimes.refreshExpiresAt(now, now)
+	// only the digest is stored, so a copy of the table can't be used to log in
+	_, err = cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		ID: uuid.New().String(),
+		TokenHash: auth.HashToken(refreshToken),
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID: user.ID,
+		ExpiresAt: refreshExpiresAt,
+		// each login starts a new family that its rotations belong to
+		FamilyID: uuid.New().String(),
+		FamilyCreatedAt: now,
+		UserAgent: r.UserAgent(),
+		IPAddress: clientIP(r),
+	})
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	return sessionTokens{
+		AccessToken: token,
+		AccessExpiresAt: now.Add(expiresIn),
+		RefreshToken: refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// writeLoginResponse starts a session for a user who has proven who they are
+// and clears the account's failed logins. with useCookies the tokens are set
+// as cookies and left out of the body.
+func (cfg *APIConfig) writeLoginResponse(w http.ResponseWriter, r *http.Request, user database.User, expiresIn time.Duration, useCookies bool) {
+	tokens, err := cfg.startSession(r, user, expiresIn)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(refreshTokenError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	if err := cfg.resetLoginFailures(r.Context(), user.Email); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
 
-			// write response
-			w.WriteHeader(http.StatusOK)
+	userResponse := userResponse{
+		ID: user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email: user.Email,
+		Token: tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IsChirpyRed: user.IsChirpyRed,
+		Role: user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}
+	if useCookies {
+		csrfToken, err := setSessionCookies(w, r, tokens.AccessToken, tokens.AccessExpiresAt, tokens.RefreshToken, tokens.RefreshExpiresAt)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
 			w.Header().Set("Content-Type", "application/json")
-			userResponse := userResponse{
-				ID: user.ID,
-				CreatedAt: user.CreatedAt,
-				UpdatedAt: user.UpdatedAt,
-				Email: user.Email,
-				Token: token,
-				RefreshToken: refreshToken,
-				IsChirpyRed: user.IsChirpyRed,
-			}
-			res, _ := json.Marshal(userResponse)
-			w.Write(res)
+			jsonResponse, _ := json.Marshal(refreshTokenError{Error: err.Error()})
+			w.Write(jsonResponse)
 			return
 		}
+		userResponse.Token = ""
+		userResponse.RefreshToken = ""
+		userResponse.CSRFToken = csrfToken
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	res, _ := json.Marshal(userResponse)
+	w.Write(res)
+}
+
+// getRefreshToken looks up a refresh token by its digest. the digest found is
+// checked again in constant time, so the token is never compared byte by byte
+func (cfg *APIConfig) getRefreshToken(ctx context.Context, refreshToken string) (database.RefreshToken, error) {
+	record, err := cfg.dbQueries.GetRefreshTokenByHash(ctx, auth.HashToken(refreshToken))
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+	if !auth.CheckTokenHash(refreshToken, record.TokenHash) {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return record, nil
+}
+
+// writeRefreshTokenReuse revokes the session a reused refresh token belongs
+// to and refuses the refresh
+func (cfg *APIConfig) writeRefreshTokenReuse(w http.ResponseWriter, r *http.Request, token database.RefreshToken) {
+	if err := cfg.revokeReusedRefreshToken(r.Context(), token); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
 	}
-	// not authorized
 	w.WriteHeader(http.StatusUnauthorized)
 	w.Header().Set("Content-Type", "application/json")
-	jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Invalid email or password"})
+	jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Refresh token reuse detected"})
 	w.Write(jsonResponse)
 }
 
 func (cfg *APIConfig) HandleTokenRefresh(w http.ResponseWriter, r *http.Request) {
 	type tokenRefreshResponse struct {
-		Token string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
+		Token string `json:"token,omitempty"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		CSRFToken string `json:"csrf_token,omitempty"`
 	}
 
-	refreshToken, err := auth.GetBearerToken(r.Header)
+	refreshToken, fromCookie, err := auth.GetSessionToken(r, auth.RefreshTokenCookie)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Header().Set("Content-Type", "application/json")
@@ -447,8 +612,14 @@ func (cfg *APIConfig) HandleTokenRefresh(w http.ResponseWriter, r *http.Request)
 		w.Write(jsonResponse)
 		return
 	}
+	if fromCookie {
+		if err := auth.CheckCSRF(r); err != nil {
+			writeAuthError(w, err)
+			return
+		}
+	}
 
-	refreshTokenRecord, err := cfg.dbQueries.GetRefreshTokenByToken(r.Context(), refreshToken)
+	refreshTokenRecord, err := cfg.getRefreshToken(r.Context(), refreshToken)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			w.WriteHeader(http.StatusNotFound)
@@ -464,11 +635,10 @@ func (cfg *APIConfig) HandleTokenRefresh(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if refreshTokenRecord.ExpiresAt.Before(time.Now().UTC()) {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Refresh token expired"})
-		w.Write(jsonResponse)
+	// a token that was already rotated is being reused, which means it was
+	// stolen whether or not the session has since expired
+	if refreshTokenRecord.RevokedAt.Valid && refreshTokenRecord.ReplacedBy.Valid {
+		cfg.writeRefreshTokenReuse(w, r, refreshTokenRecord)
 		return
 	}
 
@@ -480,68 +650,93 @@ func (cfg *APIConfig) HandleTokenRefresh(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// get duration between creation and expiry
-	expiresInDuration := refreshTokenRecord.ExpiresAt.Sub(refreshTokenRecord.CreatedAt)
+	now := time.Now().UTC()
+	if reason := cfg.tokenLifetimes.refreshExpired(refreshTokenRecord, now); reason != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(unauthorizedError{Error: reason})
+		w.Write(jsonResponse)
+		return
+	}
 
-	// create JWT
-	token, err := auth.MakeJWT(uuid.MustParse(refreshTokenRecord.UserID), cfg.tokenSecret, expiresInDuration)
+	// create new refresh token
+	newRefreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(jwtError{Error: err.Error()})
+		jsonResponse, _ := json.Marshal(refreshTokenError{Error: err.Error()})
 		w.Write(jsonResponse)
 		return
 	}
 
-	/*
-	// revoke refresh token
-	_, err = cfg.dbQueries.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
-		Token: refreshToken,
-		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
-		UpdatedAt: time.Now().UTC(),
+	// revoke the presented token and replace it. finding it already rotated
+	// here means a concurrent request used it too
+	refreshExpiresAt := cfg.tokenLifetimes.refreshExpiresAt(now, refreshTokenRecord.FamilyCreatedAt)
+	_, err = cfg.dbQueries.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		Now: now,
+		NewID: uuid.New().String(),
+		NewTokenHash: auth.HashToken(newRefreshToken),
+		ID: refreshTokenRecord.ID,
+		ExpiresAt: refreshExpiresAt,
 	})
+	if err == sql.ErrNoRows {
+		cfg.writeRefreshTokenReuse(w, r, refreshTokenRecord)
+		return
+	}
 	if err != nil {
-		fmt.Println("error revoking refresh token [HandleTokenRefresh]:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
 	}
-	*/
 
-	// create new refresh token
-	newRefreshToken, err := auth.MakeRefreshToken()
+	// look up the user so the new token carries their current role
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), refreshTokenRecord.UserID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(refreshTokenError{Error: err.Error()})
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
 		w.Write(jsonResponse)
 		return
 	}
 
-	// create new refresh token record
-	_, err = cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token: newRefreshToken,
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
-		UserID: refreshTokenRecord.UserID,
-		ExpiresAt: time.Now().UTC().Add(expiresInDuration),
-	})
+	// create JWT
+	token, err := auth.MakeJWT(uuid.MustParse(user.ID), user.Role, cfg.tokenKeys, cfg.tokenLifetimes.Access)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		jsonResponse, _ := json.Marshal(jwtError{Error: err.Error()})
 		w.Write(jsonResponse)
 		return
 	}
 
+	response := tokenRefreshResponse{
+		Token: token,
+		RefreshToken: newRefreshToken,
+	}
+	// a browser that sent its refresh token as a cookie gets the new tokens
+	// the same way
+	if fromCookie {
+		csrfToken, err := setSessionCookies(w, r, token, now.Add(cfg.tokenLifetimes.Access), newRefreshToken, refreshExpiresAt)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(refreshTokenError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		response = tokenRefreshResponse{CSRFToken: csrfToken}
+	}
+
 	// write response
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tokenRefreshResponse{
-		Token: token,
-		RefreshToken: newRefreshToken,
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
 func (cfg *APIConfig) HandleTokenRevoke(w http.ResponseWriter, r *http.Request) {
-	refreshToken, err := auth.GetBearerToken(r.Header)
+	refreshToken, fromCookie, err := auth.GetSessionToken(r, auth.RefreshTokenCookie)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Header().Set("Content-Type", "application/json")
@@ -549,8 +744,17 @@ func (cfg *APIConfig) HandleTokenRevoke(w http.ResponseWriter, r *http.Request)
 		w.Write(jsonResponse)
 		return
 	}
+	if fromCookie {
+		if err := auth.CheckCSRF(r); err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		// revoking is how a browser logs out, so its cookies go whether or
+		// not the token still worked
+		clearSessionCookies(w)
+	}
 
-	refreshTokenRecord, err := cfg.dbQueries.GetRefreshTokenByToken(r.Context(), refreshToken)
+	refreshTokenRecord, err := cfg.getRefreshToken(r.Context(), refreshToken)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			w.WriteHeader(http.StatusNotFound)
@@ -566,10 +770,11 @@ func (cfg *APIConfig) HandleTokenRevoke(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if refreshTokenRecord.ExpiresAt.Before(time.Now().UTC()) {
+	now := time.Now().UTC()
+	if reason := cfg.tokenLifetimes.refreshExpired(refreshTokenRecord, now); reason != "" {
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Header().Set("Content-Type", "application/json")
-		jsonResponse, _ := json.Marshal(unauthorizedError{Error: "Refresh token expired"})
+		jsonResponse, _ := json.Marshal(unauthorizedError{Error: reason})
 		w.Write(jsonResponse)
 		return
 	}
@@ -584,7 +789,7 @@ func (cfg *APIConfig) HandleTokenRevoke(w http.ResponseWriter, r *http.Request)
 
 	// revoke refresh token
 	_, err = cfg.dbQueries.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
-		Token: refreshToken,
+		ID: refreshTokenRecord.ID,
 		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
 		UpdatedAt: time.Now().UTC(),
 	})
@@ -696,8 +901,4 @@ func (cfg *APIConfig) checkUserExists(userID string) (bool, error) {
 		return false, fmt.Errorf("error checking user exists: %w", err)
 	}
 	return true, nil
-}
-
-func (cfg *APIConfig) DeleteAllUsers(ctx context.Context) {	
-	cfg.dbQueries.DeleteAllUsers(ctx)
 }
\ No newline at end of file
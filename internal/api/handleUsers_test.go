@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+)
+
+func TestHandleCreateUser(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+
+	rec := serve(cfg.HandleCreateUser, newJSONRequest(t, "POST", "/api/users", map[string]string{
+		"email":    "walt@example.com",
+		"password": "heisenberg",
+	}))
+	expectStatus(t, rec, http.StatusCreated)
+	user := decodeResponse[userResponse](t, rec)
+	if user.ID == "" || user.Email != "walt@example.com" {
+		t.Fatalf("Unexpected user response: %+v", user)
+	}
+	if user.Token != "" || user.RefreshToken != "" {
+		t.Fatalf("Expected no tokens on signup, got %+v", user)
+	}
+
+	// the email is unique
+	rec = serve(cfg.HandleCreateUser, newJSONRequest(t, "POST", "/api/users", map[string]string{
+		"email":    "walt@example.com",
+		"password": "another-one",
+	}))
+	expectStatus(t, rec, http.StatusInternalServerError)
+}
+
+func TestHandleCreateUserRequiresJSON(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	req := newJSONRequest(t, "POST", "/api/users", map[string]string{"email": "a@example.com"})
+	req.Header.Set("Content-Type", "text/plain")
+	rec := serve(cfg.HandleCreateUser, req)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestHandleAuthenticateUser(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "jesse@example.com", "yo-science")
+	if user.Token == "" || user.RefreshToken == "" {
+		t.Fatalf("Expected token and refresh token, got %+v", user)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{name: "wrong password", email: "jesse@example.com", password: "nope"},
+		{name: "unknown email", email: "nobody@example.com", password: "yo-science"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(cfg.HandleAuthenticateUser, newJSONRequest(t, "POST", "/api/login", map[string]string{
+				"email":    tt.email,
+				"password": tt.password,
+			}))
+			expectStatus(t, rec, http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestHandleUpdateUser(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "skyler@example.com", "car-wash")
+
+	rec := serve(cfg.HandleUpdateUser, newJSONRequest(t, "PUT", "/api/users", map[string]string{
+		"email": "skyler.white@example.com",
+	}))
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	rec = serve(cfg.HandleUpdateUser, withBearer(newJSONRequest(t, "PUT", "/api/users", map[string]string{}), user.Token))
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = serve(cfg.HandleUpdateUser, withBearer(newJSONRequest(t, "PUT", "/api/users", map[string]string{
+		"email":    "skyler.white@example.com",
+		"password": "new-password",
+	}), user.Token))
+	expectStatus(t, rec, http.StatusOK)
+	updated := decodeResponse[struct {
+		Email        string `json:"email"`
+		PendingEmail string `json:"pending_email"`
+	}](t, rec)
+	if updated.Email != "skyler@example.com" || updated.PendingEmail != "skyler.white@example.com" {
+		t.Fatalf("Expected the new email to wait for verification, got %+v", updated)
+	}
+
+	// the password changes straight away, the email once it is confirmed
+	loginTestUser(t, cfg, "skyler@example.com", "new-password")
+	messages := sentMail(t, cfg)
+	rec = serve(cfg.HandleVerifyEmail, newJSONRequest(t, "POST", "/api/email/verify", map[string]string{
+		"token": tokenFromMail(t, messages[len(messages)-1]),
+	}))
+	expectStatus(t, rec, http.StatusOK)
+	loginTestUser(t, cfg, "skyler.white@example.com", "new-password")
+}
+
+func TestHandleTokenRefreshAndRevoke(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "hank@example.com", "minerals")
+
+	rec := serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), "not-a-token"))
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+	expectStatus(t, rec, http.StatusOK)
+	refreshed := decodeResponse[struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}](t, rec)
+	if refreshed.Token == "" || refreshed.RefreshToken == "" {
+		t.Fatalf("Expected new tokens, got %+v", refreshed)
+	}
+
+	rec = serve(cfg.HandleTokenRevoke, withBearer(newJSONRequest(t, "POST", "/api/revoke", nil), refreshed.RefreshToken))
+	expectStatus(t, rec, http.StatusNoContent)
+
+	rec = serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), refreshed.RefreshToken))
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestRefreshTokensStoredHashed(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "steve@example.com", "dea-agent")
+
+	stored, err := cfg.dbQueries.GetRefreshTokenByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error getting refresh tokens: %v", err)
+	}
+	if len(stored) != 1 || stored[0].TokenHash != auth.HashToken(user.RefreshToken) || stored[0].ID == user.RefreshToken {
+		t.Fatalf("Expected only the digest of the refresh token to be stored, got %+v", stored)
+	}
+
+	rec := serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+	expectStatus(t, rec, http.StatusOK)
+	rotated := decodeResponse[struct {
+		RefreshToken string `json:"refresh_token"`
+	}](t, rec).RefreshToken
+	successor, err := cfg.dbQueries.GetRefreshTokenByHash(context.Background(), auth.HashToken(rotated))
+	if err != nil {
+		t.Fatalf("Error getting rotated token: %v", err)
+	}
+	previous, err := cfg.dbQueries.GetRefreshTokenByHash(context.Background(), auth.HashToken(user.RefreshToken))
+	if err != nil {
+		t.Fatalf("Error getting original token: %v", err)
+	}
+	// the chain of rotations links ids, not tokens
+	if previous.ReplacedBy.String != successor.ID {
+		t.Fatalf("Expected the original token to point at its successor's id, got %q", previous.ReplacedBy.String)
+	}
+	// a digest is not a token
+	rec = serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), successor.TokenHash))
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestHandleTokenRefreshReuse(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "marie@example.com", "purple-rain")
+	otherLogin := loginTestUser(t, cfg, "marie@example.com", "purple-rain")
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		return serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), token))
+	}
+	rec := refresh(user.RefreshToken)
+	expectStatus(t, rec, http.StatusOK)
+	rotated := decodeResponse[struct {
+		RefreshToken string `json:"refresh_token"`
+	}](t, rec).RefreshToken
+
+	// replaying the first token revokes its successor too
+	rec = refresh(user.RefreshToken)
+	expectStatus(t, rec, http.StatusUnauthorized)
+	if body := rec.Body.String(); !strings.Contains(body, "reuse") {
+		t.Fatalf("Expected a reuse error, got %s", body)
+	}
+	expectStatus(t, refresh(rotated), http.StatusUnauthorized)
+
+	events, err := cfg.dbQueries.ListSecurityEventsByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error listing security events: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != securityEventRefreshTokenReuse {
+		t.Fatalf("Expected a reuse security event, got %+v", events)
+	}
+
+	// other logins are separate families and keep working
+	expectStatus(t, refresh(otherLogin.RefreshToken), http.StatusOK)
+}
+
+func TestHandleTokenRefreshConcurrent(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "walter.jr@example.com", "breakfast")
+
+	const attempts = 10
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+			codes <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	succeeded := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("Expected exactly one refresh to succeed, got %d", succeeded)
+	}
+}
+
+func TestHandleUpdateUserSetChirpyRed(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "saul@example.com", "better-call")
+
+	upgrade := func(apiKey, event, userID string) int {
+		req := newJSONRequest(t, "POST", "/api/polka/webhooks", map[string]any{
+			"event": event,
+			"data":  map[string]string{"user_id": userID},
+		})
+		req.Header.Set("Authorization", "ApiKey "+apiKey)
+		return serve(cfg.HandleUpdateUserSetChirpyRed, req).Code
+	}
+
+	if code := upgrade("wrong-key", "user.upgraded", user.ID); code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for wrong api key, got %d", code)
+	}
+	if code := upgrade(testPolkaKey, "user.upgraded", "missing-user"); code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for unknown user, got %d", code)
+	}
+	if code := upgrade(testPolkaKey, "user.downgraded", user.ID); code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for ignored event, got %d", code)
+	}
+	if code := upgrade(testPolkaKey, "user.upgraded", user.ID); code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for upgrade, got %d", code)
+	}
+
+	loggedIn := loginTestUser(t, cfg, "saul@example.com", "better-call")
+	if !loggedIn.IsChirpyRed {
+		t.Fatalf("Expected user to be chirpy red after upgrade")
+	}
+}
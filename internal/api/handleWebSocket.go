@@ -0,0 +1,240 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/events"
+)
+
+const (
+	// maxWSSubscriptions caps the topics a single connection can follow
+	maxWSSubscriptions = 20
+	// wsSendBuffer bounds replies queued for a connection; a client that
+	// lets it fill up is disconnected
+	wsSendBuffer       = 16
+	wsWriteWait        = 10 * time.Second
+	wsMaxMessageSize   = 4096
+	wsTopicGlobal      = "global"
+	wsTopicAuthor      = "author:"
+	wsTopicThread      = "thread:"
+	wsCloseSlowMessage = "slow consumer"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsClientMessage is sent by clients. Topic is used by subscribe and
+// unsubscribe, ThreadID by typing.
+type wsClientMessage struct {
+	Type     string `json:"type"`
+	Topic    string `json:"topic,omitempty"`
+	ThreadID string `json:"thread_id,omitempty"`
+}
+
+type wsServerMessage struct {
+	Type     string          `json:"type"`
+	Topic    string          `json:"topic,omitempty"`
+	EventID  uint64          `json:"event_id,omitempty"`
+	Chirp    json.RawMessage `json:"chirp,omitempty"`
+	ThreadID string          `json:"thread_id,omitempty"`
+	UserID   string          `json:"user_id,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// wsConnection is the state of one websocket client. topics is read by the
+// broker while delivering events, so it is guarded by mu.
+type wsConnection struct {
+	userID string
+	send   chan wsServerMessage
+
+	mu     sync.Mutex
+	topics map[string]bool
+}
+
+// wants reports whether an event matches one of the connection's topics
+func (c *wsConnection) wants(event events.Event) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if event.Type == events.Typing {
+		if event.AuthorID == c.userID {
+			return false
+		}
+	} else if c.topics[wsTopicGlobal] || c.topics[wsTopicAuthor+event.AuthorID] {
+		return true
+	}
+	for _, threadID := range event.ThreadIDs {
+		if c.topics[wsTopicThread+threadID] {
+			return true
+		}
+	}
+	return false
+}
+
+// reply queues a message for the writer, reporting false if the client has
+// fallen too far behind to take it
+func (c *wsConnection) reply(message wsServerMessage) bool {
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// HandleWebSocket upgrades an authenticated request to a websocket. clients
+// subscribe to topics ("global", "author:<user id>" or "thread:<chirp id>")
+// and receive chirp events for them, and can send typing indicators to a
+// thread. the connection is closed if the client stops answering pings or
+// falls behind on events.
+func (cfg *APIConfig) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.scopedUserID(r, auth.ScopeChirpsRead)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	ws, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already written an error response
+		return
+	}
+	defer ws.Close()
+
+	conn := &wsConnection{
+		userID: userID.String(),
+		send:   make(chan wsServerMessage, wsSendBuffer),
+		topics: map[string]bool{},
+	}
+	sub := cfg.events.Subscribe(conn.wants, 0, false)
+	defer sub.Close()
+
+	pongWait := 2 * cfg.wsPingInterval
+	ws.SetReadLimit(wsMaxMessageSize)
+	ws.SetReadDeadline(time.Now().Add(pongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	go cfg.writeWebSocket(ws, conn, sub, done)
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			// the client went away or stopped answering pings
+			return
+		}
+		response := wsServerMessage{Type: "error", Error: "Invalid JSON"}
+		var message wsClientMessage
+		if err := json.Unmarshal(data, &message); err == nil {
+			response = cfg.handleWebSocketMessage(r, conn, message)
+		}
+		if !conn.reply(response) {
+			return
+		}
+	}
+}
+
+// handleWebSocketMessage applies a client message and returns the reply
+func (cfg *APIConfig) handleWebSocketMessage(r *http.Request, conn *wsConnection, message wsClientMessage) wsServerMessage {
+	switch message.Type {
+	case "subscribe":
+		if !validWSTopic(message.Topic) {
+			return wsServerMessage{Type: "error", Topic: message.Topic, Error: "Unknown topic"}
+		}
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		if !conn.topics[message.Topic] && len(conn.topics) >= maxWSSubscriptions {
+			return wsServerMessage{Type: "error", Topic: message.Topic, Error: fmt.Sprintf("A connection can have at most %d subscriptions", maxWSSubscriptions)}
+		}
+		conn.topics[message.Topic] = true
+		return wsServerMessage{Type: "subscribed", Topic: message.Topic}
+	case "unsubscribe":
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		delete(conn.topics, message.Topic)
+		return wsServerMessage{Type: "unsubscribed", Topic: message.Topic}
+	case "typing":
+		chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), message.ThreadID)
+		if err == nil && chirp.DeletedAt.Valid {
+			err = sql.ErrNoRows
+		}
+		if err == sql.ErrNoRows {
+			return wsServerMessage{Type: "error", ThreadID: message.ThreadID, Error: "Chirp not found"}
+		}
+		if err != nil {
+			return wsServerMessage{Type: "error", ThreadID: message.ThreadID, Error: fmt.Sprintf("Error getting chirp by id: %v", err)}
+		}
+		cfg.events.Signal(events.Event{
+			Type:      events.Typing,
+			ChirpID:   chirp.ID,
+			AuthorID:  conn.userID,
+			ThreadIDs: cfg.chirpThreadIDs(r.Context(), chirp),
+		})
+		return wsServerMessage{Type: "typing_sent", ThreadID: chirp.ID}
+	default:
+		return wsServerMessage{Type: "error", Error: fmt.Sprintf("Unknown message type %q", message.Type)}
+	}
+}
+
+func validWSTopic(topic string) bool {
+	if topic == wsTopicGlobal {
+		return true
+	}
+	for _, prefix := range []string{wsTopicAuthor, wsTopicThread} {
+		if id, ok := strings.CutPrefix(topic, prefix); ok && id != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeWebSocket is the only goroutine that writes to the connection. it
+// sends replies, subscribed events and pings until done is closed.
+func (cfg *APIConfig) writeWebSocket(ws *websocket.Conn, conn *wsConnection, sub *events.Subscription, done <-chan struct{}) {
+	ping := time.NewTicker(cfg.wsPingInterval)
+	defer ping.Stop()
+	// unblock the reader if writing fails
+	defer ws.Close()
+
+	for {
+		var message wsServerMessage
+		select {
+		case <-done:
+			return
+		case message = <-conn.send:
+		case event, ok := <-sub.Events():
+			if !ok {
+				// dropped by the broker for falling behind
+				ws.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, wsCloseSlowMessage),
+					time.Now().Add(wsWriteWait))
+				return
+			}
+			message = wsServerMessage{Type: string(event.Type), EventID: event.ID, Chirp: event.Data}
+			if event.Type == events.Typing {
+				message = wsServerMessage{Type: string(event.Type), ThreadID: event.ChirpID, UserID: event.AuthorID}
+			}
+		case <-ping.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+			continue
+		}
+		ws.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := ws.WriteJSON(message); err != nil {
+			return
+		}
+	}
+}
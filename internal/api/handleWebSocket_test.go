@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+func dialWebSocket(t *testing.T, server *httptest.Server, token string) *websocket.Conn {
+	t.Helper()
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("Error dialing websocket: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func readWSMessage(t *testing.T, ws *websocket.Conn) wsServerMessage {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var message wsServerMessage
+	if err := ws.ReadJSON(&message); err != nil {
+		t.Fatalf("Error reading websocket message: %v", err)
+	}
+	return message
+}
+
+func sendWSMessage(t *testing.T, ws *websocket.Conn, message wsClientMessage) wsServerMessage {
+	t.Helper()
+	if err := ws.WriteJSON(message); err != nil {
+		t.Fatalf("Error writing websocket message: %v", err)
+	}
+	return readWSMessage(t, ws)
+}
+
+func subscribeWS(t *testing.T, ws *websocket.Conn, topic string) {
+	t.Helper()
+	reply := sendWSMessage(t, ws, wsClientMessage{Type: "subscribe", Topic: topic})
+	if reply.Type != "subscribed" || reply.Topic != topic {
+		t.Fatalf("Expected subscribed to %s, got %+v", topic, reply)
+	}
+}
+
+func TestHandleWebSocketRequiresAuth(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	server := httptest.NewServer(http.HandlerFunc(cfg.HandleWebSocket))
+	defer server.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected 401, got %v %v", resp, err)
+	}
+}
+
+func TestHandleWebSocketTopics(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com", "password")
+	bob := createTestUser(t, cfg, "bob@example.com", "password")
+	insertTestChirp(t, cfg, "root", alice.ID, "root", time.Now())
+	server := httptest.NewServer(http.HandlerFunc(cfg.HandleWebSocket))
+	defer server.Close()
+
+	global := dialWebSocket(t, server, alice.Token)
+	subscribeWS(t, global, "global")
+	author := dialWebSocket(t, server, alice.Token)
+	subscribeWS(t, author, "author:"+bob.ID)
+	thread := dialWebSocket(t, server, alice.Token)
+	subscribeWS(t, thread, "thread:root")
+
+	createChirp := func(token string, body map[string]string) CompleteChirp {
+		rec := serve(cfg.HandleCreateChirp, withBearer(newJSONRequest(t, "POST", "/api/chirps", body), token))
+		expectStatus(t, rec, http.StatusCreated)
+		return decodeResponse[CompleteChirp](t, rec)
+	}
+	aliceChirp := createChirp(alice.Token, map[string]string{"body": "not a reply"})
+	reply := createChirp(bob.Token, map[string]string{"body": "a reply", "reply_to_id": "root"})
+	nested := createChirp(alice.Token, map[string]string{"body": "nested", "reply_to_id": reply.ID})
+
+	expect := func(ws *websocket.Conn, ids ...string) {
+		t.Helper()
+		for _, id := range ids {
+			message := readWSMessage(t, ws)
+			if message.Type != "chirp.created" || message.EventID == 0 || !strings.Contains(string(message.Chirp), id) {
+				t.Fatalf("Expected chirp.created for %s, got %+v", id, message)
+			}
+		}
+	}
+	expect(global, aliceChirp.ID, reply.ID, nested.ID)
+	expect(author, reply.ID)
+	expect(thread, reply.ID, nested.ID)
+
+	// after unsubscribing bob's chirps stop arriving
+	if ack := sendWSMessage(t, author, wsClientMessage{Type: "unsubscribe", Topic: "author:" + bob.ID}); ack.Type != "unsubscribed" {
+		t.Fatalf("Expected unsubscribed, got %+v", ack)
+	}
+	createChirp(bob.Token, map[string]string{"body": "unheard"})
+	last := createChirp(alice.Token, map[string]string{"body": "last", "reply_to_id": "root"})
+	expect(thread, last.ID)
+	author.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, err := author.ReadMessage(); err == nil {
+		t.Fatalf("Expected no events after unsubscribing")
+	}
+}
+
+func TestHandleWebSocketMessages(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "limits@example.com", "password")
+	server := httptest.NewServer(http.HandlerFunc(cfg.HandleWebSocket))
+	defer server.Close()
+	ws := dialWebSocket(t, server, user.Token)
+
+	tests := []struct {
+		name    string
+		message wsClientMessage
+	}{
+		{name: "unknown type", message: wsClientMessage{Type: "shout"}},
+		{name: "unknown topic", message: wsClientMessage{Type: "subscribe", Topic: "everything"}},
+		{name: "empty author", message: wsClientMessage{Type: "subscribe", Topic: "author:"}},
+		{name: "typing in missing thread", message: wsClientMessage{Type: "typing", ThreadID: "missing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reply := sendWSMessage(t, ws, tt.message); reply.Type != "error" {
+				t.Fatalf("Expected an error, got %+v", reply)
+			}
+		})
+	}
+
+	if err := ws.WriteMessage(websocket.TextMessage, []byte("{not json")); err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+	if reply := readWSMessage(t, ws); reply.Type != "error" || reply.Error != "Invalid JSON" {
+		t.Fatalf("Expected invalid JSON error, got %+v", reply)
+	}
+
+	for i := 0; i < maxWSSubscriptions; i++ {
+		subscribeWS(t, ws, "thread:c"+string(rune('a'+i)))
+	}
+	if reply := sendWSMessage(t, ws, wsClientMessage{Type: "subscribe", Topic: "global"}); reply.Type != "error" {
+		t.Fatalf("Expected the subscription limit to apply, got %+v", reply)
+	}
+	// resubscribing to a topic already held is fine
+	subscribeWS(t, ws, "thread:ca")
+}
+
+func TestHandleWebSocketTyping(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com", "password")
+	bob := createTestUser(t, cfg, "bob@example.com", "password")
+	insertTestChirp(t, cfg, "root", alice.ID, "root", time.Now())
+	_, err := cfg.dbQueries.CreateChirp(context.Background(), database.CreateChirpParams{
+		ID:        "reply",
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Body:      "reply",
+		UserID:    alice.ID,
+		ReplyToID: sql.NullString{String: "root", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("Error inserting reply: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(cfg.HandleWebSocket))
+	defer server.Close()
+
+	watcher := dialWebSocket(t, server, alice.Token)
+	subscribeWS(t, watcher, "thread:root")
+	typist := dialWebSocket(t, server, bob.Token)
+	subscribeWS(t, typist, "thread:root")
+
+	// typing under a reply reaches subscribers of the whole thread
+	if reply := sendWSMessage(t, typist, wsClientMessage{Type: "typing", ThreadID: "reply"}); reply.Type != "typing_sent" {
+		t.Fatalf("Expected typing_sent, got %+v", reply)
+	}
+	message := readWSMessage(t, watcher)
+	if message.Type != "typing" || message.ThreadID != "reply" || message.UserID != bob.ID {
+		t.Fatalf("Expected bob typing in reply, got %+v", message)
+	}
+
+	// the typist doesn't hear their own indicator
+	typist.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, err := typist.ReadMessage(); err == nil {
+		t.Fatalf("Expected no typing event for the typist")
+	}
+}
+
+func TestHandleWebSocketPing(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	cfg.wsPingInterval = 10 * time.Millisecond
+	user := createTestUser(t, cfg, "ping@example.com", "password")
+	server := httptest.NewServer(http.HandlerFunc(cfg.HandleWebSocket))
+	defer server.Close()
+	ws := dialWebSocket(t, server, user.Token)
+
+	pinged := make(chan struct{}, 1)
+	ws.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	// control frames are handled while reading
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-pinged:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the server to ping")
+	}
+
+	// the connection stays open because we answer the pings
+	time.Sleep(5 * cfg.wsPingInterval)
+	if err := ws.WriteJSON(wsClientMessage{Type: "subscribe", Topic: "global"}); err != nil {
+		t.Fatalf("Expected the connection to stay open: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+	"github.com/landanqrew/go-serve-intro/internal/lockout"
+)
+
+type tooManyAttemptsError struct {
+	Error string `json:"error"`
+}
+
+// loadAttemptTracker picks where attempts are counted.
+// LOGIN_ATTEMPT_TRACKER=postgres shares counts between instances through the
+// store; the default keeps them in memory.
+func loadAttemptTracker(store database.Store) (lockout.Tracker, error) {
+	switch os.Getenv("LOGIN_ATTEMPT_TRACKER") {
+	case "", "memory":
+		return lockout.NewMemoryTracker(), nil
+	case "postgres":
+		return lockout.NewPostgresTracker(store), nil
+	}
+	return nil, fmt.Errorf("unknown LOGIN_ATTEMPT_TRACKER %q, expected memory or postgres", os.Getenv("LOGIN_ATTEMPT_TRACKER"))
+}
+
+// loadLoginLimiters builds the per-account and per-ip limiters for login
+func loadLoginLimiters(store database.Store) (*lockout.Limiter, *lockout.Limiter, error) {
+	tracker, err := loadAttemptTracker(store)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accountPolicy := lockout.DefaultAccountPolicy()
+	ipPolicy := lockout.DefaultIPPolicy()
+	if err := envInt("LOGIN_LOCKOUT_THRESHOLD", &accountPolicy.LockoutThreshold); err != nil {
+		return nil, nil, err
+	}
+	if err := envInt("LOGIN_IP_LOCKOUT_THRESHOLD", &ipPolicy.LockoutThreshold); err != nil {
+		return nil, nil, err
+	}
+	if err := envDuration("LOGIN_LOCKOUT_DURATION", &accountPolicy.LockoutDuration); err != nil {
+		return nil, nil, err
+	}
+	ipPolicy.LockoutDuration = accountPolicy.LockoutDuration
+	// failures have to be remembered for at least as long as the lockout
+	accountPolicy.Window = max(accountPolicy.Window, accountPolicy.LockoutDuration)
+	ipPolicy.Window = max(ipPolicy.Window, ipPolicy.LockoutDuration)
+	return lockout.NewLimiter(tracker, accountPolicy), lockout.NewLimiter(tracker, ipPolicy), nil
+}
+
+// loginAccountKey and loginIPKey share one tracker, so they are prefixed to
+// keep them apart
+func loginAccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginIPKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// loginRetryAfter returns how long the request has to wait before it may try a
+// password, the longer of the account's and the client's waits
+func (cfg *APIConfig) loginRetryAfter(r *http.Request, email string) (time.Duration, error) {
+	now := time.Now().UTC()
+	accountWait, err := cfg.accountLimiter.RetryAfter(r.Context(), loginAccountKey(email), now)
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := cfg.ipLimiter.RetryAfter(r.Context(), loginIPKey(r), now)
+	if err != nil {
+		return 0, err
+	}
+	return max(accountWait, ipWait), nil
+}
+
+// recordLoginFailure counts a wrong password against the account and the
+// client. the account's owner gets a security event when it locks.
+func (cfg *APIConfig) recordLoginFailure(r *http.Request, email string, users []database.User) error {
+	now := time.Now().UTC()
+	locked, err := cfg.accountLimiter.Fail(r.Context(), loginAccountKey(email), now)
+	if err != nil {
+		return err
+	}
+	if _, err := cfg.ipLimiter.Fail(r.Context(), loginIPKey(r), now); err != nil {
+		return err
+	}
+	if locked {
+		for _, user := range users {
+			err := cfg.recordSecurityEvent(r.Context(), user.ID, securityEventAccountLocked,
+				fmt.Sprintf("login locked after repeated failed attempts, last from %s", clientIP(r)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resetLoginFailures clears the account's count after a successful login. the
+// client's count is kept, so one good account can't be used to reset the
+// backoff while guessing at others.
+func (cfg *APIConfig) resetLoginFailures(ctx context.Context, email string) error {
+	return cfg.accountLimiter.Reset(ctx, loginAccountKey(email))
+}
+
+// writeTooManyAttempts responds 429 to a login that has to wait
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	writeTooManyRequests(w, wait, "Too many failed login attempts")
+}
+
+// writeTooManyRequests responds 429 with a Retry-After header in whole seconds
+func writeTooManyRequests(w http.ResponseWriter, wait time.Duration, message string) {
+	// headers have to be set before WriteHeader to be sent
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	jsonResponse, _ := json.Marshal(tooManyAttemptsError{Error: message})
+	w.Write(jsonResponse)
+}
+
+// HandleUnlockUser clears the failed login count for a user's account. it is
+// served behind MiddlewareRequireRole, so the caller is known to be an admin.
+func (cfg *APIConfig) HandleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	adminID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(notFoundError{Error: "User not found"})
+			w.Write(jsonResponse)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	if err := cfg.resetLoginFailures(r.Context(), user.Email); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+	err = cfg.recordSecurityEvent(r.Context(), user.ID, securityEventAccountUnlocked,
+		fmt.Sprintf("login unlocked by admin %s", adminID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/lockout"
+)
+
+func attemptLogin(t *testing.T, cfg *APIConfig, email, password, remoteAddr string) int {
+	t.Helper()
+	req := newJSONRequest(t, "POST", "/api/login", map[string]string{
+		"email":    email,
+		"password": password,
+	})
+	req.RemoteAddr = remoteAddr
+	rec := serve(cfg.HandleAuthenticateUser, req)
+	if rec.Code == http.StatusTooManyRequests {
+		seconds, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+		if err != nil || seconds <= 0 {
+			t.Fatalf("Expected a Retry-After in seconds on 429, got %q", rec.Header().Get("Retry-After"))
+		}
+	}
+	return rec.Code
+}
+
+func TestLoginBackoff(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	createTestUser(t, cfg, "gus@example.com", "los-pollos")
+
+	for i := range 3 {
+		if code := attemptLogin(t, cfg, "gus@example.com", "wrong", "198.51.100.1:1000"); code != http.StatusUnauthorized {
+			t.Fatalf("Expected failure %d to be a 401, got %d", i+1, code)
+		}
+	}
+	// the right password has to wait too
+	if code := attemptLogin(t, cfg, "gus@example.com", "los-pollos", "198.51.100.2:1000"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the account to back off, got %d", code)
+	}
+	// other accounts aren't held up
+	createTestUser(t, cfg, "lalo@example.com", "salamanca")
+	if code := attemptLogin(t, cfg, "lalo@example.com", "salamanca", "198.51.100.1:1000"); code != http.StatusOK {
+		t.Fatalf("Expected another account to log in, got %d", code)
+	}
+}
+
+func TestLoginIPBackoff(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	createTestUser(t, cfg, "hector@example.com", "ding-ding")
+
+	// spread over many accounts so only the client's count adds up
+	for i := range 10 {
+		attemptLogin(t, cfg, "nobody"+strconv.Itoa(i)+"@example.com", "wrong", "198.51.100.9:1000")
+	}
+	if code := attemptLogin(t, cfg, "hector@example.com", "ding-ding", "198.51.100.9:2000"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the client to back off, got %d", code)
+	}
+	if code := attemptLogin(t, cfg, "hector@example.com", "ding-ding", "198.51.100.10:1000"); code != http.StatusOK {
+		t.Fatalf("Expected another client to log in, got %d", code)
+	}
+}
+
+func TestAccountLockoutAndUnlock(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "3")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "1h")
+	cfg := newTestAPIConfig(t)
+	admin := createTestUserWithRole(t, cfg, "admin@example.com", auth.RoleAdmin)
+	user := createTestUser(t, cfg, "mike@example.com", "ehrmantraut")
+
+	for range 3 {
+		attemptLogin(t, cfg, user.Email, "wrong", "198.51.100.1:1000")
+	}
+	req := newJSONRequest(t, "POST", "/api/login", map[string]string{"email": user.Email, "password": "ehrmantraut"})
+	rec := serve(cfg.HandleAuthenticateUser, req)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if seconds, _ := strconv.Atoi(rec.Header().Get("Retry-After")); seconds <= 3000 {
+		t.Fatalf("Expected an hour long lockout, got Retry-After %q", rec.Header().Get("Retry-After"))
+	}
+
+	unlock := func(token, id string) int {
+		req := withBearer(newJSONRequest(t, "DELETE", "/admin/users/"+id+"/lockout", nil), token)
+		req.SetPathValue("id", id)
+		return serve(cfg.HandleUnlockUser, req).Code
+	}
+	if code := unlock(admin.Token, "00000000-0000-0000-0000-000000000000"); code != http.StatusNotFound {
+		t.Fatalf("Expected unlocking a missing user to be a 404, got %d", code)
+	}
+	if code := unlock(admin.Token, user.ID); code != http.StatusNoContent {
+		t.Fatalf("Expected the admin to unlock the account, got %d", code)
+	}
+	if code := attemptLogin(t, cfg, user.Email, "ehrmantraut", "198.51.100.1:1000"); code != http.StatusOK {
+		t.Fatalf("Expected to log in after the unlock, got %d", code)
+	}
+
+	events, err := cfg.dbQueries.ListSecurityEventsByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error listing security events: %v", err)
+	}
+	if len(events) != 2 || events[0].EventType != securityEventAccountUnlocked || events[1].EventType != securityEventAccountLocked {
+		t.Fatalf("Expected lock and unlock events, got %+v", events)
+	}
+}
+
+func TestLoadLoginLimitersRejectsBadConfig(t *testing.T) {
+	for name, value := range map[string]string{
+		"LOGIN_ATTEMPT_TRACKER":   "redis",
+		"LOGIN_LOCKOUT_THRESHOLD": "zero",
+		"LOGIN_LOCKOUT_DURATION":  "-1m",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, _, err := loadLoginLimiters(nil); err == nil {
+				t.Fatalf("Expected %s=%q to be rejected", name, value)
+			}
+		})
+	}
+}
+
+func TestTwoFactorGuessesLockOut(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "kim@example.com", "wexler-law")
+	secret, _, _ := enableTwoFactor(t, cfg, user.Token)
+	wrong := totpCode(t, secret, 5)
+
+	// a fresh challenge for every guess still adds up on the account, so the
+	// password doesn't buy unlimited guesses at the code
+	for range lockout.DefaultAccountPolicy().LockoutThreshold {
+		rec := serve(cfg.HandleAuthenticateUser, newJSONRequest(t, "POST", "/api/login", map[string]string{
+			"email":    user.Email,
+			"password": "wexler-law",
+		}))
+		if rec.Code == http.StatusTooManyRequests {
+			return
+		}
+		expectStatus(t, rec, http.StatusOK)
+		challenge := decodeResponse[twoFactorChallengeResponse](t, rec).ChallengeToken
+		if code := finishTwoFactorLogin(t, cfg, challenge, wrong); code == http.StatusTooManyRequests {
+			return
+		}
+	}
+	t.Fatalf("Expected wrong two-factor codes to back off the account")
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+)
+
+// MiddlewareRequireRole only lets through requests with an access token for a
+// user with at least the given role. the role claim is checked against the
+// database too, so a demotion takes effect before the user's token expires.
+func (cfg *APIConfig) MiddlewareRequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearerToken, err := requestToken(r)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		claims, err := auth.ParseJWT(bearerToken, cfg.tokenKeys)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(jwtError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		if !auth.HasRole(claims.Role, role) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(forbiddenError{Error: "Requires the " + role + " role"})
+			w.Write(jsonResponse)
+			return
+		}
+
+		user, err := cfg.dbQueries.GetUserByID(r.Context(), claims.Subject)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Header().Set("Content-Type", "application/json")
+				jsonResponse, _ := json.Marshal(unauthorizedError{Error: "User not found"})
+				w.Write(jsonResponse)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+			w.Write(jsonResponse)
+			return
+		}
+		if !auth.HasRole(user.Role, role) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Header().Set("Content-Type", "application/json")
+			jsonResponse, _ := json.Marshal(forbiddenError{Error: "Requires the " + role + " role"})
+			w.Write(jsonResponse)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
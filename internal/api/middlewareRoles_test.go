@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+// createTestUserWithRole signs up a user, gives them a role and logs them in
+// again so their token carries it
+func createTestUserWithRole(t *testing.T, cfg *APIConfig, email, role string) userResponse {
+	t.Helper()
+	user := createTestUser(t, cfg, email, "password")
+	setTestUserRole(t, cfg, user.ID, role)
+	return loginTestUser(t, cfg, email, "password")
+}
+
+func setTestUserRole(t *testing.T, cfg *APIConfig, userID, role string) {
+	t.Helper()
+	_, err := cfg.dbQueries.UpdateUserRole(context.Background(), database.UpdateUserRoleParams{
+		ID:        userID,
+		Role:      role,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Error setting role: %v", err)
+	}
+}
+
+func TestMiddlewareRequireRole(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "user@example.com", "password")
+	moderator := createTestUserWithRole(t, cfg, "moderator@example.com", auth.RoleModerator)
+	admin := createTestUserWithRole(t, cfg, "admin@example.com", auth.RoleAdmin)
+	if user.Role != auth.RoleUser || admin.Role != auth.RoleAdmin {
+		t.Fatalf("Expected roles in login responses, got %q and %q", user.Role, admin.Role)
+	}
+
+	handler := cfg.MiddlewareRequireRole(auth.RoleModerator, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	request := func(token string) int {
+		req := httptest.NewRequest("GET", "/admin/anything", nil)
+		if token != "" {
+			req = withBearer(req, token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "no token", token: "", want: http.StatusUnauthorized},
+		{name: "invalid token", token: "not-a-jwt", want: http.StatusUnauthorized},
+		{name: "user", token: user.Token, want: http.StatusForbidden},
+		{name: "moderator", token: moderator.Token, want: http.StatusTeapot},
+		{name: "admin", token: admin.Token, want: http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := request(tt.token); code != tt.want {
+				t.Fatalf("Expected %d, got %d", tt.want, code)
+			}
+		})
+	}
+
+	// a demotion applies to tokens that still claim the old role
+	setTestUserRole(t, cfg, moderator.ID, auth.RoleUser)
+	if code := request(moderator.Token); code != http.StatusForbidden {
+		t.Fatalf("Expected a demoted moderator to be forbidden, got %d", code)
+	}
+	// and a promotion needs a new token
+	setTestUserRole(t, cfg, user.ID, auth.RoleModerator)
+	if code := request(user.Token); code != http.StatusForbidden {
+		t.Fatalf("Expected the old token to stay forbidden, got %d", code)
+	}
+	rec := serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+	expectStatus(t, rec, http.StatusOK)
+	refreshed := decodeResponse[struct {
+		Token string `json:"token"`
+	}](t, rec)
+	if code := request(refreshed.Token); code != http.StatusTeapot {
+		t.Fatalf("Expected a refreshed token to carry the new role, got %d", code)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+type passwordPolicyError struct {
+	Error string `json:"error"`
+}
+
+// hashPassword hashes a password with the configured argon2id costs
+func (cfg *APIConfig) hashPassword(password string) (string, error) {
+	return auth.HashPasswordWithParams(password, cfg.passwordParams)
+}
+
+// checkPasswordPolicy responds 400 and returns false when a new password
+// doesn't satisfy the policy
+func (cfg *APIConfig) checkPasswordPolicy(w http.ResponseWriter, password string) bool {
+	if err := cfg.passwordPolicy.Check(password); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(passwordPolicyError{Error: err.Error()})
+		w.Write(jsonResponse)
+		return false
+	}
+	return true
+}
+
+// upgradePasswordHash rehashes a password that has just been checked when its
+// hash was made with other costs than the configured ones. the login goes
+// ahead either way, so failures are only logged.
+func (cfg *APIConfig) upgradePasswordHash(r *http.Request, user database.User, password string) {
+	stale, err := auth.NeedsRehash(user.HashedPassword, cfg.passwordParams)
+	if err != nil || !stale {
+		return
+	}
+	hashedPassword, err := cfg.hashPassword(password)
+	if err != nil {
+		log.Printf("error rehashing password for user %s: %v", user.ID, err)
+		return
+	}
+	// only replaces the hash that was checked; if the password was reset or
+	// changed since, the new one is kept
+	_, err = cfg.dbQueries.UpgradeUserPasswordHash(r.Context(), database.UpgradeUserPasswordHashParams{
+		NewHashedPassword: hashedPassword,
+		ID:                user.ID,
+		OldHashedPassword: user.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("error saving rehashed password for user %s: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+)
+
+func TestPasswordPolicyEnforced(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(blocklist, []byte("trustno1!\n"), 0o600); err != nil {
+		t.Fatalf("Error writing blocklist: %v", err)
+	}
+	t.Setenv("PASSWORD_BLOCKLIST_FILE", blocklist)
+	cfg := newTestAPIConfig(t)
+
+	signup := func(password string) int {
+		return serve(cfg.HandleCreateUser, newJSONRequest(t, "POST", "/api/users", map[string]string{
+			"email":    "skyler@example.com",
+			"password": password,
+		})).Code
+	}
+	if code := signup("short"); code != http.StatusBadRequest {
+		t.Fatalf("Expected a short password to be refused, got %d", code)
+	}
+	if code := signup("TrustNo1!"); code != http.StatusBadRequest {
+		t.Fatalf("Expected a blocklisted password to be refused, got %d", code)
+	}
+
+	user := createTestUser(t, cfg, "skyler@example.com", "car-wash-books")
+	for _, body := range []map[string]string{
+		{"password": "short"},
+		{"email": "skyler.white@example.com", "password": "trustno1!"},
+	} {
+		rec := serve(cfg.HandleUpdateUser, withBearer(newJSONRequest(t, "PUT", "/api/users", body), user.Token))
+		expectStatus(t, rec, http.StatusBadRequest)
+	}
+
+	token := requestPasswordReset(t, cfg, user.Email)
+	rec := serve(cfg.HandleResetPassword, newJSONRequest(t, "POST", "/api/password/reset", map[string]string{
+		"token":    token,
+		"password": "short",
+	}))
+	expectStatus(t, rec, http.StatusBadRequest)
+	// a refused password doesn't use up the link
+	rec = serve(cfg.HandleResetPassword, newJSONRequest(t, "POST", "/api/password/reset", map[string]string{
+		"token":    token,
+		"password": "a-much-better-one",
+	}))
+	expectStatus(t, rec, http.StatusNoContent)
+}
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	cfg.passwordParams = auth.PasswordParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1}
+	user := createTestUser(t, cfg, "ted@example.com", "beneke-fabrics")
+	before, err := cfg.dbQueries.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error getting user: %v", err)
+	}
+
+	// the cost goes up after the user signed up
+	cfg.passwordParams.Iterations = 2
+	loginTestUser(t, cfg, user.Email, "beneke-fabrics")
+	after, err := cfg.dbQueries.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error getting user: %v", err)
+	}
+	if after.HashedPassword == before.HashedPassword {
+		t.Fatalf("Expected the hash to be replaced on login")
+	}
+	if stale, err := auth.NeedsRehash(after.HashedPassword, cfg.passwordParams); err != nil || stale {
+		t.Fatalf("Expected the new hash to use the current params, got %v %v", stale, err)
+	}
+	if !after.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Fatalf("Expected a rehash to leave updated_at alone")
+	}
+
+	// the upgraded hash logs in and is left as it is
+	loginTestUser(t, cfg, user.Email, "beneke-fabrics")
+	again, _ := cfg.dbQueries.GetUserByID(context.Background(), user.ID)
+	if again.HashedPassword != after.HashedPassword {
+		t.Fatalf("Expected a current hash to be kept")
+	}
+}
+
+func TestPasswordHashUpgradeKeepsNewerPassword(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	cfg.passwordParams = auth.PasswordParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1}
+	user := createTestUser(t, cfg, "gale@example.com", "lab-notes")
+	// what a login read before the password was changed
+	checked, err := cfg.dbQueries.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error getting user: %v", err)
+	}
+
+	// the password is changed between the login's check and its rehash
+	rec := serve(cfg.HandleUpdateUser, withBearer(newJSONRequest(t, "PUT", "/api/users", map[string]string{
+		"email":    user.Email,
+		"password": "new-lab-notes",
+	}), user.Token))
+	expectStatus(t, rec, http.StatusOK)
+	cfg.passwordParams.Iterations = 2
+	cfg.upgradePasswordHash(httptest.NewRequest("POST", "/api/login", nil), checked, "lab-notes")
+
+	loginTestUser(t, cfg, user.Email, "new-lab-notes")
+	rec = serve(cfg.HandleAuthenticateUser, newJSONRequest(t, "POST", "/api/login", map[string]string{
+		"email":    user.Email,
+		"password": "lab-notes",
+	}))
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+// errAuthLookup wraps store failures while checking a token, which are our
+// fault rather than the client's
+var errAuthLookup = errors.New("error checking token")
+
+// scopeError is returned when a personal access token is valid but wasn't
+// granted the scope an endpoint needs
+type scopeError struct {
+	scope string
+}
+
+func (e scopeError) Error() string {
+	return fmt.Sprintf("Token is missing the %s scope", e.scope)
+}
+
+// personalAccessTokenTouchInterval limits how often last_used_at is written
+// for a token that is in constant use
+const personalAccessTokenTouchInterval = time.Minute
+
+// authenticatedUserID validates the JWT the request was made with, from the
+// Authorization header or the session cookie, and returns the id of the user
+// it was issued to. personal access tokens aren't accepted, so endpoints that
+// manage the account itself stay behind a login.
+func (cfg *APIConfig) authenticatedUserID(r *http.Request) (uuid.UUID, error) {
+	bearerToken, err := requestToken(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	userID, err := auth.ValidateJWT(bearerToken, cfg.tokenKeys)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if userID == uuid.Nil {
+		return uuid.Nil, errors.New("Invalid token")
+	}
+	return userID, nil
+}
+
+// scopedUserID accepts either a JWT or a personal access token that has been
+// granted scope, and returns the id of the user the token belongs to
+func (cfg *APIConfig) scopedUserID(r *http.Request, scope string) (uuid.UUID, error) {
+	bearerToken, err := requestToken(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !auth.IsPersonalAccessToken(bearerToken) {
+		return cfg.authenticatedUserID(r)
+	}
+
+	token, err := cfg.dbQueries.GetPersonalAccessTokenByHash(r.Context(), auth.HashToken(bearerToken))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return uuid.Nil, errors.New("Invalid token")
+		}
+		return uuid.Nil, fmt.Errorf("%w: %v", errAuthLookup, err)
+	}
+	now := time.Now().UTC()
+	if token.ExpiresAt.Valid && !token.ExpiresAt.Time.After(now) {
+		return uuid.Nil, errors.New("Token has expired")
+	}
+	if !auth.HasScope(token.Scopes, scope) {
+		return uuid.Nil, scopeError{scope: scope}
+	}
+	if !token.LastUsedAt.Valid || now.Sub(token.LastUsedAt.Time) >= personalAccessTokenTouchInterval {
+		// only bookkeeping, so it doesn't fail the request
+		err := cfg.dbQueries.TouchPersonalAccessToken(r.Context(), database.TouchPersonalAccessTokenParams{
+			ID:         token.ID,
+			LastUsedAt: sql.NullTime{Time: now, Valid: true},
+		})
+		if err != nil {
+			log.Printf("error recording use of personal access token %s: %v", token.ID, err)
+		}
+	}
+	return uuid.Parse(token.UserID)
+}
+
+// writeAuthError responds to an error from authenticatedUserID or
+// scopedUserID: 403 for a missing scope or CSRF token, 500 when the token
+// couldn't be looked up and 401 otherwise
+func writeAuthError(w http.ResponseWriter, err error) {
+	var missingScope scopeError
+	switch {
+	case errors.As(err, &missingScope), errors.Is(err, auth.ErrCSRFToken):
+		w.WriteHeader(http.StatusForbidden)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(forbiddenError{Error: err.Error()})
+		w.Write(jsonResponse)
+	case errors.Is(err, errAuthLookup):
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(databaseError{Error: err.Error()})
+		w.Write(jsonResponse)
+	default:
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse, _ := json.Marshal(jwtError{Error: err.Error()})
+		w.Write(jsonResponse)
+	}
+}
+
+// viewerID returns the id of the user making the request, or "" when the
+// request has no valid bearer token. it is for endpoints that are public but
+// personalise their response for signed in users.
+func (cfg *APIConfig) viewerID(r *http.Request) string {
+	userID, err := cfg.scopedUserID(r, auth.ScopeChirpsRead)
+	if err != nil {
+		return ""
+	}
+	return userID.String()
+}
+
+// clientIP returns the address the request came from. forwarding headers are
+// ignored because any client can set them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
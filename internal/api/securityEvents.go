@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+const (
+	// securityEventRefreshTokenReuse is recorded when a refresh token that has
+	// already been rotated is presented again, which means it was copied
+	securityEventRefreshTokenReuse = "refresh_token_reuse"
+	// securityEventChirpModerated is recorded for the author of a chirp that
+	// a moderator removed
+	securityEventChirpModerated = "chirp_moderated"
+	// securityEventRoleChanged is recorded for a user whose role an admin
+	// changed
+	securityEventRoleChanged = "role_changed"
+	// securityEventPasswordReset is recorded when a user sets a new password
+	// with an emailed reset token
+	securityEventPasswordReset = "password_reset"
+	// securityEventEmailChanged is recorded when a user confirms a new email
+	securityEventEmailChanged = "email_changed"
+	// securityEventTwoFactorEnabled and securityEventTwoFactorDisabled are
+	// recorded when a user turns TOTP two-factor on or off
+	securityEventTwoFactorEnabled  = "two_factor_enabled"
+	securityEventTwoFactorDisabled = "two_factor_disabled"
+	// securityEventRecoveryCodeUsed is recorded when a login gets past
+	// two-factor with a recovery code instead of the authenticator app
+	securityEventRecoveryCodeUsed = "recovery_code_used"
+	// securityEventAccountLocked is recorded when failed logins lock an
+	// account, and securityEventAccountUnlocked when an admin clears it
+	securityEventAccountLocked   = "account_locked"
+	securityEventAccountUnlocked = "account_unlocked"
+)
+
+// recordSecurityEvent adds an entry to the user's security log
+func (cfg *APIConfig) recordSecurityEvent(ctx context.Context, userID, eventType, details string) error {
+	_, err := cfg.dbQueries.CreateSecurityEvent(ctx, database.CreateSecurityEventParams{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		EventType: eventType,
+		Details:   details,
+		CreatedAt: time.Now().UTC(),
+	})
+	return err
+}
+
+// revokeReusedRefreshToken handles a rotated refresh token being presented
+// again. we can't tell whether the client or an attacker holds the live token
+// in its family, so the whole family is revoked and both have to log in again.
+func (cfg *APIConfig) revokeReusedRefreshToken(ctx context.Context, token database.RefreshToken) error {
+	_, err := cfg.dbQueries.RevokeRefreshTokenFamily(ctx, database.RevokeRefreshTokenFamilyParams{
+		FamilyID:  token.FamilyID,
+		RevokedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	return cfg.recordSecurityEvent(ctx, token.UserID, securityEventRefreshTokenReuse,
+		fmt.Sprintf("refresh token family %s revoked after a rotated token was reused", token.FamilyID))
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+)
+
+// refreshTokenCookiePath limits the refresh token cookie to the api, where
+// /api/refresh and /api/revoke read it
+const refreshTokenCookiePath = "/api"
+
+// requestToken returns the access token a request was made with, from the
+// Authorization header or the session cookie. requests authenticated by the
+// cookie have to pass the CSRF check too.
+func requestToken(r *http.Request) (string, error) {
+	token, fromCookie, err := auth.GetSessionToken(r, auth.AccessTokenCookie)
+	if err != nil {
+		return "", err
+	}
+	if fromCookie {
+		if err := auth.CheckCSRF(r); err != nil {
+			return "", err
+		}
+	}
+	return token, nil
+}
+
+// setSessionCookies gives a browser its tokens as cookies rather than in the
+// response body, so scripts on the page never see them. the CSRF token the
+// request already had is kept, so requests in flight during a refresh still
+// pass; otherwise a new one is made. it returns the CSRF token for the body.
+func setSessionCookies(w http.ResponseWriter, r *http.Request, accessToken string, accessExpiresAt time.Time, refreshToken string, refreshExpiresAt time.Time) (string, error) {
+	csrfToken := ""
+	if c, err := r.Cookie(auth.CSRFCookie); err == nil && auth.CheckCSRF(r) == nil {
+		csrfToken = c.Value
+	}
+	if csrfToken == "" {
+		var err error
+		csrfToken, err = auth.MakeCSRFToken()
+		if err != nil {
+			return "", err
+		}
+	}
+	http.SetCookie(w, sessionCookie(auth.AccessTokenCookie, accessToken, "/", accessExpiresAt, true))
+	http.SetCookie(w, sessionCookie(auth.RefreshTokenCookie, refreshToken, refreshTokenCookiePath, refreshExpiresAt, true))
+	http.SetCookie(w, sessionCookie(auth.CSRFCookie, csrfToken, "/", refreshExpiresAt, false))
+	return csrfToken, nil
+}
+
+// clearSessionCookies tells the browser to forget its session
+func clearSessionCookies(w http.ResponseWriter) {
+	for _, c := range []*http.Cookie{
+		sessionCookie(auth.AccessTokenCookie, "", "/", time.Time{}, true),
+		sessionCookie(auth.RefreshTokenCookie, "", refreshTokenCookiePath, time.Time{}, true),
+		sessionCookie(auth.CSRFCookie, "", "/", time.Time{}, false),
+	} {
+		c.MaxAge = -1
+		http.SetCookie(w, c)
+	}
+}
+
+func sessionCookie(name, value, path string, expiresAt time.Time, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Expires:  expiresAt,
+		HttpOnly: httpOnly,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
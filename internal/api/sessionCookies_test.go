@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+)
+
+// cookieLogin logs in asking for cookies and returns them with the CSRF token
+func cookieLogin(t *testing.T, cfg *APIConfig, email, password string) (map[string]*http.Cookie, string) {
+	t.Helper()
+	rec := serve(cfg.HandleAuthenticateUser, newJSONRequest(t, "POST", "/api/login", map[string]any{
+		"email":       email,
+		"password":    password,
+		"use_cookies": true,
+	}))
+	expectStatus(t, rec, http.StatusOK)
+	login := decodeResponse[userResponse](t, rec)
+	if login.Token != "" || login.RefreshToken != "" || login.CSRFToken == "" {
+		t.Fatalf("Expected only a CSRF token in the body, got %s", rec.Body.String())
+	}
+	return responseCookies(rec), login.CSRFToken
+}
+
+func responseCookies(rec *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+	for _, c := range rec.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+	return cookies
+}
+
+func withCookies(req *http.Request, cookies map[string]*http.Cookie, csrfToken string) *http.Request {
+	for _, c := range cookies {
+		req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	if csrfToken != "" {
+		req.Header.Set(auth.CSRFHeader, csrfToken)
+	}
+	return req
+}
+
+func TestCookieLogin(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	createTestUser(t, cfg, "lydia@example.com", "madrigal-tea")
+	cookies, csrfToken := cookieLogin(t, cfg, "lydia@example.com", "madrigal-tea")
+
+	for _, name := range []string{auth.AccessTokenCookie, auth.RefreshTokenCookie, auth.CSRFCookie} {
+		c, ok := cookies[name]
+		if !ok || c.Value == "" {
+			t.Fatalf("Expected a %s cookie, got %+v", name, cookies)
+		}
+		if !c.Secure || c.SameSite != http.SameSiteStrictMode {
+			t.Errorf("Expected %s to be Secure and SameSite=Strict, got %+v", name, c)
+		}
+		// the page has to read the CSRF cookie, and must not read the tokens
+		if c.HttpOnly != (name != auth.CSRFCookie) {
+			t.Errorf("Unexpected HttpOnly on %s: %+v", name, c)
+		}
+	}
+	if cookies[auth.CSRFCookie].Value != csrfToken {
+		t.Fatalf("Expected the CSRF cookie to match the body")
+	}
+
+	// reads only need the cookie
+	rec := serve(cfg.HandleGetTimeline, withCookies(httptest.NewRequest("GET", "/api/timeline", nil), cookies, ""))
+	expectStatus(t, rec, http.StatusOK)
+
+	// writes need the CSRF header as well
+	post := func(csrf string) int {
+		req := withCookies(newJSONRequest(t, "POST", "/api/chirps", map[string]string{"body": "hello"}), cookies, csrf)
+		return serve(cfg.HandleCreateChirp, req).Code
+	}
+	if code := post(""); code != http.StatusForbidden {
+		t.Fatalf("Expected a write without a CSRF token to be refused, got %d", code)
+	}
+	if code := post("forged"); code != http.StatusForbidden {
+		t.Fatalf("Expected a write with the wrong CSRF token to be refused, got %d", code)
+	}
+	if code := post(csrfToken); code != http.StatusCreated {
+		t.Fatalf("Expected a write with the CSRF token to work, got %d", code)
+	}
+}
+
+func TestCookieRefreshAndRevoke(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	createTestUser(t, cfg, "todd@example.com", "vamonos-pest")
+	cookies, csrfToken := cookieLogin(t, cfg, "todd@example.com", "vamonos-pest")
+
+	rec := serve(cfg.HandleTokenRefresh, withCookies(newJSONRequest(t, "POST", "/api/refresh", nil), cookies, ""))
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = serve(cfg.HandleTokenRefresh, withCookies(newJSONRequest(t, "POST", "/api/refresh", nil), cookies, csrfToken))
+	expectStatus(t, rec, http.StatusOK)
+	refreshed := decodeResponse[struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		CSRFToken    string `json:"csrf_token"`
+	}](t, rec)
+	if refreshed.Token != "" || refreshed.RefreshToken != "" || refreshed.CSRFToken != csrfToken {
+		t.Fatalf("Expected the tokens to stay in cookies and the CSRF token to be kept, got %+v", refreshed)
+	}
+	rotated := responseCookies(rec)
+	if rotated[auth.RefreshTokenCookie].Value == cookies[auth.RefreshTokenCookie].Value {
+		t.Fatalf("Expected a new refresh token cookie")
+	}
+
+	rec = serve(cfg.HandleTokenRevoke, withCookies(newJSONRequest(t, "POST", "/api/revoke", nil), rotated, csrfToken))
+	expectStatus(t, rec, http.StatusNoContent)
+	for name, c := range responseCookies(rec) {
+		if c.MaxAge >= 0 || c.Value != "" {
+			t.Fatalf("Expected %s to be cleared, got %+v", name, c)
+		}
+	}
+	rec = serve(cfg.HandleTokenRefresh, withCookies(newJSONRequest(t, "POST", "/api/refresh", nil), rotated, csrfToken))
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
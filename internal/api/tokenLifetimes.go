@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+// tokenLifetimes is the server's policy for how long tokens last. clients can
+// ask for a shorter access token, or a longer one up to MaxAccess, but they
+// have no say over refresh tokens.
+type tokenLifetimes struct {
+	// Access is the access token lifetime when the client doesn't ask for one
+	Access    time.Duration
+	MaxAccess time.Duration
+	// RefreshSliding is how long a refresh token lasts from when it was
+	// issued. each refresh issues a new one, so an active session keeps
+	// going.
+	RefreshSliding time.Duration
+	// RefreshAbsolute caps a session however active it is, counted from the
+	// login that started it
+	RefreshAbsolute time.Duration
+	// RefreshIdle ends a session that hasn't refreshed for this long, or 0 for
+	// no idle timeout. unlike the others it is checked when a token is used,
+	// so lowering it applies to tokens that were already issued.
+	RefreshIdle time.Duration
+	// JanitorInterval is how often expired refresh tokens are deleted
+	JanitorInterval time.Duration
+}
+
+func defaultTokenLifetimes() tokenLifetimes {
+	return tokenLifetimes{
+		Access:          time.Hour,
+		MaxAccess:       24 * time.Hour,
+		RefreshSliding:  30 * 24 * time.Hour,
+		RefreshAbsolute: 90 * 24 * time.Hour,
+		JanitorInterval: time.Hour,
+	}
+}
+
+// loadTokenLifetimes reads the policy from ACCESS_TOKEN_TTL,
+// ACCESS_TOKEN_MAX_TTL, REFRESH_TOKEN_TTL, REFRESH_TOKEN_MAX_LIFETIME,
+// REFRESH_TOKEN_IDLE_TIMEOUT and REFRESH_TOKEN_JANITOR_INTERVAL, all Go
+// durations
+func loadTokenLifetimes() (tokenLifetimes, error) {
+	lifetimes := defaultTokenLifetimes()
+	for _, setting := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"ACCESS_TOKEN_TTL", &lifetimes.Access},
+		{"ACCESS_TOKEN_MAX_TTL", &lifetimes.MaxAccess},
+		{"REFRESH_TOKEN_TTL", &lifetimes.RefreshSliding},
+		{"REFRESH_TOKEN_MAX_LIFETIME", &lifetimes.RefreshAbsolute},
+		{"REFRESH_TOKEN_IDLE_TIMEOUT", &lifetimes.RefreshIdle},
+		{"REFRESH_TOKEN_JANITOR_INTERVAL", &lifetimes.JanitorInterval},
+	} {
+		if err := envDuration(setting.name, setting.dst); err != nil {
+			return lifetimes, err
+		}
+	}
+	if lifetimes.MaxAccess < lifetimes.Access {
+		return lifetimes, fmt.Errorf("ACCESS_TOKEN_MAX_TTL (%v) must be at least ACCESS_TOKEN_TTL (%v)", lifetimes.MaxAccess, lifetimes.Access)
+	}
+	if lifetimes.RefreshAbsolute < lifetimes.RefreshSliding {
+		return lifetimes, fmt.Errorf("REFRESH_TOKEN_MAX_LIFETIME (%v) must be at least REFRESH_TOKEN_TTL (%v)", lifetimes.RefreshAbsolute, lifetimes.RefreshSliding)
+	}
+	return lifetimes, nil
+}
+
+// accessTTL returns the lifetime for an access token the client asked to
+// last requestedSeconds, where 0 or less means it didn't ask
+func (l tokenLifetimes) accessTTL(requestedSeconds int) time.Duration {
+	if requestedSeconds <= 0 {
+		return l.Access
+	}
+	return min(time.Duration(requestedSeconds)*time.Second, l.MaxAccess)
+}
+
+// refreshExpiresAt returns when a refresh token issued now expires, for a
+// session that started at familyCreatedAt
+func (l tokenLifetimes) refreshExpiresAt(now, familyCreatedAt time.Time) time.Time {
+	expiresAt := now.Add(l.RefreshSliding)
+	if absolute := familyCreatedAt.Add(l.RefreshAbsolute); absolute.Before(expiresAt) {
+		return absolute
+	}
+	return expiresAt
+}
+
+// refreshExpired returns why a refresh token can no longer be used, or ""
+func (l tokenLifetimes) refreshExpired(token database.RefreshToken, now time.Time) string {
+	switch {
+	case token.ExpiresAt.Before(now):
+		return "Refresh token expired"
+	case !token.FamilyCreatedAt.Add(l.RefreshAbsolute).After(now):
+		return "Session has reached its maximum lifetime"
+	// the live token in a family was issued the last time it was used
+	case l.RefreshIdle > 0 && !token.CreatedAt.Add(l.RefreshIdle).After(now):
+		return "Session expired after being idle"
+	}
+	return ""
+}
+
+// liveSessionsParams finds the refresh tokens of userID's sessions that
+// refreshExpired would still accept at now
+func (l tokenLifetimes) liveSessionsParams(userID string, now time.Time) database.ListActiveRefreshTokensByUserIDParams {
+	params := database.ListActiveRefreshTokensByUserIDParams{
+		UserID:             userID,
+		Now:                now,
+		FamilyCreatedAfter: now.Add(-l.RefreshAbsolute),
+	}
+	if l.RefreshIdle > 0 {
+		params.CreatedAfter = now.Add(-l.RefreshIdle)
+	}
+	return params
+}
+
+// RunRefreshTokenJanitor deletes expired refresh tokens every
+// JanitorInterval until ctx is done. run it in its own goroutine.
+func (cfg *APIConfig) RunRefreshTokenJanitor(ctx context.Context) {
+	ticker := time.NewTicker(cfg.tokenLifetimes.JanitorInterval)
+	defer ticker.Stop()
+	for {
+		if err := cfg.deleteExpiredRefreshTokens(ctx); err != nil {
+			log.Printf("error deleting expired refresh tokens: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *APIConfig) deleteExpiredRefreshTokens(ctx context.Context) error {
+	deleted, err := cfg.dbQueries.DeleteExpiredRefreshTokens(ctx, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("deleted %d expired refresh tokens", deleted)
+	}
+	return nil
+}
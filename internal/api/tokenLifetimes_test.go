@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+func TestTokenLifetimesPolicy(t *testing.T) {
+	l := tokenLifetimes{
+		Access:          time.Hour,
+		MaxAccess:       2 * time.Hour,
+		RefreshSliding:  24 * time.Hour,
+		RefreshAbsolute: 72 * time.Hour,
+		RefreshIdle:     12 * time.Hour,
+	}
+	if got := l.accessTTL(0); got != time.Hour {
+		t.Errorf("Expected the default access lifetime, got %v", got)
+	}
+	if got := l.accessTTL(60); got != time.Minute {
+		t.Errorf("Expected a shorter access lifetime to be honoured, got %v", got)
+	}
+	if got := l.accessTTL(365 * 24 * 3600); got != 2*time.Hour {
+		t.Errorf("Expected a long access lifetime to be capped, got %v", got)
+	}
+
+	login := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := l.refreshExpiresAt(login, login); !got.Equal(login.Add(24 * time.Hour)) {
+		t.Errorf("Expected a fresh session to slide, got %v", got)
+	}
+	late := login.Add(60 * time.Hour)
+	if got := l.refreshExpiresAt(late, login); !got.Equal(login.Add(72 * time.Hour)) {
+		t.Errorf("Expected the absolute lifetime to cap the expiry, got %v", got)
+	}
+
+	token := database.RefreshToken{CreatedAt: login, FamilyCreatedAt: login, ExpiresAt: login.Add(24 * time.Hour)}
+	tests := []struct {
+		at      time.Time
+		expired bool
+	}{
+		{login.Add(time.Hour), false},
+		{login.Add(13 * time.Hour), true},
+		{login.Add(25 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		if got := l.refreshExpired(token, tt.at) != ""; got != tt.expired {
+			t.Errorf("refreshExpired at %v = %v, want %v", tt.at, got, tt.expired)
+		}
+	}
+	// an old session is refused even if its token says otherwise
+	token.FamilyCreatedAt = login.Add(-72 * time.Hour)
+	if l.refreshExpired(token, login.Add(time.Hour)) == "" {
+		t.Errorf("Expected a session past its absolute lifetime to be refused")
+	}
+}
+
+func TestLoginTokenLifetimes(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	createTestUser(t, cfg, "tuco@example.com", "tight-tight-tight")
+
+	before := time.Now()
+	rec := serve(cfg.HandleAuthenticateUser, newJSONRequest(t, "POST", "/api/login", map[string]any{
+		"email":              "tuco@example.com",
+		"password":           "tight-tight-tight",
+		"expires_in_seconds": 365 * 24 * 3600,
+	}))
+	expectStatus(t, rec, http.StatusOK)
+	login := decodeResponse[userResponse](t, rec)
+
+	claims, err := auth.ParseJWT(login.Token, cfg.tokenKeys)
+	if err != nil {
+		t.Fatalf("Error parsing token: %v", err)
+	}
+	if claims.ExpiresAt.After(before.Add(cfg.tokenLifetimes.MaxAccess + time.Minute)) {
+		t.Fatalf("Expected the access token to be capped at %v, expires %v", cfg.tokenLifetimes.MaxAccess, claims.ExpiresAt)
+	}
+
+	// the newest session is this login
+	sessions := listSessions(t, cfg, login.Token)
+	want := before.Add(cfg.tokenLifetimes.RefreshSliding)
+	if sessions[0].ExpiresAt.Before(want.Add(-time.Minute)) || sessions[0].ExpiresAt.After(want.Add(time.Minute)) {
+		t.Fatalf("Expected the refresh token to last %v whatever was asked, expires %v", cfg.tokenLifetimes.RefreshSliding, sessions[0].ExpiresAt)
+	}
+}
+
+func TestRefreshIdleTimeout(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "domingo@example.com", "krazy-eight")
+
+	// so short that the session is idle by the time it is refreshed
+	cfg.tokenLifetimes.RefreshIdle = time.Nanosecond
+	rec := serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+	expectStatus(t, rec, http.StatusUnauthorized)
+
+	cfg.tokenLifetimes.RefreshIdle = time.Hour
+	rec = serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestRefreshReuseAfterIdleTimeout(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "lydia@example.com", "stevia-tea")
+	rec := serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+	expectStatus(t, rec, http.StatusOK)
+	rotated := decodeResponse[userResponse](t, rec).RefreshToken
+
+	// a replayed token is reported as reuse even once the session has gone
+	// idle, and the session stays revoked when the timeout is lifted
+	cfg.tokenLifetimes.RefreshIdle = time.Nanosecond
+	rec = serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+	expectStatus(t, rec, http.StatusUnauthorized)
+	events, err := cfg.dbQueries.ListSecurityEventsByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Error listing security events: %v", err)
+	}
+	if len(events) != 1 || events[0].EventType != securityEventRefreshTokenReuse {
+		t.Fatalf("Expected a reuse security event, got %+v", events)
+	}
+
+	cfg.tokenLifetimes.RefreshIdle = 0
+	rec = serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), rotated))
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestRefreshTokenJanitor(t *testing.T) {
+	cfg := newTestAPIConfig(t)
+	user := createTestUser(t, cfg, "gale@example.com", "lab-notebook")
+	past := time.Now().UTC().Add(-48 * time.Hour)
+	_, err := cfg.dbQueries.CreateRefreshToken(context.Background(), database.CreateRefreshTokenParams{
+		ID:              "expired-refresh-token",
+		TokenHash:       auth.HashToken("expired-refresh-token"),
+		CreatedAt:       past,
+		UpdatedAt:       past,
+		UserID:          user.ID,
+		ExpiresAt:       past.Add(time.Hour),
+		FamilyID:        "expired-family",
+		FamilyCreatedAt: past,
+	})
+	if err != nil {
+		t.Fatalf("Error storing token: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// runs one sweep and returns because ctx is done
+	cfg.RunRefreshTokenJanitor(ctx)
+
+	if _, err := cfg.getRefreshToken(context.Background(), "expired-refresh-token"); err == nil {
+		t.Fatalf("Expected the expired token to be deleted")
+	}
+	rec := serve(cfg.HandleTokenRefresh, withBearer(newJSONRequest(t, "POST", "/api/refresh", nil), user.RefreshToken))
+	expectStatus(t, rec, http.StatusOK)
+}
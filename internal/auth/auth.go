@@ -2,7 +2,10 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
@@ -14,8 +17,9 @@ import (
 	"github.com/google/uuid"
 )
 
+// HashPassword hashes a password with DefaultPasswordParams
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	hashedPassword, err := HashPasswordWithParams(password, DefaultPasswordParams())
 	if err != nil {
 		return "", err
 	}
@@ -30,77 +34,117 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return same, nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-  token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256, 
-		jwt.RegisteredClaims{
-			Issuer: "chirpy",
-			IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-			Subject: userID.String(),
+// Claims are the claims in our access tokens
+type Claims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
+}
+
+// MakeJWT signs an access token with the keyring's current key
+func MakeJWT(userID uuid.UUID, role string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	key, err := keys.signingKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(
+		jwt.GetSigningMethod(key.algorithm),
+		Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer: Issuer,
+				IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+				Subject: userID.String(),
+			},
+			Role: role,
 		})
-	
-	signedToken, err := token.SignedString([]byte(tokenSecret))	
+	token.Header["kid"] = key.ID
+
+	signedToken, err := token.SignedString(key.privateKey)
 	if err != nil {
 		return "", err
 	}
 	return signedToken, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
+// ValidateJWT checks a token and returns the id of the user it was issued to
+func ValidateJWT(tokenString string, keys *Keyring) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, keys)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(claims.Subject)
+}
+
+// ParseJWT checks a token against the key named by its kid header and returns
+// its claims. the token must use that key's algorithm, so a public key can
+// never be passed off as an HMAC secret.
+func ParseJWT(tokenString string, keys *Keyring) (*Claims, error) {
+	claims := Claims{}
 
 	parsed, err := jwt.ParseWithClaims(
-		tokenString, 
+		tokenString,
 		&claims,
 		func(token *jwt.Token) (any, error) {
-			return []byte(tokenSecret), nil
+			kid, _ := token.Header["kid"].(string)
+			key, err := keys.verificationKey(kid)
+			if err != nil {
+				return nil, err
+			}
+			if token.Method.Alg() != key.algorithm {
+				return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+			}
+			return key.publicKey, nil
 		},
+		jwt.WithIssuer(Issuer),
+		jwt.WithValidMethods([]string{AlgorithmEdDSA, AlgorithmRS256, AlgorithmHS256}),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(keys.now),
 	)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("error parsing token: %w", err)
+		return nil, fmt.Errorf("error parsing token: %w", err)
 	}
-	
-	parsedClaims, ok := parsed.Claims.(*jwt.RegisteredClaims)
+
+	parsedClaims, ok := parsed.Claims.(*Claims)
 	if !ok {
-		return uuid.Nil, errors.New("error casting claims")
+		return nil, errors.New("error casting claims")
 	}
-	return uuid.Parse(parsedClaims.Subject)
+	return parsedClaims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
-	bearerToken := headers.Get("Authorization")
-	if !strings.HasPrefix(bearerToken, "Bearer") {
-		return "", errors.New("invalid bearer token")
-	}
-	if bearerToken == "" {
-		return "", errors.New("no bearer token found")
-	}
-
-	trimmedToken := strings.TrimSpace(strings.TrimPrefix(bearerToken, "Bearer"))
-	if trimmedToken == "" {
-		return "", errors.New("empty bearer token")
-	}
-	return trimmedToken, nil
+	return GetAuthorization(headers, "Bearer", "bearer token")
 }
 
 func GetApiKey(headers http.Header) (string, error) {
-	apiKey := headers.Get("Authorization")
-	if !strings.HasPrefix(apiKey, "ApiKey") {
-		return "", errors.New("invalid api key")
+	return GetAuthorization(headers, "ApiKey", "api key")
+}
+
+// GetAuthorization returns the credentials from an Authorization header
+// using the given scheme, such as "Bearer". what names the credentials in
+// error messages.
+func GetAuthorization(headers http.Header, scheme, what string) (string, error) {
+	authorization := headers.Get("Authorization")
+	if authorization == "" {
+		return "", fmt.Errorf("no %s found", what)
 	}
-	if apiKey == "" {
-		return "", errors.New("no api key found")
+	if !strings.HasPrefix(authorization, scheme) {
+		return "", fmt.Errorf("invalid %s", what)
 	}
 
-	trimmedApiKey := strings.TrimSpace(strings.TrimPrefix(apiKey, "ApiKey"))
-	if trimmedApiKey == "" {
-		return "", errors.New("empty api key")
+	credentials := strings.TrimSpace(strings.TrimPrefix(authorization, scheme))
+	if credentials == "" {
+		return "", fmt.Errorf("empty %s", what)
 	}
-	return trimmedApiKey, nil
+	return credentials, nil
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeOpaqueToken()
+}
+
+// MakeOpaqueToken returns 32 random bytes encoded for use in urls. the tokens
+// it makes are bearer secrets, so store them with HashToken.
+func MakeOpaqueToken() (string, error) {
 	byteSequence := make([]byte, 32)
 	res, err := rand.Read(byteSequence)
 	if err != nil {
@@ -111,4 +155,18 @@ func MakeRefreshToken() (string, error) {
 	}
 	base64Encoded := base64.URLEncoding.EncodeToString(byteSequence)
 	return base64Encoded, nil
+}
+
+// HashToken returns the hex SHA-256 digest of a token. the tokens are random,
+// so unlike passwords they don't need a slow salted hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckTokenHash reports whether token is the one hash was made from. the
+// digests are compared in constant time, so a stored digest can't be
+// guessed a byte at a time from how long a comparison takes.
+func CheckTokenHash(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
 }
\ No newline at end of file
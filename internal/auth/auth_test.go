@@ -45,9 +45,9 @@ func TestCheckPasswordHash(t *testing.T) {
 
 func TestMakeJWT(t *testing.T) {
 	userID := uuid.New()
-	tokenSecret := "test-secret"
+	keys := newTestKeyring(t, NewHMACKey("test", []byte("test-secret")))
 	expiresIn := 1 * time.Hour
-	token, err := MakeJWT(userID, tokenSecret, expiresIn)
+	token, err := MakeJWT(userID, RoleUser, keys, expiresIn)
 	if err != nil {
 		t.Fatalf("Error making JWT: %v", err)
 	}
@@ -56,9 +56,9 @@ func TestMakeJWT(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	tokenSecret := "test-secret"
+	keys := newTestKeyring(t, NewHMACKey("test", []byte("test-secret")))
 	expiresIn := 1 * time.Hour
-	token, err := MakeJWT(userID, tokenSecret, expiresIn)
+	token, err := MakeJWT(userID, RoleUser, keys, expiresIn)
 	if err != nil {
 		t.Fatalf("Error making JWT: %v", err)
 	}
@@ -66,9 +66,9 @@ func TestValidateJWT(t *testing.T) {
 }
 
 func TestValidateJWTInvalidToken(t *testing.T) {
-	tokenSecret := "test-secret"
+	keys := newTestKeyring(t, NewHMACKey("test", []byte("test-secret")))
 	token := "invalid-token"
-	_, err := ValidateJWT(token, tokenSecret)
+	_, err := ValidateJWT(token, keys)
 	if err == nil {
 		t.Fatalf("Expected error validating JWT, got nil")
 	}
@@ -77,14 +77,14 @@ func TestValidateJWTInvalidToken(t *testing.T) {
 func TestCreateAndValidateJWT(t *testing.T) {
 	userID := uuid.New()
 	fmt.Println("userID [Created (prior to JWT)]:\n", userID)
-	tokenSecret := "test-secret"
+	keys := newTestKeyring(t, NewHMACKey("test", []byte("test-secret")))
 	expiresIn := 1 * time.Hour
-	token, err := MakeJWT(userID, tokenSecret, expiresIn)
+	token, err := MakeJWT(userID, RoleUser, keys, expiresIn)
 	if err != nil {
 		t.Fatalf("Error making JWT: %v", err)
 	}
 	fmt.Println("token [TestCreateAndValidateJWT]:\n", token)
-	userID, err = ValidateJWT(token, tokenSecret)
+	userID, err = ValidateJWT(token, keys)
 	if err != nil {
 		t.Fatalf("Error validating JWT: %v", err)
 	}
@@ -127,4 +127,70 @@ func TestMakeRefreshToken(t *testing.T) {
 		t.Fatalf("Error making refresh token: %v", err)
 	}
 	fmt.Println("token [TestMakeRefreshToken]:\n", token)
-}
\ No newline at end of file
+}
+func TestHashToken(t *testing.T) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		t.Fatalf("Error making token: %v", err)
+	}
+	hash := HashToken(token)
+	if len(hash) != 64 || hash != HashToken(token) {
+		t.Fatalf("Expected a stable 64 character hex digest, got %q", hash)
+	}
+	if hash == HashToken(token+"x") {
+		t.Fatalf("Expected different tokens to hash differently")
+	}
+	if !CheckTokenHash(token, hash) || CheckTokenHash(token+"x", hash) || CheckTokenHash(token, "") {
+		t.Fatalf("Expected only the token itself to match its digest")
+	}
+}
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role, required string
+		want           bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleModerator, true},
+		{RoleAdmin, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{"", RoleUser, false},
+		{"root", RoleUser, false},
+	}
+	for _, tt := range tests {
+		if got := HasRole(tt.role, tt.required); got != tt.want {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestGetApiKey(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("Authorization", "ApiKey test-key")
+	key, err := GetApiKey(headers)
+	if err != nil || key != "test-key" {
+		t.Fatalf("Expected 'test-key', got %q %v", key, err)
+	}
+	// a bearer token isn't an api key
+	headers.Set("Authorization", "Bearer test-key")
+	if _, err := GetApiKey(headers); err == nil {
+		t.Fatalf("Expected error for the wrong scheme, got nil")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	stored := FormatScopes([]string{ScopeChirpsWrite, ScopeChirpsRead, ScopeChirpsWrite})
+	if stored != "chirps:read chirps:write" {
+		t.Fatalf("Expected sorted scopes without duplicates, got %q", stored)
+	}
+	if !HasScope(stored, ScopeChirpsRead) || HasScope(stored, ScopeUsersWrite) {
+		t.Fatalf("Unexpected HasScope results for %q", stored)
+	}
+	if ValidScope("chirps:delete") {
+		t.Fatalf("Expected unknown scopes to be invalid")
+	}
+	token, err := MakePersonalAccessToken()
+	if err != nil || !IsPersonalAccessToken(token) {
+		t.Fatalf("Expected a prefixed token, got %q %v", token, err)
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// Cookies for browser sessions. the token cookies are HttpOnly so scripts on
+// the page can't read them; the CSRF cookie isn't, so the page can copy it
+// into the CSRFHeader of its requests.
+const (
+	AccessTokenCookie  = "chirpy_access_token"
+	RefreshTokenCookie = "chirpy_refresh_token"
+	CSRFCookie         = "chirpy_csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+// ErrCSRFToken is returned when a request authenticated by cookie doesn't
+// carry a CSRF header matching its CSRF cookie
+var ErrCSRFToken = errors.New("Missing or invalid CSRF token")
+
+// GetSessionToken returns the token from the Authorization header, or when
+// there is no header, from the named cookie. fromCookie reports which it was,
+// because the browser sends cookies whichever site made the request.
+func GetSessionToken(r *http.Request, cookie string) (token string, fromCookie bool, err error) {
+	if r.Header.Get("Authorization") != "" {
+		token, err := GetBearerToken(r.Header)
+		return token, false, err
+	}
+	c, err := r.Cookie(cookie)
+	if err != nil || c.Value == "" {
+		return "", false, errors.New("no Authorization header or session cookie found")
+	}
+	return c.Value, true, nil
+}
+
+// MakeCSRFToken returns a token for the double-submit CSRF check
+func MakeCSRFToken() (string, error) {
+	return MakeOpaqueToken()
+}
+
+// CheckCSRF is the double-submit check for requests authenticated by cookie.
+// another site can make the browser send our cookies but can't read them, so
+// it can't put the CSRF cookie's value in the header. requests that don't
+// change anything are let through.
+func CheckCSRF(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	c, err := r.Cookie(CSRFCookie)
+	if err != nil || c.Value == "" {
+		return ErrCSRFToken
+	}
+	header := r.Header.Get(CSRFHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(c.Value)) != 1 {
+		return ErrCSRFToken
+	}
+	return nil
+}
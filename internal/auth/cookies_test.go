@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetSessionToken(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/chirps", nil)
+	if _, _, err := GetSessionToken(req, AccessTokenCookie); err == nil {
+		t.Fatalf("Expected an error without a header or cookie")
+	}
+
+	req.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: "from-cookie"})
+	token, fromCookie, err := GetSessionToken(req, AccessTokenCookie)
+	if err != nil || token != "from-cookie" || !fromCookie {
+		t.Fatalf("Expected the cookie token, got %q %v %v", token, fromCookie, err)
+	}
+
+	// the header wins, so api clients are never held to the CSRF check
+	req.Header.Set("Authorization", "Bearer from-header")
+	token, fromCookie, err = GetSessionToken(req, AccessTokenCookie)
+	if err != nil || token != "from-header" || fromCookie {
+		t.Fatalf("Expected the header token, got %q %v %v", token, fromCookie, err)
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	request := func(method, cookie, header string) *http.Request {
+		req := httptest.NewRequest(method, "/api/chirps", nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: cookie})
+		}
+		if header != "" {
+			req.Header.Set(CSRFHeader, header)
+		}
+		return req
+	}
+	tests := []struct {
+		name   string
+		req    *http.Request
+		wantOK bool
+	}{
+		{name: "safe method", req: request("GET", "", ""), wantOK: true},
+		{name: "matching", req: request("POST", "csrf", "csrf"), wantOK: true},
+		{name: "no header", req: request("POST", "csrf", ""), wantOK: false},
+		{name: "no cookie", req: request("DELETE", "", "csrf"), wantOK: false},
+		{name: "mismatch", req: request("PUT", "csrf", "other"), wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCSRF(tt.req)
+			if tt.wantOK && err != nil {
+				t.Fatalf("Expected the request to pass, got %v", err)
+			}
+			if !tt.wantOK && !errors.Is(err, ErrCSRFToken) {
+				t.Fatalf("Expected ErrCSRFToken, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+)
+
+// Issuer is set on every token we sign and required on every token we accept
+const Issuer = "chirpy"
+
+// algorithms a SigningKey can use, as they appear in a token's alg header
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+	AlgorithmHS256 = "HS256"
+)
+
+// SigningKey is one key in a Keyring, identified by the kid header of the
+// tokens it signs. a key signs new tokens from ActiveFrom until a newer key
+// becomes active, and verifies tokens until RetireAt. a zero RetireAt never
+// retires.
+type SigningKey struct {
+	ID         string
+	ActiveFrom time.Time
+	RetireAt   time.Time
+
+	algorithm  string
+	privateKey any
+	publicKey  any
+}
+
+func NewEd25519Key(id string, key ed25519.PrivateKey) SigningKey {
+	return SigningKey{ID: id, algorithm: AlgorithmEdDSA, privateKey: key, publicKey: key.Public()}
+}
+
+func NewRSAKey(id string, key *rsa.PrivateKey) SigningKey {
+	return SigningKey{ID: id, algorithm: AlgorithmRS256, privateKey: key, publicKey: &key.PublicKey}
+}
+
+// NewHMACKey makes a shared secret key. its tokens can only be verified by
+// services that hold the secret, so it is never published in the JWKS.
+func NewHMACKey(id string, secret []byte) SigningKey {
+	return SigningKey{ID: id, algorithm: AlgorithmHS256, privateKey: secret, publicKey: secret}
+}
+
+// ParseSigningKey reads a PEM encoded Ed25519 or RSA private key, as written
+// by `openssl genpkey`
+func ParseSigningKey(id string, pemBytes []byte) (SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("key %s: no PEM block found", id)
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("key %s: %w", id, err)
+		}
+		return NewRSAKey(id, key), nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("key %s: %w", id, err)
+	}
+	switch key := parsed.(type) {
+	case ed25519.PrivateKey:
+		return NewEd25519Key(id, key), nil
+	case *rsa.PrivateKey:
+		return NewRSAKey(id, key), nil
+	default:
+		return SigningKey{}, fmt.Errorf("key %s: unsupported key type %T", id, parsed)
+	}
+}
+
+func (k SigningKey) Algorithm() string {
+	return k.algorithm
+}
+
+func (k SigningKey) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// Keyring holds the keys tokens are signed and verified with
+type Keyring struct {
+	keys map[string]SigningKey
+	now  func() time.Time
+}
+
+func NewKeyring(keys ...SigningKey) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring has no keys")
+	}
+	keyring := &Keyring{keys: map[string]SigningKey{}, now: time.Now}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("every key needs an id")
+		}
+		if key.algorithm == "" {
+			return nil, fmt.Errorf("key %s has no key material", key.ID)
+		}
+		if _, ok := keyring.keys[key.ID]; ok {
+			return nil, fmt.Errorf("key id %s is used twice", key.ID)
+		}
+		keyring.keys[key.ID] = key
+	}
+	return keyring, nil
+}
+
+// keyringFile is the JSON format read by LoadKeyring
+type keyringFile struct {
+	Keys []struct {
+		ID             string    `json:"kid"`
+		PrivateKeyFile string    `json:"private_key_file"`
+		ActiveFrom     time.Time `json:"active_from"`
+		RetireAt       time.Time `json:"retire_at"`
+	} `json:"keys"`
+}
+
+// LoadKeyring reads a keyring file listing each key's id, PEM file and
+// schedule. rotating means adding a new key with a future active_from, then
+// setting a retire_at on the old one once the tokens it signed have expired.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error decoding keyring %s: %w", path, err)
+	}
+	keys := make([]SigningKey, 0, len(file.Keys))
+	for _, entry := range file.Keys {
+		pemBytes, err := os.ReadFile(entry.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseSigningKey(entry.ID, pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		key.ActiveFrom = entry.ActiveFrom
+		key.RetireAt = entry.RetireAt
+		keys = append(keys, key)
+	}
+	return NewKeyring(keys...)
+}
+
+// signingKey returns the most recently activated key that isn't retired
+func (k *Keyring) signingKey() (SigningKey, error) {
+	now := k.now()
+	var current SigningKey
+	found := false
+	for _, key := range k.keys {
+		if key.ActiveFrom.After(now) || key.retired(now) {
+			continue
+		}
+		// ties go to the lowest id so every server picks the same key
+		if !found || key.ActiveFrom.After(current.ActiveFrom) ||
+			(key.ActiveFrom.Equal(current.ActiveFrom) && key.ID < current.ID) {
+			current = key
+			found = true
+		}
+	}
+	if !found {
+		return SigningKey{}, errors.New("no active signing key")
+	}
+	return current, nil
+}
+
+// verificationKey returns the key a token says it was signed with. keys that
+// are scheduled but not yet active still verify, since other servers may
+// have a clock that is slightly ahead.
+func (k *Keyring) verificationKey(kid string) (SigningKey, error) {
+	key, ok := k.keys[kid]
+	if !ok {
+		return SigningKey{}, fmt.Errorf("unknown key id %q", kid)
+	}
+	if key.retired(k.now()) {
+		return SigningKey{}, fmt.Errorf("key %s is retired", kid)
+	}
+	return key, nil
+}
+
+// JWK is a public key in the format of RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that can verify tokens, including scheduled
+// keys so that verifiers have them before they start signing
+func (k *Keyring) JWKS() JWKS {
+	now := k.now()
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		if key.retired(now) {
+			continue
+		}
+		jwk := JWK{Use: "sig", KeyID: key.ID, Algorithm: key.algorithm}
+		switch public := key.publicKey.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			// shared secrets are not public
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	// map order is random; keep the document stable for caches
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestKeyring(t *testing.T, keys ...SigningKey) *Keyring {
+	t.Helper()
+	keyring, err := NewKeyring(keys...)
+	if err != nil {
+		t.Fatalf("Error making keyring: %v", err)
+	}
+	return keyring
+}
+
+func newTestEd25519Key(t *testing.T, id string) SigningKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	return NewEd25519Key(id, private)
+}
+
+func newTestRSAKey(t *testing.T, id string) SigningKey {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	return NewRSAKey(id, private)
+}
+
+func TestKeyringAlgorithms(t *testing.T) {
+	for _, key := range []SigningKey{
+		newTestEd25519Key(t, "ed"),
+		newTestRSAKey(t, "rsa"),
+		NewHMACKey("hmac", []byte("secret")),
+	} {
+		t.Run(key.Algorithm(), func(t *testing.T) {
+			keys := newTestKeyring(t, key)
+			userID := uuid.New()
+			token, err := MakeJWT(userID, RoleUser, keys, time.Hour)
+			if err != nil {
+				t.Fatalf("Error making JWT: %v", err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatalf("Error parsing JWT: %v", err)
+			}
+			if parsed.Header["kid"] != key.ID || parsed.Header["alg"] != key.Algorithm() {
+				t.Fatalf("Expected kid %s and alg %s, got %v", key.ID, key.Algorithm(), parsed.Header)
+			}
+			got, err := ValidateJWT(token, keys)
+			if err != nil || got != userID {
+				t.Fatalf("Expected %s, got %s (%v)", userID, got, err)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := newTestEd25519Key(t, "2024")
+	next := newTestEd25519Key(t, "2025")
+	next.ActiveFrom = now.Add(24 * time.Hour)
+	keys := newTestKeyring(t, old, next)
+	keys.now = func() time.Time { return now }
+
+	oldToken, err := MakeJWT(uuid.New(), RoleUser, keys, 72*time.Hour)
+	if err != nil {
+		t.Fatalf("Error making JWT: %v", err)
+	}
+	if jwks := keys.JWKS(); len(jwks.Keys) != 2 {
+		t.Fatalf("Expected the scheduled key to be published early, got %+v", jwks)
+	}
+
+	// the new key takes over signing and the old one still verifies
+	now = now.Add(25 * time.Hour)
+	newToken, err := MakeJWT(uuid.New(), RoleUser, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("Error making JWT: %v", err)
+	}
+	if kid := tokenKeyID(t, newToken); kid != "2025" {
+		t.Fatalf("Expected the new key to sign, got %s", kid)
+	}
+	if _, err := ValidateJWT(oldToken, keys); err != nil {
+		t.Fatalf("Expected the old key to verify until retired: %v", err)
+	}
+
+	// once retired the old key is gone from verification and the JWKS
+	old.RetireAt = now
+	keys = newTestKeyring(t, old, next)
+	keys.now = func() time.Time { return now }
+	if _, err := ValidateJWT(oldToken, keys); err == nil {
+		t.Fatalf("Expected tokens from a retired key to be rejected")
+	}
+	if jwks := keys.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "2025" {
+		t.Fatalf("Expected only the new key to be published, got %+v", jwks)
+	}
+}
+
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatalf("Error parsing JWT: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestValidateJWTRejects(t *testing.T) {
+	rsaKey := newTestRSAKey(t, "rsa")
+	keys := newTestKeyring(t, rsaKey)
+	claims := jwt.RegisteredClaims{
+		Issuer:    Issuer,
+		Subject:   uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+	sign := func(method jwt.SigningMethod, claims jwt.RegisteredClaims, kid string, key any) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Error signing: %v", err)
+		}
+		return signed
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: mustMarshalPKIX(t, rsaKey.publicKey)})
+
+	wrongIssuer := claims
+	wrongIssuer.Issuer = "someone-else"
+	noExpiry := claims
+	noExpiry.ExpiresAt = nil
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "wrong issuer", token: sign(jwt.SigningMethodRS256, wrongIssuer, "rsa", rsaKey.privateKey)},
+		{name: "no expiry", token: sign(jwt.SigningMethodRS256, noExpiry, "rsa", rsaKey.privateKey)},
+		{name: "unknown kid", token: sign(jwt.SigningMethodRS256, claims, "other", rsaKey.privateKey)},
+		// the classic confusion attack: HMAC keyed with the published public key
+		{name: "hmac with public key", token: sign(jwt.SigningMethodHS256, claims, "rsa", publicPEM)},
+		{name: "none", token: sign(jwt.SigningMethodNone, claims, "rsa", jwt.UnsafeAllowNoneSignatureType)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ValidateJWT(tt.token, keys); err == nil {
+				t.Fatalf("Expected the token to be rejected")
+			}
+		})
+	}
+}
+
+func mustMarshalPKIX(t *testing.T, key any) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("Error marshalling public key: %v", err)
+	}
+	return der
+}
+
+func TestJWKSPublicKeys(t *testing.T) {
+	edKey := newTestEd25519Key(t, "ed")
+	rsaKey := newTestRSAKey(t, "rsa")
+	keys := newTestKeyring(t, edKey, rsaKey, NewHMACKey("hmac", []byte("secret")))
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("Expected the shared secret to be left out, got %+v", jwks)
+	}
+	ed, rsaJWK := jwks.Keys[0], jwks.Keys[1]
+	if ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.Algorithm != AlgorithmEdDSA {
+		t.Fatalf("Unexpected Ed25519 JWK: %+v", ed)
+	}
+	if x, _ := base64.RawURLEncoding.DecodeString(ed.X); string(x) != string(edKey.publicKey.(ed25519.PublicKey)) {
+		t.Fatalf("Expected x to be the public key")
+	}
+	if rsaJWK.KeyType != "RSA" || rsaJWK.E != "AQAB" || rsaJWK.Algorithm != AlgorithmRS256 {
+		t.Fatalf("Unexpected RSA JWK: %+v", rsaJWK)
+	}
+	data, _ := json.Marshal(jwks)
+	if strings.Contains(string(data), "secret") {
+		t.Fatalf("Expected no secrets in the JWKS: %s", data)
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("Error marshalling key: %v", err)
+	}
+	keyPath := filepath.Join(dir, "2025.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Error writing key: %v", err)
+	}
+	keyringPath := filepath.Join(dir, "keyring.json")
+	keyring := `{"keys": [{"kid": "2025", "private_key_file": "` + keyPath + `", "active_from": "2025-01-01T00:00:00Z"}]}`
+	if err := os.WriteFile(keyringPath, []byte(keyring), 0o600); err != nil {
+		t.Fatalf("Error writing keyring: %v", err)
+	}
+
+	keys, err := LoadKeyring(keyringPath)
+	if err != nil {
+		t.Fatalf("Error loading keyring: %v", err)
+	}
+	token, err := MakeJWT(uuid.New(), RoleUser, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("Error making JWT: %v", err)
+	}
+	if kid := tokenKeyID(t, token); kid != "2025" {
+		t.Fatalf("Expected kid 2025, got %s", kid)
+	}
+}
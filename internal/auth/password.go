@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// PasswordParams are the argon2id costs new password hashes are made with.
+// hashes keep the params they were made with, so raising these only affects
+// existing passwords once they are rehashed, see NeedsRehash.
+type PasswordParams struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultPasswordParams are the argon2id package's defaults
+func DefaultPasswordParams() PasswordParams {
+	return PasswordParams{
+		Memory:      argon2id.DefaultParams.Memory,
+		Iterations:  argon2id.DefaultParams.Iterations,
+		Parallelism: argon2id.DefaultParams.Parallelism,
+	}
+}
+
+func (p PasswordParams) argon2id() *argon2id.Params {
+	return &argon2id.Params{
+		Memory:      p.Memory,
+		Iterations:  p.Iterations,
+		Parallelism: p.Parallelism,
+		SaltLength:  argon2id.DefaultParams.SaltLength,
+		KeyLength:   argon2id.DefaultParams.KeyLength,
+	}
+}
+
+// HashPasswordWithParams hashes a password with the given costs
+func HashPasswordWithParams(password string, params PasswordParams) (string, error) {
+	return argon2id.CreateHash(password, params.argon2id())
+}
+
+// NeedsRehash reports whether a hash was made with costs other than params.
+// call it after a password has been checked, while the plain text is at hand
+// to hash again.
+func NeedsRehash(hash string, params PasswordParams) (bool, error) {
+	current, salt, key, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+	want := params.argon2id()
+	return current.Memory != want.Memory ||
+		current.Iterations != want.Iterations ||
+		current.Parallelism != want.Parallelism ||
+		uint32(len(salt)) != want.SaltLength ||
+		uint32(len(key)) != want.KeyLength, nil
+}
+
+// PasswordPolicy is what a new password has to satisfy
+type PasswordPolicy struct {
+	MinLength int
+	// blocklist holds common passwords, lowercased
+	blocklist map[string]struct{}
+}
+
+func NewPasswordPolicy(minLength int, blocklist []string) *PasswordPolicy {
+	policy := &PasswordPolicy{MinLength: minLength, blocklist: make(map[string]struct{}, len(blocklist))}
+	for _, password := range blocklist {
+		policy.blocklist[strings.ToLower(password)] = struct{}{}
+	}
+	return policy
+}
+
+// LoadPasswordBlocklist reads a file of common passwords, one per line. blank
+// lines and lines starting with # are skipped.
+func LoadPasswordBlocklist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var passwords []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords = append(passwords, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading password blocklist %s: %w", path, err)
+	}
+	return passwords, nil
+}
+
+// Check returns an error saying why a password isn't allowed, or nil. the
+// error's message is meant for the user.
+func (p *PasswordPolicy) Check(password string) error {
+	// counted in characters rather than bytes, so a passphrase in any script
+	// is held to the same length
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", p.MinLength)
+	}
+	if _, ok := p.blocklist[strings.ToLower(password)]; ok {
+		return fmt.Errorf("Password is too common, choose another")
+	}
+	return nil
+}
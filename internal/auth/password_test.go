@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// cheapParams keeps the tests fast
+var cheapParams = PasswordParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1}
+
+func TestNeedsRehash(t *testing.T) {
+	hash, err := HashPasswordWithParams("correct horse", cheapParams)
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+	if stale, err := NeedsRehash(hash, cheapParams); err != nil || stale {
+		t.Fatalf("Expected a hash made with the current params to be kept, got %v %v", stale, err)
+	}
+	stronger := cheapParams
+	stronger.Iterations = 2
+	if stale, err := NeedsRehash(hash, stronger); err != nil || !stale {
+		t.Fatalf("Expected a hash made with older params to need a rehash, got %v %v", stale, err)
+	}
+	if _, err := NeedsRehash("not a hash", cheapParams); err == nil {
+		t.Fatalf("Expected an error for a malformed hash")
+	}
+
+	// the old hash still checks out until it is replaced
+	same, err := CheckPasswordHash("correct horse", hash)
+	if err != nil || !same {
+		t.Fatalf("Expected the old hash to still match, got %v %v", same, err)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("# common passwords\npassword1\n\n  Letmein123  \n"), 0o600); err != nil {
+		t.Fatalf("Error writing blocklist: %v", err)
+	}
+	blocklist, err := LoadPasswordBlocklist(path)
+	if err != nil {
+		t.Fatalf("Error loading blocklist: %v", err)
+	}
+	if len(blocklist) != 2 {
+		t.Fatalf("Expected comments and blank lines to be skipped, got %q", blocklist)
+	}
+	policy := NewPasswordPolicy(8, blocklist)
+
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{"short", false},
+		{"password1", false},
+		{"LETMEIN123", false},
+		{"correct horse", true},
+		// eight characters, more than eight bytes
+		{"пароль12", true},
+		{"пароль1", false},
+	}
+	for _, tt := range tests {
+		if err := policy.Check(tt.password); (err == nil) != tt.ok {
+			t.Errorf("Check(%q) = %v, want ok=%v", tt.password, err, tt.ok)
+		}
+	}
+}
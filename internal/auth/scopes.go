@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// Scopes limit what a personal access token can do. access tokens from a
+// login can do everything.
+const (
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+	ScopeUsersWrite  = "users:write"
+)
+
+var scopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeUsersWrite}
+
+// PersonalAccessTokenPrefix starts every personal access token, which tells
+// them apart from JWTs in the Authorization header and makes them easy to
+// spot if one is leaked
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+func ValidScope(scope string) bool {
+	return slices.Contains(scopes, scope)
+}
+
+// MakePersonalAccessToken returns a new random token. store it with HashToken.
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// FormatScopes joins scopes the way they are stored, sorted and without
+// duplicates
+func FormatScopes(granted []string) string {
+	granted = slices.Clone(granted)
+	slices.Sort(granted)
+	return strings.Join(slices.Compact(granted), " ")
+}
+
+func ParseScopes(stored string) []string {
+	return strings.Fields(stored)
+}
+
+// HasScope reports whether stored scopes include required
+func HasScope(stored, required string) bool {
+	return slices.Contains(ParseScopes(stored), required)
+}
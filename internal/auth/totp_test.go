@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key from the RFC 6238 test vectors
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, keeping the last six of the eight digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Error making code: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Error making secret: %v", err)
+	}
+	now := time.Now()
+	step := TOTPStep(now)
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := TOTPCode(secret, step+offset)
+		matched, ok := ValidateTOTP(secret, code, now)
+		if !ok || matched != step+offset {
+			t.Errorf("Expected the code for step %+d to match, got %d %v", offset, matched, ok)
+		}
+	}
+	stale, _ := TOTPCode(secret, step-3)
+	if _, ok := ValidateTOTP(secret, stale, now); ok {
+		t.Errorf("Expected a code from three periods ago to be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, "12345", now); ok {
+		t.Errorf("Expected a short code to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Chirpy", "walt@example.com", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:walt@example.com?") || !strings.Contains(uri, "secret=ABC") {
+		t.Fatalf("Unexpected uri %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("Error making codes: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 9 || seen[code] {
+			t.Fatalf("Expected distinct xxxx-xxxx codes, got %v", codes)
+		}
+		seen[code] = true
+		if NormalizeRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(code, "-", ""))+" ") != code {
+			t.Errorf("Expected %s to survive normalizing", code)
+		}
+	}
+}
@@ -7,19 +7,61 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
+
+	"github.com/lib/pq"
 )
 
+const countRepliesByChirpIDs = `-- name: CountRepliesByChirpIDs :many
+SELECT reply_to_id::varchar AS chirp_id, COUNT(*) AS reply_count FROM chirps
+WHERE reply_to_id = ANY($1::varchar[])
+    AND deleted_at IS NULL
+GROUP BY reply_to_id
+`
+
+type CountRepliesByChirpIDsRow struct {
+	ChirpID    string
+	ReplyCount int64
+}
+
+func (q *Queries) CountRepliesByChirpIDs(ctx context.Context, chirpIds []string) ([]CountRepliesByChirpIDsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countRepliesByChirpIDs, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountRepliesByChirpIDsRow
+	for rows.Next() {
+		var i CountRepliesByChirpIDsRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.ReplyCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id)
 VALUES (
     $1,
     $2,
     $3,
     $4,
-    $5
+    $5,
+    $6
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, search_vector, reply_to_id, deleted_at
 `
 
 type CreateChirpParams struct {
@@ -28,6 +70,7 @@ type CreateChirpParams struct {
 	UpdatedAt time.Time
 	Body      string
 	UserID    string
+	ReplyToID sql.NullString
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
@@ -37,6 +80,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		arg.UpdatedAt,
 		arg.Body,
 		arg.UserID,
+		arg.ReplyToID,
 	)
 	var i Chirp
 	err := row.Scan(
@@ -45,6 +89,9 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.ReplyToID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -67,8 +114,22 @@ func (q *Queries) DeleteChirp(ctx context.Context, id string) error {
 	return err
 }
 
+const deleteChirpIfNoReplies = `-- name: DeleteChirpIfNoReplies :execrows
+DELETE FROM chirps
+WHERE id = $1
+    AND NOT EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.reply_to_id = $1)
+`
+
+func (q *Queries) DeleteChirpIfNoReplies(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirpIfNoReplies, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, search_vector, reply_to_id, deleted_at FROM chirps ORDER BY created_at ASC
 `
 
 func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
@@ -86,6 +147,55 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.ReplyToID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors (id, depth) AS (
+    SELECT chirps.reply_to_id, 1 FROM chirps
+    WHERE chirps.id = $1 AND chirps.reply_to_id IS NOT NULL
+    UNION ALL
+    SELECT chirps.reply_to_id, ancestors.depth + 1 FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.id
+    WHERE chirps.reply_to_id IS NOT NULL AND ancestors.depth < 1000
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.reply_to_id, chirps.deleted_at FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC
+`
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, id string) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ReplyToID,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -101,7 +211,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1 LIMIT 1
+SELECT id, created_at, updated_at, body, user_id, search_vector, reply_to_id, deleted_at FROM chirps WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetChirpByID(ctx context.Context, id string) (Chirp, error) {
@@ -113,12 +223,15 @@ func (q *Queries) GetChirpByID(ctx context.Context, id string) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.ReplyToID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const getChirpsByUserID = `-- name: GetChirpsByUserID :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1
+SELECT id, created_at, updated_at, body, user_id, search_vector, reply_to_id, deleted_at FROM chirps WHERE user_id = $1
 `
 
 func (q *Queries) GetChirpsByUserID(ctx context.Context, userID string) ([]Chirp, error) {
@@ -136,6 +249,409 @@ func (q *Queries) GetChirpsByUserID(ctx context.Context, userID string) ([]Chirp
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.ReplyToID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpDescendants = `-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants (id, depth) AS (
+    SELECT chirps.id, 1 FROM chirps
+    WHERE chirps.reply_to_id = $1
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1 FROM chirps
+    JOIN descendants ON chirps.reply_to_id = descendants.id
+    WHERE descendants.depth < 1000
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.reply_to_id, chirps.deleted_at, descendants.depth::int AS depth FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+WHERE (chirps.created_at, chirps.id) > ($2::timestamp, $3::varchar)
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT $4
+`
+
+type ListChirpDescendantsParams struct {
+	ID              string
+	CursorCreatedAt time.Time
+	CursorID        string
+	PageSize        int32
+}
+
+type ListChirpDescendantsRow struct {
+	Chirp Chirp
+	Depth int32
+}
+
+func (q *Queries) ListChirpDescendants(ctx context.Context, arg ListChirpDescendantsParams) ([]ListChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpDescendants,
+		arg.ID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpDescendantsRow
+	for rows.Next() {
+		var i ListChirpDescendantsRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.ReplyToID,
+			&i.Chirp.DeletedAt,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, reply_to_id, deleted_at FROM chirps
+WHERE (created_at, id) > ($1::timestamp, $2::varchar)
+    AND created_at >= $3::timestamp
+    AND created_at < $4::timestamp
+    AND deleted_at IS NULL
+ORDER BY created_at ASC, id ASC
+LIMIT $5
+`
+
+type ListChirpsAscParams struct {
+	CursorCreatedAt time.Time
+	CursorID        string
+	Since           time.Time
+	Until           time.Time
+	PageSize        int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Since,
+		arg.Until,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ReplyToID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsByUserIDAsc = `-- name: ListChirpsByUserIDAsc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.reply_to_id, chirps.deleted_at, listings.rechirped_at FROM (
+    (SELECT chirps.id AS chirp_id, chirps.created_at AS listed_at, NULL::timestamp AS rechirped_at FROM chirps
+    WHERE chirps.user_id = $1
+        AND (chirps.created_at, chirps.id) > ($2::timestamp, $3::varchar)
+        AND chirps.created_at >= $4::timestamp
+        AND chirps.created_at < $5::timestamp
+        AND chirps.deleted_at IS NULL
+    ORDER BY chirps.created_at ASC, chirps.id ASC
+    LIMIT $6)
+    UNION ALL
+    (SELECT chirp_rechirps.chirp_id, chirp_rechirps.created_at, chirp_rechirps.created_at FROM chirp_rechirps
+    JOIN chirps ON chirps.id = chirp_rechirps.chirp_id
+    WHERE chirp_rechirps.user_id = $1
+        AND (chirp_rechirps.created_at, chirp_rechirps.chirp_id) > ($2::timestamp, $3::varchar)
+        AND chirp_rechirps.created_at >= $4::timestamp
+        AND chirp_rechirps.created_at < $5::timestamp
+        AND chirps.deleted_at IS NULL
+    ORDER BY chirp_rechirps.created_at ASC, chirp_rechirps.chirp_id ASC
+    LIMIT $6)
+) AS listings
+JOIN chirps ON chirps.id = listings.chirp_id
+ORDER BY listings.listed_at ASC, listings.chirp_id ASC
+LIMIT $6
+`
+
+type ListChirpsByUserIDAscParams struct {
+	UserID          string
+	CursorCreatedAt time.Time
+	CursorID        string
+	Since           time.Time
+	Until           time.Time
+	PageSize        int32
+}
+
+type ListChirpsByUserIDAscRow struct {
+	Chirp       Chirp
+	RechirpedAt sql.NullTime
+}
+
+// an author's listing holds their own chirps plus the ones they rechirped,
+// placed at the time of the rechirp. each branch applies the cursor and limit
+// itself so that it can read just one page from its (user_id, created_at)
+// index, and the merged branches are cut to a page again.
+func (q *Queries) ListChirpsByUserIDAsc(ctx context.Context, arg ListChirpsByUserIDAscParams) ([]ListChirpsByUserIDAscRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByUserIDAsc,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Since,
+		arg.Until,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpsByUserIDAscRow
+	for rows.Next() {
+		var i ListChirpsByUserIDAscRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.ReplyToID,
+			&i.Chirp.DeletedAt,
+			&i.RechirpedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsByUserIDDesc = `-- name: ListChirpsByUserIDDesc :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.reply_to_id, chirps.deleted_at, listings.rechirped_at FROM (
+    (SELECT chirps.id AS chirp_id, chirps.created_at AS listed_at, NULL::timestamp AS rechirped_at FROM chirps
+    WHERE chirps.user_id = $1
+        AND (chirps.created_at, chirps.id) < ($2::timestamp, $3::varchar)
+        AND chirps.created_at >= $4::timestamp
+        AND chirps.created_at < $5::timestamp
+        AND chirps.deleted_at IS NULL
+    ORDER BY chirps.created_at DESC, chirps.id DESC
+    LIMIT $6)
+    UNION ALL
+    (SELECT chirp_rechirps.chirp_id, chirp_rechirps.created_at, chirp_rechirps.created_at FROM chirp_rechirps
+    JOIN chirps ON chirps.id = chirp_rechirps.chirp_id
+    WHERE chirp_rechirps.user_id = $1
+        AND (chirp_rechirps.created_at, chirp_rechirps.chirp_id) < ($2::timestamp, $3::varchar)
+        AND chirp_rechirps.created_at >= $4::timestamp
+        AND chirp_rechirps.created_at < $5::timestamp
+        AND chirps.deleted_at IS NULL
+    ORDER BY chirp_rechirps.created_at DESC, chirp_rechirps.chirp_id DESC
+    LIMIT $6)
+) AS listings
+JOIN chirps ON chirps.id = listings.chirp_id
+ORDER BY listings.listed_at DESC, listings.chirp_id DESC
+LIMIT $6
+`
+
+type ListChirpsByUserIDDescParams struct {
+	UserID          string
+	CursorCreatedAt time.Time
+	CursorID        string
+	Since           time.Time
+	Until           time.Time
+	PageSize        int32
+}
+
+type ListChirpsByUserIDDescRow struct {
+	Chirp       Chirp
+	RechirpedAt sql.NullTime
+}
+
+// an author's listing holds their own chirps plus the ones they rechirped,
+// placed at the time of the rechirp. each branch applies the cursor and limit
+// itself so that it can read just one page from its (user_id, created_at)
+// index, and the merged branches are cut to a page again.
+func (q *Queries) ListChirpsByUserIDDesc(ctx context.Context, arg ListChirpsByUserIDDescParams) ([]ListChirpsByUserIDDescRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByUserIDDesc,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Since,
+		arg.Until,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpsByUserIDDescRow
+	for rows.Next() {
+		var i ListChirpsByUserIDDescRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.ReplyToID,
+			&i.Chirp.DeletedAt,
+			&i.RechirpedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, reply_to_id, deleted_at FROM chirps
+WHERE (created_at, id) < ($1::timestamp, $2::varchar)
+    AND created_at >= $3::timestamp
+    AND created_at < $4::timestamp
+    AND deleted_at IS NULL
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+`
+
+type ListChirpsDescParams struct {
+	CursorCreatedAt time.Time
+	CursorID        string
+	Since           time.Time
+	Until           time.Time
+	PageSize        int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Since,
+		arg.Until,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ReplyToID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTimelineChirps = `-- name: ListTimelineChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.reply_to_id, chirps.deleted_at FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1
+    AND (chirps.created_at, chirps.id) < ($2::timestamp, $3::varchar)
+    AND chirps.deleted_at IS NULL
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
+`
+
+type ListTimelineChirpsParams struct {
+	FollowerID      string
+	CursorCreatedAt time.Time
+	CursorID        string
+	PageSize        int32
+}
+
+func (q *Queries) ListTimelineChirps(ctx context.Context, arg ListTimelineChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listTimelineChirps,
+		arg.FollowerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.ReplyToID,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -150,8 +666,163 @@ func (q *Queries) GetChirpsByUserID(ctx context.Context, userID string) ([]Chirp
 	return items, nil
 }
 
+const searchChirps = `-- name: SearchChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.reply_to_id, chirps.deleted_at,
+    ts_rank(chirps.search_vector, search_query)::real AS rank,
+    -- the body is HTML escaped first so the snippet is safe to render
+    ts_headline('english', replace(replace(replace(chirps.body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+        search_query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')::text AS snippet
+FROM chirps, websearch_to_tsquery('english', $1::text) AS search_query
+WHERE chirps.search_vector @@ search_query
+    AND chirps.deleted_at IS NULL
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT $2 OFFSET $3
+`
+
+type SearchChirpsParams struct {
+	Query      string
+	PageSize   int32
+	PageOffset int32
+}
+
+type SearchChirpsRow struct {
+	Chirp   Chirp
+	Rank    float32
+	Snippet string
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps, arg.Query, arg.PageSize, arg.PageOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.ReplyToID,
+			&i.Chirp.DeletedAt,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirpsByUserID = `-- name: SearchChirpsByUserID :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.reply_to_id, chirps.deleted_at,
+    ts_rank(chirps.search_vector, search_query)::real AS rank,
+    -- the body is HTML escaped first so the snippet is safe to render
+    ts_headline('english', replace(replace(replace(chirps.body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+        search_query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')::text AS snippet
+FROM chirps, websearch_to_tsquery('english', $1::text) AS search_query
+WHERE chirps.user_id = $2
+    AND chirps.search_vector @@ search_query
+    AND chirps.deleted_at IS NULL
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT $3 OFFSET $4
+`
+
+type SearchChirpsByUserIDParams struct {
+	Query      string
+	UserID     string
+	PageSize   int32
+	PageOffset int32
+}
+
+type SearchChirpsByUserIDRow struct {
+	Chirp   Chirp
+	Rank    float32
+	Snippet string
+}
+
+func (q *Queries) SearchChirpsByUserID(ctx context.Context, arg SearchChirpsByUserIDParams) ([]SearchChirpsByUserIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirpsByUserID,
+		arg.Query,
+		arg.UserID,
+		arg.PageSize,
+		arg.PageOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsByUserIDRow
+	for rows.Next() {
+		var i SearchChirpsByUserIDRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.SearchVector,
+			&i.Chirp.ReplyToID,
+			&i.Chirp.DeletedAt,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tombstoneChirp = `-- name: TombstoneChirp :one
+WITH revisions AS (
+    DELETE FROM chirp_revisions WHERE chirp_revisions.chirp_id = $1
+)
+UPDATE chirps SET body = '', deleted_at = $2, updated_at = $3 WHERE id = $1 RETURNING chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.reply_to_id, chirps.deleted_at
+`
+
+type TombstoneChirpParams struct {
+	ID        string
+	DeletedAt sql.NullTime
+	UpdatedAt time.Time
+}
+
+// earlier revisions go too, so the deleted text can't be read from the history
+func (q *Queries) TombstoneChirp(ctx context.Context, arg TombstoneChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, tombstoneChirp, arg.ID, arg.DeletedAt, arg.UpdatedAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.ReplyToID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
 const updateChirp = `-- name: UpdateChirp :one
-UPDATE chirps SET body = $2, updated_at = $3 WHERE id = $1 RETURNING id, created_at, updated_at, body, user_id
+UPDATE chirps SET body = $2, updated_at = $3 WHERE id = $1 RETURNING id, created_at, updated_at, body, user_id, search_vector, reply_to_id, deleted_at
 `
 
 type UpdateChirpParams struct {
@@ -169,6 +840,54 @@ func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.ReplyToID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const updateChirpWithRevision = `-- name: UpdateChirpWithRevision :one
+WITH previous AS (
+    SELECT id, body, updated_at FROM chirps
+    WHERE id = $1 AND deleted_at IS NULL
+    FOR UPDATE
+), revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT $2, previous.id, previous.body, previous.updated_at, $3 FROM previous
+)
+UPDATE chirps SET body = $4, updated_at = $3
+FROM previous
+WHERE chirps.id = previous.id
+RETURNING chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.reply_to_id, chirps.deleted_at
+`
+
+type UpdateChirpWithRevisionParams struct {
+	ID         string
+	RevisionID string
+	UpdatedAt  time.Time
+	Body       string
+}
+
+// the previous body is saved as a revision in the same statement; the row
+// lock makes concurrent edits record each body they replaced
+func (q *Queries) UpdateChirpWithRevision(ctx context.Context, arg UpdateChirpWithRevisionParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpWithRevision,
+		arg.ID,
+		arg.RevisionID,
+		arg.UpdatedAt,
+		arg.Body,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.ReplyToID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
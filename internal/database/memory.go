@@ -0,0 +1,75 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a thread-safe, in-memory Store. It mirrors the behaviour of
+// the postgres schema closely enough for handler tests: primary keys, the
+// unique email constraint, foreign keys with ON DELETE CASCADE and
+// sql.ErrNoRows for missing rows.
+type MemoryStore struct {
+	mu                 sync.RWMutex
+	users              map[string]User
+	chirps             map[string]Chirp
+	refreshTokens      map[string]RefreshToken
+	follows            map[followKey]Follow
+	likes              map[chirpUserKey]ChirpLike
+	rechirps           map[chirpUserKey]ChirpRechirp
+	revisions          map[string]ChirpRevision
+	events             map[string]SecurityEvent
+	resetTokens        map[string]PasswordResetToken
+	magicLinkTokens    map[string]MagicLinkToken
+	verificationTokens map[string]EmailVerificationToken
+	totp               map[string]UserTotp
+	recoveryCodes      map[string]RecoveryCode
+	challenges         map[string]TwoFactorChallenge
+	loginAttempts      map[string]LoginAttempt
+	accessTokens       map[string]PersonalAccessToken
+	identities         map[string]UserIdentity
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:              map[string]User{},
+		chirps:             map[string]Chirp{},
+		refreshTokens:      map[string]RefreshToken{},
+		follows:            map[followKey]Follow{},
+		likes:              map[chirpUserKey]ChirpLike{},
+		rechirps:           map[chirpUserKey]ChirpRechirp{},
+		revisions:          map[string]ChirpRevision{},
+		events:             map[string]SecurityEvent{},
+		resetTokens:        map[string]PasswordResetToken{},
+		magicLinkTokens:    map[string]MagicLinkToken{},
+		verificationTokens: map[string]EmailVerificationToken{},
+		totp:               map[string]UserTotp{},
+		recoveryCodes:      map[string]RecoveryCode{},
+		challenges:         map[string]TwoFactorChallenge{},
+		loginAttempts:      map[string]LoginAttempt{},
+		accessTokens:       map[string]PersonalAccessToken{},
+		identities:         map[string]UserIdentity{},
+	}
+}
+
+// pgTime matches what a round trip through a postgres TIMESTAMP column does
+// to a time.Time: microsecond precision and no monotonic clock reading. the
+// column has no zone, so the offset is dropped and the wall clock comes back
+// as UTC.
+func pgTime(t time.Time) time.Time {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return wall.Truncate(time.Microsecond)
+}
+
+func uniqueViolation(constraint string) error {
+	return fmt.Errorf("duplicate key value violates unique constraint %q", constraint)
+}
+
+func foreignKeyViolation(table, constraint string) error {
+	return fmt.Errorf("insert or update on table %q violates foreign key constraint %q", table, constraint)
+}
+
+func checkViolation(table, constraint string) error {
+	return fmt.Errorf("new row for relation %q violates check constraint %q", table, constraint)
+}
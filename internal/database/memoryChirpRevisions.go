@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// deleteChirpRevisionsLocked drops the edit history of a chirp. callers must
+// hold m.mu.
+func (m *MemoryStore) deleteChirpRevisionsLocked(chirpID string) {
+	for id, revision := range m.revisions {
+		if revision.ChirpID == chirpID {
+			delete(m.revisions, id)
+		}
+	}
+}
+
+func (m *MemoryStore) ListChirpRevisions(ctx context.Context, chirpID string) ([]ChirpRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []ChirpRevision
+	for _, revision := range m.revisions {
+		if revision.ChirpID == chirpID {
+			items = append(items, revision)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if c := items[i].ReplacedAt.Compare(items[j].ReplacedAt); c != 0 {
+			return c < 0
+		}
+		return strings.Compare(items[i].ID, items[j].ID) < 0
+	})
+	return items, nil
+}
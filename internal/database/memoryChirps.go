@@ -0,0 +1,508 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// compareChirpPosition orders chirps by (created_at, id) like the row
+// comparisons in the list queries.
+func compareChirpPosition(createdAt time.Time, id string, cursorCreatedAt time.Time, cursorID string) int {
+	if c := createdAt.Compare(cursorCreatedAt); c != 0 {
+		return c
+	}
+	return strings.Compare(id, cursorID)
+}
+
+func sortChirps(chirps []Chirp, desc bool) {
+	sort.Slice(chirps, func(i, j int) bool {
+		c := compareChirpPosition(chirps[i].CreatedAt, chirps[i].ID, chirps[j].CreatedAt, chirps[j].ID)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+type memoryChirpQuery struct {
+	userID          string
+	desc            bool
+	cursorCreatedAt time.Time
+	cursorID        string
+	since           time.Time
+	until           time.Time
+	pageSize        int32
+}
+
+// listChirps returns chirps as rows of an author listing. when the query is
+// for one author, the chirps they rechirped are listed at the rechirp time.
+func (m *MemoryStore) listChirps(q memoryChirpQuery) []ListChirpsByUserIDDescRow {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var candidates []ListChirpsByUserIDDescRow
+	for _, chirp := range m.chirps {
+		if q.userID == "" || chirp.UserID == q.userID {
+			candidates = append(candidates, ListChirpsByUserIDDescRow{Chirp: chirp})
+		}
+	}
+	if q.userID != "" {
+		for key, rechirp := range m.rechirps {
+			if key.userID == q.userID {
+				candidates = append(candidates, ListChirpsByUserIDDescRow{
+					Chirp:       m.chirps[key.chirpID],
+					RechirpedAt: sql.NullTime{Time: rechirp.CreatedAt, Valid: true},
+				})
+			}
+		}
+	}
+
+	listedAt := func(row ListChirpsByUserIDDescRow) time.Time {
+		if row.RechirpedAt.Valid {
+			return row.RechirpedAt.Time
+		}
+		return row.Chirp.CreatedAt
+	}
+	cursorCreatedAt := pgTime(q.cursorCreatedAt)
+	var items []ListChirpsByUserIDDescRow
+	for _, row := range candidates {
+		if row.Chirp.DeletedAt.Valid {
+			continue
+		}
+		at := listedAt(row)
+		position := compareChirpPosition(at, row.Chirp.ID, cursorCreatedAt, q.cursorID)
+		if (q.desc && position >= 0) || (!q.desc && position <= 0) {
+			continue
+		}
+		if at.Before(pgTime(q.since)) || !at.Before(pgTime(q.until)) {
+			continue
+		}
+		items = append(items, row)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		c := compareChirpPosition(listedAt(items[i]), items[i].Chirp.ID, listedAt(items[j]), items[j].Chirp.ID)
+		if q.desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	if q.pageSize >= 0 && len(items) > int(q.pageSize) {
+		items = items[:q.pageSize]
+	}
+	return items
+}
+
+// listChirpRows drops the rechirp column for queries that don't have one
+func listChirpRows(rows []ListChirpsByUserIDDescRow) []Chirp {
+	var items []Chirp
+	for _, row := range rows {
+		items = append(items, row.Chirp)
+	}
+	return items
+}
+
+func (m *MemoryStore) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.chirps[arg.ID]; ok {
+		return Chirp{}, uniqueViolation("chirps_pkey")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return Chirp{}, foreignKeyViolation("chirps", "chirps_user_id_foreign")
+	}
+	if arg.ReplyToID.Valid {
+		if _, ok := m.chirps[arg.ReplyToID.String]; !ok {
+			return Chirp{}, foreignKeyViolation("chirps", "chirps_reply_to_id_foreign")
+		}
+	}
+	chirp := Chirp{
+		ID:        arg.ID,
+		CreatedAt: pgTime(arg.CreatedAt),
+		UpdatedAt: pgTime(arg.UpdatedAt),
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		ReplyToID: arg.ReplyToID,
+	}
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *MemoryStore) DeleteAllChirps(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chirps = map[string]Chirp{}
+	m.likes = map[chirpUserKey]ChirpLike{}
+	m.rechirps = map[chirpUserKey]ChirpRechirp{}
+	m.revisions = map[string]ChirpRevision{}
+	return nil
+}
+
+// deleteChirpLocked removes a chirp along with its likes, rechirps and
+// revisions and detaches its replies, mirroring the foreign keys. callers
+// must hold m.mu.
+func (m *MemoryStore) deleteChirpLocked(id string) {
+	delete(m.chirps, id)
+	m.deleteChirpRevisionsLocked(id)
+	for key := range m.likes {
+		if key.chirpID == id {
+			delete(m.likes, key)
+		}
+	}
+	for key := range m.rechirps {
+		if key.chirpID == id {
+			delete(m.rechirps, key)
+		}
+	}
+	for key, chirp := range m.chirps {
+		if chirp.ReplyToID.Valid && chirp.ReplyToID.String == id {
+			chirp.ReplyToID = sql.NullString{}
+			m.chirps[key] = chirp
+		}
+	}
+}
+
+func (m *MemoryStore) DeleteChirp(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteChirpLocked(id)
+	return nil
+}
+
+func (m *MemoryStore) DeleteChirpIfNoReplies(ctx context.Context, id string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.chirps[id]; !ok {
+		return 0, nil
+	}
+	for _, chirp := range m.chirps {
+		if chirp.ReplyToID.Valid && chirp.ReplyToID.String == id {
+			return 0, nil
+		}
+	}
+	m.deleteChirpLocked(id)
+	return 1, nil
+}
+
+func (m *MemoryStore) TombstoneChirp(ctx context.Context, arg TombstoneChirpParams) (Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[arg.ID]
+	if !ok {
+		return Chirp{}, sql.ErrNoRows
+	}
+	m.deleteChirpRevisionsLocked(chirp.ID)
+	chirp.Body = ""
+	chirp.DeletedAt = sql.NullTime{Time: pgTime(arg.DeletedAt.Time), Valid: arg.DeletedAt.Valid}
+	chirp.UpdatedAt = pgTime(arg.UpdatedAt)
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *MemoryStore) CountRepliesByChirpIDs(ctx context.Context, chirpIds []string) ([]CountRepliesByChirpIDsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	wanted := map[string]bool{}
+	for _, id := range chirpIds {
+		wanted[id] = true
+	}
+	counts := map[string]int64{}
+	for _, chirp := range m.chirps {
+		if chirp.DeletedAt.Valid || !chirp.ReplyToID.Valid || !wanted[chirp.ReplyToID.String] {
+			continue
+		}
+		counts[chirp.ReplyToID.String]++
+	}
+	var items []CountRepliesByChirpIDsRow
+	for id, count := range counts {
+		items = append(items, CountRepliesByChirpIDsRow{ChirpID: id, ReplyCount: count})
+	}
+	return items, nil
+}
+
+func (m *MemoryStore) GetChirpAncestors(ctx context.Context, id string) ([]Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []Chirp
+	chirp, ok := m.chirps[id]
+	// the depth cap matches the recursive query and guards against cycles
+	for ok && chirp.ReplyToID.Valid && len(items) < 1000 {
+		chirp, ok = m.chirps[chirp.ReplyToID.String]
+		if ok {
+			items = append(items, chirp)
+		}
+	}
+	// root first
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, nil
+}
+
+func (m *MemoryStore) ListChirpDescendants(ctx context.Context, arg ListChirpDescendantsParams) ([]ListChirpDescendantsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	children := map[string][]Chirp{}
+	for _, chirp := range m.chirps {
+		if chirp.ReplyToID.Valid {
+			children[chirp.ReplyToID.String] = append(children[chirp.ReplyToID.String], chirp)
+		}
+	}
+
+	var items []ListChirpDescendantsRow
+	var walk func(id string, depth int32)
+	walk = func(id string, depth int32) {
+		if depth > 1000 {
+			return
+		}
+		for _, chirp := range children[id] {
+			if compareChirpPosition(chirp.CreatedAt, chirp.ID, pgTime(arg.CursorCreatedAt), arg.CursorID) > 0 {
+				items = append(items, ListChirpDescendantsRow{Chirp: chirp, Depth: depth})
+			}
+			walk(chirp.ID, depth+1)
+		}
+	}
+	walk(arg.ID, 1)
+
+	sort.Slice(items, func(i, j int) bool {
+		return compareChirpPosition(items[i].Chirp.CreatedAt, items[i].Chirp.ID, items[j].Chirp.CreatedAt, items[j].Chirp.ID) < 0
+	})
+	if len(items) > int(arg.PageSize) {
+		items = items[:arg.PageSize]
+	}
+	return items, nil
+}
+
+func (m *MemoryStore) GetAllChirps(ctx context.Context) ([]Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []Chirp
+	for _, chirp := range m.chirps {
+		items = append(items, chirp)
+	}
+	sortChirps(items, false)
+	return items, nil
+}
+
+func (m *MemoryStore) GetChirpByID(ctx context.Context, id string) (Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	chirp, ok := m.chirps[id]
+	if !ok {
+		return Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (m *MemoryStore) GetChirpsByUserID(ctx context.Context, userID string) ([]Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []Chirp
+	for _, chirp := range m.chirps {
+		if chirp.UserID == userID {
+			items = append(items, chirp)
+		}
+	}
+	return items, nil
+}
+
+func (m *MemoryStore) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	return listChirpRows(m.listChirps(memoryChirpQuery{
+		cursorCreatedAt: arg.CursorCreatedAt,
+		cursorID:        arg.CursorID,
+		since:           arg.Since,
+		until:           arg.Until,
+		pageSize:        arg.PageSize,
+	})), nil
+}
+
+func (m *MemoryStore) ListChirpsByUserIDAsc(ctx context.Context, arg ListChirpsByUserIDAscParams) ([]ListChirpsByUserIDAscRow, error) {
+	var items []ListChirpsByUserIDAscRow
+	for _, row := range m.listChirps(memoryChirpQuery{
+		userID:          arg.UserID,
+		cursorCreatedAt: arg.CursorCreatedAt,
+		cursorID:        arg.CursorID,
+		since:           arg.Since,
+		until:           arg.Until,
+		pageSize:        arg.PageSize,
+	}) {
+		items = append(items, ListChirpsByUserIDAscRow(row))
+	}
+	return items, nil
+}
+
+func (m *MemoryStore) ListChirpsByUserIDDesc(ctx context.Context, arg ListChirpsByUserIDDescParams) ([]ListChirpsByUserIDDescRow, error) {
+	return m.listChirps(memoryChirpQuery{
+		userID:          arg.UserID,
+		desc:            true,
+		cursorCreatedAt: arg.CursorCreatedAt,
+		cursorID:        arg.CursorID,
+		since:           arg.Since,
+		until:           arg.Until,
+		pageSize:        arg.PageSize,
+	}), nil
+}
+
+func (m *MemoryStore) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	return listChirpRows(m.listChirps(memoryChirpQuery{
+		desc:            true,
+		cursorCreatedAt: arg.CursorCreatedAt,
+		cursorID:        arg.CursorID,
+		since:           arg.Since,
+		until:           arg.Until,
+		pageSize:        arg.PageSize,
+	})), nil
+}
+
+func (m *MemoryStore) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[arg.ID]
+	if !ok {
+		return Chirp{}, sql.ErrNoRows
+	}
+	chirp.Body = arg.Body
+	chirp.UpdatedAt = pgTime(arg.UpdatedAt)
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *MemoryStore) UpdateChirpWithRevision(ctx context.Context, arg UpdateChirpWithRevisionParams) (Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[arg.ID]
+	if !ok || chirp.DeletedAt.Valid {
+		return Chirp{}, sql.ErrNoRows
+	}
+	if _, ok := m.revisions[arg.RevisionID]; ok {
+		return Chirp{}, uniqueViolation("chirp_revisions_pkey")
+	}
+	m.revisions[arg.RevisionID] = ChirpRevision{
+		ID:         arg.RevisionID,
+		ChirpID:    chirp.ID,
+		Body:       chirp.Body,
+		CreatedAt:  chirp.UpdatedAt,
+		ReplacedAt: pgTime(arg.UpdatedAt),
+	}
+	chirp.Body = arg.Body
+	chirp.UpdatedAt = pgTime(arg.UpdatedAt)
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+// searchTokens lowercases text and splits it into words. it stands in for
+// to_tsvector without stemming or stop words.
+func searchTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// snippetEscaper escapes a chirp body the way the search queries do before
+// ts_headline adds its <mark> tags
+var snippetEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// matchChirp reports whether every query token appears in the chirp body and
+// returns a rank and a highlighted snippet in the same shape as the postgres
+// query (ts_rank / ts_headline of the escaped body with <mark> tags).
+func matchChirp(chirp Chirp, queryTokens []string) (float32, string, bool) {
+	bodyTokens := searchTokens(chirp.Body)
+	if len(queryTokens) == 0 || len(bodyTokens) == 0 {
+		return 0, "", false
+	}
+	wanted := map[string]bool{}
+	for _, token := range queryTokens {
+		wanted[token] = true
+	}
+	found := map[string]bool{}
+	hits := 0
+	for _, token := range bodyTokens {
+		if wanted[token] {
+			found[token] = true
+			hits++
+		}
+	}
+	if len(found) != len(wanted) {
+		return 0, "", false
+	}
+
+	words := strings.Fields(chirp.Body)
+	for i, word := range words {
+		words[i] = snippetEscaper.Replace(word)
+		for _, token := range searchTokens(word) {
+			if wanted[token] {
+				words[i] = "<mark>" + words[i] + "</mark>"
+				break
+			}
+		}
+	}
+	return float32(hits) / float32(len(bodyTokens)), strings.Join(words, " "), true
+}
+
+func (m *MemoryStore) searchChirps(query, userID string, pageSize, pageOffset int32) []SearchChirpsRow {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	queryTokens := searchTokens(query)
+	var items []SearchChirpsRow
+	for _, chirp := range m.chirps {
+		if chirp.DeletedAt.Valid || (userID != "" && chirp.UserID != userID) {
+			continue
+		}
+		rank, snippet, ok := matchChirp(chirp, queryTokens)
+		if !ok {
+			continue
+		}
+		items = append(items, SearchChirpsRow{Chirp: chirp, Rank: rank, Snippet: snippet})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Rank != items[j].Rank {
+			return items[i].Rank > items[j].Rank
+		}
+		return compareChirpPosition(items[i].Chirp.CreatedAt, items[i].Chirp.ID, items[j].Chirp.CreatedAt, items[j].Chirp.ID) > 0
+	})
+	if int(pageOffset) >= len(items) {
+		return nil
+	}
+	items = items[pageOffset:]
+	if len(items) > int(pageSize) {
+		items = items[:pageSize]
+	}
+	return items
+}
+
+func (m *MemoryStore) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	return m.searchChirps(arg.Query, "", arg.PageSize, arg.PageOffset), nil
+}
+
+func (m *MemoryStore) SearchChirpsByUserID(ctx context.Context, arg SearchChirpsByUserIDParams) ([]SearchChirpsByUserIDRow, error) {
+	var items []SearchChirpsByUserIDRow
+	for _, row := range m.searchChirps(arg.Query, arg.UserID, arg.PageSize, arg.PageOffset) {
+		items = append(items, SearchChirpsByUserIDRow(row))
+	}
+	return items, nil
+}
+
+func (m *MemoryStore) ListTimelineChirps(ctx context.Context, arg ListTimelineChirpsParams) ([]Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []Chirp
+	for _, chirp := range m.chirps {
+		if chirp.DeletedAt.Valid {
+			continue
+		}
+		if _, ok := m.follows[followKey{followerID: arg.FollowerID, followeeID: chirp.UserID}]; !ok {
+			continue
+		}
+		if compareChirpPosition(chirp.CreatedAt, chirp.ID, pgTime(arg.CursorCreatedAt), arg.CursorID) >= 0 {
+			continue
+		}
+		items = append(items, chirp)
+	}
+	sortChirps(items, true)
+	if len(items) > int(arg.PageSize) {
+		items = items[:arg.PageSize]
+	}
+	return items, nil
+}
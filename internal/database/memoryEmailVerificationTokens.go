@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (m *MemoryStore) CreateEmailVerificationToken(ctx context.Context, arg CreateEmailVerificationTokenParams) (EmailVerificationToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.verificationTokens[arg.TokenHash]; ok {
+		return EmailVerificationToken{}, uniqueViolation("email_verification_tokens_pkey")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return EmailVerificationToken{}, foreignKeyViolation("email_verification_tokens", "email_verification_tokens_user_id_foreign")
+	}
+	token := EmailVerificationToken{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		Email:     arg.Email,
+		CreatedAt: pgTime(arg.CreatedAt),
+		ExpiresAt: pgTime(arg.ExpiresAt),
+	}
+	m.verificationTokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (m *MemoryStore) ConsumeEmailVerificationToken(ctx context.Context, arg ConsumeEmailVerificationTokenParams) (EmailVerificationToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.verificationTokens[arg.TokenHash]
+	if !ok || token.UsedAt.Valid || !token.ExpiresAt.After(arg.UsedAt.Time) {
+		return EmailVerificationToken{}, sql.ErrNoRows
+	}
+	token.UsedAt = sql.NullTime{Time: pgTime(arg.UsedAt.Time), Valid: arg.UsedAt.Valid}
+	m.verificationTokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (m *MemoryStore) DeleteEmailVerificationTokensByUserID(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, token := range m.verificationTokens {
+		if token.UserID == userID {
+			delete(m.verificationTokens, key)
+		}
+	}
+	return nil
+}
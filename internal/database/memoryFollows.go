@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+type followKey struct {
+	followerID string
+	followeeID string
+}
+
+func (m *MemoryStore) CreateFollow(ctx context.Context, arg CreateFollowParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if arg.FollowerID == arg.FolloweeID {
+		return 0, errors.New(`new row for relation "follows" violates check constraint "follows_no_self_follow"`)
+	}
+	if _, ok := m.users[arg.FollowerID]; !ok {
+		return 0, foreignKeyViolation("follows", "follows_follower_id_foreign")
+	}
+	if _, ok := m.users[arg.FolloweeID]; !ok {
+		return 0, foreignKeyViolation("follows", "follows_followee_id_foreign")
+	}
+	key := followKey{followerID: arg.FollowerID, followeeID: arg.FolloweeID}
+	if _, ok := m.follows[key]; ok {
+		return 0, nil
+	}
+	m.follows[key] = Follow{
+		FollowerID: arg.FollowerID,
+		FolloweeID: arg.FolloweeID,
+		CreatedAt:  pgTime(arg.CreatedAt),
+	}
+	return 1, nil
+}
+
+func (m *MemoryStore) DeleteFollow(ctx context.Context, arg DeleteFollowParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := followKey{followerID: arg.FollowerID, followeeID: arg.FolloweeID}
+	if _, ok := m.follows[key]; !ok {
+		return 0, nil
+	}
+	delete(m.follows, key)
+	return 1, nil
+}
+
+// listFollows returns follows newest first, keyed on (created_at, other user).
+// other picks the user id that is not fixed by the query.
+func (m *MemoryStore) listFollows(match func(Follow) bool, other func(Follow) string, arg ListFollowersParams) []Follow {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []Follow
+	for _, follow := range m.follows {
+		if !match(follow) {
+			continue
+		}
+		if compareChirpPosition(follow.CreatedAt, other(follow), pgTime(arg.CursorCreatedAt), arg.CursorID) >= 0 {
+			continue
+		}
+		items = append(items, follow)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return compareChirpPosition(items[i].CreatedAt, other(items[i]), items[j].CreatedAt, other(items[j])) > 0
+	})
+	if len(items) > int(arg.PageSize) {
+		items = items[:arg.PageSize]
+	}
+	return items
+}
+
+func (m *MemoryStore) ListFollowers(ctx context.Context, arg ListFollowersParams) ([]Follow, error) {
+	return m.listFollows(
+		func(f Follow) bool { return f.FolloweeID == arg.UserID },
+		func(f Follow) string { return f.FollowerID },
+		arg,
+	), nil
+}
+
+func (m *MemoryStore) ListFollowing(ctx context.Context, arg ListFollowingParams) ([]Follow, error) {
+	return m.listFollows(
+		func(f Follow) bool { return f.FollowerID == arg.UserID },
+		func(f Follow) string { return f.FolloweeID },
+		ListFollowersParams(arg),
+	), nil
+}
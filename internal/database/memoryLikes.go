@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+)
+
+// chirpUserKey is the (user_id, chirp_id) primary key shared by likes and
+// rechirps
+type chirpUserKey struct {
+	userID  string
+	chirpID string
+}
+
+func (m *MemoryStore) CreateLike(ctx context.Context, arg CreateLikeParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return 0, foreignKeyViolation("chirp_likes", "chirp_likes_user_id_foreign")
+	}
+	if _, ok := m.chirps[arg.ChirpID]; !ok {
+		return 0, foreignKeyViolation("chirp_likes", "chirp_likes_chirp_id_foreign")
+	}
+	key := chirpUserKey{userID: arg.UserID, chirpID: arg.ChirpID}
+	if _, ok := m.likes[key]; ok {
+		return 0, nil
+	}
+	m.likes[key] = ChirpLike{
+		UserID:    arg.UserID,
+		ChirpID:   arg.ChirpID,
+		CreatedAt: pgTime(arg.CreatedAt),
+	}
+	return 1, nil
+}
+
+func (m *MemoryStore) DeleteLike(ctx context.Context, arg DeleteLikeParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := chirpUserKey{userID: arg.UserID, chirpID: arg.ChirpID}
+	if _, ok := m.likes[key]; !ok {
+		return 0, nil
+	}
+	delete(m.likes, key)
+	return 1, nil
+}
+
+func (m *MemoryStore) CountLikesByChirpIDs(ctx context.Context, chirpIds []string) ([]CountLikesByChirpIDsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	wanted := map[string]bool{}
+	for _, id := range chirpIds {
+		wanted[id] = true
+	}
+	counts := map[string]int64{}
+	for key := range m.likes {
+		if wanted[key.chirpID] {
+			counts[key.chirpID]++
+		}
+	}
+	var items []CountLikesByChirpIDsRow
+	for id, count := range counts {
+		items = append(items, CountLikesByChirpIDsRow{ChirpID: id, LikeCount: count})
+	}
+	return items, nil
+}
+
+func (m *MemoryStore) ListLikedChirpIDs(ctx context.Context, arg ListLikedChirpIDsParams) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []string
+	for _, id := range arg.ChirpIds {
+		if _, ok := m.likes[chirpUserKey{userID: arg.UserID, chirpID: id}]; ok {
+			items = append(items, id)
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (m *MemoryStore) GetLoginAttempt(ctx context.Context, key string) (LoginAttempt, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	attempt, ok := m.loginAttempts[key]
+	if !ok {
+		return LoginAttempt{}, sql.ErrNoRows
+	}
+	return attempt, nil
+}
+
+func (m *MemoryStore) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempt, ok := m.loginAttempts[arg.Key]
+	if !ok || attempt.LastFailureAt.Before(pgTime(arg.WindowStart)) {
+		attempt = LoginAttempt{Key: arg.Key}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = pgTime(arg.Now)
+	m.loginAttempts[arg.Key] = attempt
+	return attempt, nil
+}
+
+func (m *MemoryStore) DeleteLoginAttempt(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.loginAttempts, key)
+	return nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (m *MemoryStore) CreateMagicLinkToken(ctx context.Context, arg CreateMagicLinkTokenParams) (MagicLinkToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.magicLinkTokens[arg.TokenHash]; ok {
+		return MagicLinkToken{}, uniqueViolation("magic_link_tokens_pkey")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return MagicLinkToken{}, foreignKeyViolation("magic_link_tokens", "magic_link_tokens_user_id_foreign")
+	}
+	token := MagicLinkToken{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		Email:     arg.Email,
+		CreatedAt: pgTime(arg.CreatedAt),
+		ExpiresAt: pgTime(arg.ExpiresAt),
+	}
+	m.magicLinkTokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (m *MemoryStore) ConsumeMagicLinkToken(ctx context.Context, arg ConsumeMagicLinkTokenParams) (MagicLinkToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.magicLinkTokens[arg.TokenHash]
+	if !ok || token.UsedAt.Valid || !token.ExpiresAt.After(arg.UsedAt.Time) {
+		return MagicLinkToken{}, sql.ErrNoRows
+	}
+	token.UsedAt = sql.NullTime{Time: pgTime(arg.UsedAt.Time), Valid: arg.UsedAt.Valid}
+	m.magicLinkTokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (m *MemoryStore) DeleteMagicLinkTokensByUserID(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, token := range m.magicLinkTokens {
+		if token.UserID == userID {
+			delete(m.magicLinkTokens, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (m *MemoryStore) CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (PasswordResetToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.resetTokens[arg.TokenHash]; ok {
+		return PasswordResetToken{}, uniqueViolation("password_reset_tokens_pkey")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return PasswordResetToken{}, foreignKeyViolation("password_reset_tokens", "password_reset_tokens_user_id_foreign")
+	}
+	token := PasswordResetToken{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		CreatedAt: pgTime(arg.CreatedAt),
+		ExpiresAt: pgTime(arg.ExpiresAt),
+	}
+	m.resetTokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (m *MemoryStore) ConsumePasswordResetToken(ctx context.Context, arg ConsumePasswordResetTokenParams) (PasswordResetToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.resetTokens[arg.TokenHash]
+	if !ok || token.UsedAt.Valid || !token.ExpiresAt.After(arg.UsedAt.Time) {
+		return PasswordResetToken{}, sql.ErrNoRows
+	}
+	token.UsedAt = sql.NullTime{Time: pgTime(arg.UsedAt.Time), Valid: arg.UsedAt.Valid}
+	m.resetTokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (m *MemoryStore) DeletePasswordResetTokensByUserID(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, token := range m.resetTokens {
+		if token.UserID == userID {
+			delete(m.resetTokens, key)
+		}
+	}
+	return nil
+}
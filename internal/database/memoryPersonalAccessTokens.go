@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+func (m *MemoryStore) CreatePersonalAccessToken(ctx context.Context, arg CreatePersonalAccessTokenParams) (PersonalAccessToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.accessTokens[arg.ID]; ok {
+		return PersonalAccessToken{}, uniqueViolation("personal_access_tokens_pkey")
+	}
+	for _, token := range m.accessTokens {
+		if token.TokenHash == arg.TokenHash {
+			return PersonalAccessToken{}, uniqueViolation("personal_access_tokens_token_hash_unique")
+		}
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return PersonalAccessToken{}, foreignKeyViolation("personal_access_tokens", "personal_access_tokens_user_id_foreign")
+	}
+	token := PersonalAccessToken{
+		ID:        arg.ID,
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    arg.Scopes,
+		CreatedAt: pgTime(arg.CreatedAt),
+		ExpiresAt: sql.NullTime{Time: pgTime(arg.ExpiresAt.Time), Valid: arg.ExpiresAt.Valid},
+	}
+	m.accessTokens[token.ID] = token
+	return token, nil
+}
+
+func (m *MemoryStore) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (PersonalAccessToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, token := range m.accessTokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return PersonalAccessToken{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) ListPersonalAccessTokensByUserID(ctx context.Context, userID string) ([]PersonalAccessToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []PersonalAccessToken
+	for _, token := range m.accessTokens {
+		if token.UserID == userID {
+			items = append(items, token)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if c := items[i].CreatedAt.Compare(items[j].CreatedAt); c != 0 {
+			return c > 0
+		}
+		return strings.Compare(items[i].ID, items[j].ID) > 0
+	})
+	return items, nil
+}
+
+func (m *MemoryStore) TouchPersonalAccessToken(ctx context.Context, arg TouchPersonalAccessTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.accessTokens[arg.ID]
+	if !ok {
+		return nil
+	}
+	token.LastUsedAt = sql.NullTime{Time: pgTime(arg.LastUsedAt.Time), Valid: arg.LastUsedAt.Valid}
+	m.accessTokens[token.ID] = token
+	return nil
+}
+
+func (m *MemoryStore) DeletePersonalAccessToken(ctx context.Context, arg DeletePersonalAccessTokenParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.accessTokens[arg.ID]
+	if !ok || token.UserID != arg.UserID {
+		return 0, nil
+	}
+	delete(m.accessTokens, token.ID)
+	return 1, nil
+}
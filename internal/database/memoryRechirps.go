@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+)
+
+func (m *MemoryStore) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return 0, foreignKeyViolation("chirp_rechirps", "chirp_rechirps_user_id_foreign")
+	}
+	if _, ok := m.chirps[arg.ChirpID]; !ok {
+		return 0, foreignKeyViolation("chirp_rechirps", "chirp_rechirps_chirp_id_foreign")
+	}
+	key := chirpUserKey{userID: arg.UserID, chirpID: arg.ChirpID}
+	if _, ok := m.rechirps[key]; ok {
+		return 0, nil
+	}
+	m.rechirps[key] = ChirpRechirp{
+		UserID:    arg.UserID,
+		ChirpID:   arg.ChirpID,
+		CreatedAt: pgTime(arg.CreatedAt),
+	}
+	return 1, nil
+}
+
+func (m *MemoryStore) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := chirpUserKey{userID: arg.UserID, chirpID: arg.ChirpID}
+	if _, ok := m.rechirps[key]; !ok {
+		return 0, nil
+	}
+	delete(m.rechirps, key)
+	return 1, nil
+}
+
+func (m *MemoryStore) CountRechirpsByChirpIDs(ctx context.Context, chirpIds []string) ([]CountRechirpsByChirpIDsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	wanted := map[string]bool{}
+	for _, id := range chirpIds {
+		wanted[id] = true
+	}
+	counts := map[string]int64{}
+	for key := range m.rechirps {
+		if wanted[key.chirpID] {
+			counts[key.chirpID]++
+		}
+	}
+	var items []CountRechirpsByChirpIDsRow
+	for id, count := range counts {
+		items = append(items, CountRechirpsByChirpIDsRow{ChirpID: id, RechirpCount: count})
+	}
+	return items, nil
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (m *MemoryStore) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.refreshTokens[arg.ID]; ok {
+		return RefreshToken{}, uniqueViolation("refresh_tokens_pkey")
+	}
+	if m.refreshTokenHashTakenLocked(arg.TokenHash) {
+		return RefreshToken{}, uniqueViolation("refresh_tokens_token_hash_unique")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return RefreshToken{}, foreignKeyViolation("refresh_tokens", "refresh_tokens_user_id_foreign")
+	}
+	token := RefreshToken{
+		ID:              arg.ID,
+		TokenHash:       arg.TokenHash,
+		CreatedAt:       pgTime(arg.CreatedAt),
+		UpdatedAt:       pgTime(arg.UpdatedAt),
+		UserID:          arg.UserID,
+		ExpiresAt:       pgTime(arg.ExpiresAt),
+		FamilyID:        arg.FamilyID,
+		FamilyCreatedAt: pgTime(arg.FamilyCreatedAt),
+		UserAgent:       arg.UserAgent,
+		IPAddress:       arg.IPAddress,
+	}
+	m.refreshTokens[token.ID] = token
+	return token, nil
+}
+
+// refreshTokenHashTakenLocked reports whether a token already has the digest.
+// callers must hold m.mu.
+func (m *MemoryStore) refreshTokenHashTakenLocked(tokenHash string) bool {
+	for _, token := range m.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) DeleteAllRefreshTokens(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshTokens = map[string]RefreshToken{}
+	return nil
+}
+
+func (m *MemoryStore) DeleteExpiredRefreshTokens(ctx context.Context, expiresAt time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for key, token := range m.refreshTokens {
+		if token.ExpiresAt.Before(pgTime(expiresAt)) {
+			delete(m.refreshTokens, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *MemoryStore) DeleteRefreshToken(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.refreshTokens, id)
+	return nil
+}
+
+func (m *MemoryStore) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, token := range m.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return RefreshToken{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) GetRefreshTokenByUserID(ctx context.Context, userID string) ([]RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []RefreshToken
+	for _, token := range m.refreshTokens {
+		if token.UserID == userID {
+			items = append(items, token)
+		}
+	}
+	return items, nil
+}
+
+func (m *MemoryStore) RevokeRefreshToken(ctx context.Context, arg RevokeRefreshTokenParams) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.refreshTokens[arg.ID]
+	if !ok {
+		return RefreshToken{}, sql.ErrNoRows
+	}
+	token.RevokedAt = sql.NullTime{Time: pgTime(arg.RevokedAt.Time), Valid: arg.RevokedAt.Valid}
+	token.UpdatedAt = pgTime(arg.UpdatedAt)
+	m.refreshTokens[token.ID] = token
+	return token, nil
+}
+
+func (m *MemoryStore) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	previous, ok := m.refreshTokens[arg.ID]
+	if !ok || previous.RevokedAt.Valid {
+		return RefreshToken{}, sql.ErrNoRows
+	}
+	if _, ok := m.refreshTokens[arg.NewID]; ok {
+		return RefreshToken{}, uniqueViolation("refresh_tokens_pkey")
+	}
+	if m.refreshTokenHashTakenLocked(arg.NewTokenHash) {
+		return RefreshToken{}, uniqueViolation("refresh_tokens_token_hash_unique")
+	}
+	previous.RevokedAt = sql.NullTime{Time: pgTime(arg.Now), Valid: true}
+	previous.UpdatedAt = pgTime(arg.Now)
+	previous.ReplacedBy = sql.NullString{String: arg.NewID, Valid: true}
+	m.refreshTokens[previous.ID] = previous
+	token := RefreshToken{
+		ID:              arg.NewID,
+		TokenHash:       arg.NewTokenHash,
+		CreatedAt:       pgTime(arg.Now),
+		UpdatedAt:       pgTime(arg.Now),
+		UserID:          previous.UserID,
+		ExpiresAt:       pgTime(arg.ExpiresAt),
+		FamilyID:        previous.FamilyID,
+		FamilyCreatedAt: previous.FamilyCreatedAt,
+		UserAgent:       previous.UserAgent,
+		IPAddress:       previous.IPAddress,
+	}
+	m.refreshTokens[token.ID] = token
+	return token, nil
+}
+
+func (m *MemoryStore) RevokeRefreshTokenFamily(ctx context.Context, arg RevokeRefreshTokenFamilyParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.revokeRefreshTokensLocked(arg.RevokedAt, func(token RefreshToken) bool {
+		return token.FamilyID == arg.FamilyID
+	}), nil
+}
+
+func (m *MemoryStore) RevokeRefreshTokenFamilyByUserID(ctx context.Context, arg RevokeRefreshTokenFamilyByUserIDParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.revokeRefreshTokensLocked(arg.RevokedAt, func(token RefreshToken) bool {
+		return token.UserID == arg.UserID && token.FamilyID == arg.FamilyID
+	}), nil
+}
+
+func (m *MemoryStore) RevokeAllRefreshTokensByUserID(ctx context.Context, arg RevokeAllRefreshTokensByUserIDParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.revokeRefreshTokensLocked(arg.RevokedAt, func(token RefreshToken) bool {
+		return token.UserID == arg.UserID
+	}), nil
+}
+
+// revokeRefreshTokensLocked revokes the unrevoked tokens that match and
+// returns how many there were. callers must hold m.mu.
+func (m *MemoryStore) revokeRefreshTokensLocked(revokedAt sql.NullTime, match func(RefreshToken) bool) int64 {
+	var revoked int64
+	for key, token := range m.refreshTokens {
+		if token.RevokedAt.Valid || !match(token) {
+			continue
+		}
+		token.RevokedAt = sql.NullTime{Time: pgTime(revokedAt.Time), Valid: revokedAt.Valid}
+		token.UpdatedAt = pgTime(revokedAt.Time)
+		m.refreshTokens[key] = token
+		revoked++
+	}
+	return revoked
+}
+
+func (m *MemoryStore) ListActiveRefreshTokensByUserID(ctx context.Context, arg ListActiveRefreshTokensByUserIDParams) ([]RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []RefreshToken
+	for _, token := range m.refreshTokens {
+		if token.UserID == arg.UserID && !token.RevokedAt.Valid && token.ExpiresAt.After(pgTime(arg.Now)) &&
+			token.FamilyCreatedAt.After(pgTime(arg.FamilyCreatedAfter)) && token.CreatedAt.After(pgTime(arg.CreatedAfter)) {
+			items = append(items, token)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if c := items[i].CreatedAt.Compare(items[j].CreatedAt); c != 0 {
+			return c > 0
+		}
+		return strings.Compare(items[i].ID, items[j].ID) > 0
+	})
+	return items, nil
+}
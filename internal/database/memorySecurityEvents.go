@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+func (m *MemoryStore) CreateSecurityEvent(ctx context.Context, arg CreateSecurityEventParams) (SecurityEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.events[arg.ID]; ok {
+		return SecurityEvent{}, uniqueViolation("security_events_pkey")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return SecurityEvent{}, foreignKeyViolation("security_events", "security_events_user_id_foreign")
+	}
+	event := SecurityEvent{
+		ID:        arg.ID,
+		UserID:    arg.UserID,
+		EventType: arg.EventType,
+		Details:   arg.Details,
+		CreatedAt: pgTime(arg.CreatedAt),
+	}
+	m.events[event.ID] = event
+	return event, nil
+}
+
+func (m *MemoryStore) ListSecurityEventsByUserID(ctx context.Context, userID string) ([]SecurityEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []SecurityEvent
+	for _, event := range m.events {
+		if event.UserID == userID {
+			items = append(items, event)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if c := items[i].CreatedAt.Compare(items[j].CreatedAt); c != 0 {
+			return c > 0
+		}
+		return strings.Compare(items[i].ID, items[j].ID) > 0
+	})
+	return items, nil
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+func (m *MemoryStore) UpsertUserTOTP(ctx context.Context, arg UpsertUserTOTPParams) (UserTotp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return UserTotp{}, foreignKeyViolation("user_totp", "user_totp_user_id_foreign")
+	}
+	if existing, ok := m.totp[arg.UserID]; ok && existing.EnabledAt.Valid {
+		return UserTotp{}, sql.ErrNoRows
+	}
+	totp := UserTotp{
+		UserID:    arg.UserID,
+		Secret:    arg.Secret,
+		CreatedAt: pgTime(arg.CreatedAt),
+	}
+	m.totp[totp.UserID] = totp
+	return totp, nil
+}
+
+func (m *MemoryStore) GetUserTOTP(ctx context.Context, userID string) (UserTotp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	totp, ok := m.totp[userID]
+	if !ok {
+		return UserTotp{}, sql.ErrNoRows
+	}
+	return totp, nil
+}
+
+func (m *MemoryStore) EnableUserTOTP(ctx context.Context, arg EnableUserTOTPParams) (UserTotp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	totp, ok := m.totp[arg.UserID]
+	if !ok || totp.EnabledAt.Valid {
+		return UserTotp{}, sql.ErrNoRows
+	}
+	totp.EnabledAt = sql.NullTime{Time: pgTime(arg.EnabledAt.Time), Valid: arg.EnabledAt.Valid}
+	totp.LastUsedStep = arg.LastUsedStep
+	m.totp[totp.UserID] = totp
+	return totp, nil
+}
+
+func (m *MemoryStore) UpdateUserTOTPLastUsedStep(ctx context.Context, arg UpdateUserTOTPLastUsedStepParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	totp, ok := m.totp[arg.UserID]
+	if !ok || totp.LastUsedStep >= arg.LastUsedStep {
+		return 0, nil
+	}
+	totp.LastUsedStep = arg.LastUsedStep
+	m.totp[totp.UserID] = totp
+	return 1, nil
+}
+
+func (m *MemoryStore) DeleteUserTOTP(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.totp, userID)
+	return nil
+}
+
+func (m *MemoryStore) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) (RecoveryCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.recoveryCodes[arg.ID]; ok {
+		return RecoveryCode{}, uniqueViolation("recovery_codes_pkey")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return RecoveryCode{}, foreignKeyViolation("recovery_codes", "recovery_codes_user_id_foreign")
+	}
+	code := RecoveryCode{
+		ID:        arg.ID,
+		UserID:    arg.UserID,
+		CodeHash:  arg.CodeHash,
+		CreatedAt: pgTime(arg.CreatedAt),
+	}
+	m.recoveryCodes[code.ID] = code
+	return code, nil
+}
+
+func (m *MemoryStore) ListUnusedRecoveryCodesByUserID(ctx context.Context, userID string) ([]RecoveryCode, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []RecoveryCode
+	for _, code := range m.recoveryCodes {
+		if code.UserID == userID && !code.UsedAt.Valid {
+			items = append(items, code)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if c := items[i].CreatedAt.Compare(items[j].CreatedAt); c != 0 {
+			return c < 0
+		}
+		return strings.Compare(items[i].ID, items[j].ID) < 0
+	})
+	return items, nil
+}
+
+func (m *MemoryStore) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.recoveryCodes[arg.ID]
+	if !ok || code.UsedAt.Valid {
+		return 0, nil
+	}
+	code.UsedAt = sql.NullTime{Time: pgTime(arg.UsedAt.Time), Valid: arg.UsedAt.Valid}
+	m.recoveryCodes[code.ID] = code
+	return 1, nil
+}
+
+func (m *MemoryStore) DeleteRecoveryCodesByUserID(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, code := range m.recoveryCodes {
+		if code.UserID == userID {
+			delete(m.recoveryCodes, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateTwoFactorChallenge(ctx context.Context, arg CreateTwoFactorChallengeParams) (TwoFactorChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.challenges[arg.TokenHash]; ok {
+		return TwoFactorChallenge{}, uniqueViolation("two_factor_challenges_pkey")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return TwoFactorChallenge{}, foreignKeyViolation("two_factor_challenges", "two_factor_challenges_user_id_foreign")
+	}
+	challenge := TwoFactorChallenge{
+		TokenHash:        arg.TokenHash,
+		UserID:           arg.UserID,
+		ExpiresInSeconds: arg.ExpiresInSeconds,
+		CreatedAt:        pgTime(arg.CreatedAt),
+		ExpiresAt:        pgTime(arg.ExpiresAt),
+	}
+	m.challenges[challenge.TokenHash] = challenge
+	return challenge, nil
+}
+
+func (m *MemoryStore) RecordTwoFactorChallengeAttempt(ctx context.Context, arg RecordTwoFactorChallengeAttemptParams) (TwoFactorChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	challenge, ok := m.challenges[arg.TokenHash]
+	if !ok || challenge.UsedAt.Valid || !challenge.ExpiresAt.After(arg.Now) || challenge.Attempts >= arg.MaxAttempts {
+		return TwoFactorChallenge{}, sql.ErrNoRows
+	}
+	challenge.Attempts++
+	m.challenges[challenge.TokenHash] = challenge
+	return challenge, nil
+}
+
+func (m *MemoryStore) ConsumeTwoFactorChallenge(ctx context.Context, arg ConsumeTwoFactorChallengeParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	challenge, ok := m.challenges[arg.TokenHash]
+	if !ok || challenge.UsedAt.Valid {
+		return 0, nil
+	}
+	challenge.UsedAt = sql.NullTime{Time: pgTime(arg.UsedAt.Time), Valid: arg.UsedAt.Valid}
+	m.challenges[challenge.TokenHash] = challenge
+	return 1, nil
+}
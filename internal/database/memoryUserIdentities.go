@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (m *MemoryStore) CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (UserIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.identities[arg.ID]; ok {
+		return UserIdentity{}, uniqueViolation("user_identities_pkey")
+	}
+	for _, identity := range m.identities {
+		if identity.Provider == arg.Provider && identity.Subject == arg.Subject {
+			return UserIdentity{}, uniqueViolation("user_identities_provider_subject_unique")
+		}
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return UserIdentity{}, foreignKeyViolation("user_identities", "user_identities_user_id_foreign")
+	}
+	identity := UserIdentity{
+		ID:          arg.ID,
+		UserID:      arg.UserID,
+		Provider:    arg.Provider,
+		Subject:     arg.Subject,
+		Email:       arg.Email,
+		CreatedAt:   pgTime(arg.CreatedAt),
+		LastLoginAt: pgTime(arg.CreatedAt),
+	}
+	m.identities[identity.ID] = identity
+	return identity, nil
+}
+
+func (m *MemoryStore) GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (UserIdentity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, identity := range m.identities {
+		if identity.Provider == arg.Provider && identity.Subject == arg.Subject {
+			return identity, nil
+		}
+	}
+	return UserIdentity{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) TouchUserIdentity(ctx context.Context, arg TouchUserIdentityParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	identity, ok := m.identities[arg.ID]
+	if !ok {
+		return nil
+	}
+	identity.Email = arg.Email
+	identity.LastLoginAt = pgTime(arg.LastLoginAt)
+	m.identities[identity.ID] = identity
+	return nil
+}
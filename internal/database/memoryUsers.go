@@ -0,0 +1,272 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+func (m *MemoryStore) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.ID]; ok {
+		return User{}, uniqueViolation("users_pkey")
+	}
+	if m.emailTaken(arg.Email, "") {
+		return User{}, uniqueViolation("users_email_unique")
+	}
+	user := User{
+		ID:             arg.ID,
+		CreatedAt:      pgTime(arg.CreatedAt),
+		UpdatedAt:      pgTime(arg.UpdatedAt),
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Role:           "user",
+	}
+	m.users[user.ID] = user
+	return user, nil
+}
+
+// emailTaken reports whether a user other than exceptID has the email.
+// callers must hold m.mu.
+func (m *MemoryStore) emailTaken(email, exceptID string) bool {
+	for _, user := range m.users {
+		if user.Email == email && user.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteUserLocked removes a user and everything that references it,
+// mirroring the ON DELETE CASCADE foreign keys. callers must hold m.mu.
+func (m *MemoryStore) deleteUserLocked(id string) {
+	delete(m.users, id)
+	for key, chirp := range m.chirps {
+		if chirp.UserID == id {
+			m.deleteChirpLocked(key)
+		}
+	}
+	for key, token := range m.refreshTokens {
+		if token.UserID == id {
+			delete(m.refreshTokens, key)
+		}
+	}
+	for key := range m.follows {
+		if key.followerID == id || key.followeeID == id {
+			delete(m.follows, key)
+		}
+	}
+	for key := range m.likes {
+		if key.userID == id {
+			delete(m.likes, key)
+		}
+	}
+	for key := range m.rechirps {
+		if key.userID == id {
+			delete(m.rechirps, key)
+		}
+	}
+	for key, event := range m.events {
+		if event.UserID == id {
+			delete(m.events, key)
+		}
+	}
+	for key, token := range m.resetTokens {
+		if token.UserID == id {
+			delete(m.resetTokens, key)
+		}
+	}
+	for key, token := range m.magicLinkTokens {
+		if token.UserID == id {
+			delete(m.magicLinkTokens, key)
+		}
+	}
+	for key, token := range m.verificationTokens {
+		if token.UserID == id {
+			delete(m.verificationTokens, key)
+		}
+	}
+	delete(m.totp, id)
+	for key, code := range m.recoveryCodes {
+		if code.UserID == id {
+			delete(m.recoveryCodes, key)
+		}
+	}
+	for key, challenge := range m.challenges {
+		if challenge.UserID == id {
+			delete(m.challenges, key)
+		}
+	}
+	for key, token := range m.accessTokens {
+		if token.UserID == id {
+			delete(m.accessTokens, key)
+		}
+	}
+	for key, identity := range m.identities {
+		if identity.UserID == id {
+			delete(m.identities, key)
+		}
+	}
+}
+
+func (m *MemoryStore) DeleteAllUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.users {
+		m.deleteUserLocked(id)
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteUsersExcept(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for userID := range m.users {
+		if userID != id {
+			m.deleteUserLocked(userID)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteUser(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteUserLocked(id)
+	return nil
+}
+
+func (m *MemoryStore) GetUserByID(ctx context.Context, id string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[id]
+	if !ok {
+		return User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *MemoryStore) GetUsersByEmail(ctx context.Context, email string) ([]User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var items []User
+	for _, user := range m.users {
+		if user.Email == email {
+			items = append(items, user)
+		}
+	}
+	return items, nil
+}
+
+// updateUser applies fn to the user with the given id under the write lock
+func (m *MemoryStore) updateUser(id string, fn func(user *User) error) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return User{}, sql.ErrNoRows
+	}
+	if err := fn(&user); err != nil {
+		return User{}, err
+	}
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *MemoryStore) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	return m.updateUser(arg.ID, func(user *User) error {
+		if m.emailTaken(arg.Email, arg.ID) {
+			return uniqueViolation("users_email_unique")
+		}
+		user.Email = arg.Email
+		user.HashedPassword = arg.HashedPassword
+		user.UpdatedAt = pgTime(arg.UpdatedAt)
+		return nil
+	})
+}
+
+func (m *MemoryStore) UpdateUserEmailByID(ctx context.Context, arg UpdateUserEmailByIDParams) (User, error) {
+	return m.updateUser(arg.ID, func(user *User) error {
+		if m.emailTaken(arg.Email, arg.ID) {
+			return uniqueViolation("users_email_unique")
+		}
+		user.Email = arg.Email
+		user.UpdatedAt = pgTime(arg.UpdatedAt)
+		return nil
+	})
+}
+
+func (m *MemoryStore) UpdateUserPasswordByEmail(ctx context.Context, arg UpdateUserPasswordByEmailParams) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, user := range m.users {
+		if user.Email == arg.Email {
+			user.HashedPassword = arg.HashedPassword
+			user.UpdatedAt = pgTime(arg.UpdatedAt)
+			m.users[id] = user
+			return user, nil
+		}
+	}
+	return User{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) UpdateUserPasswordByID(ctx context.Context, arg UpdateUserPasswordByIDParams) (User, error) {
+	return m.updateUser(arg.ID, func(user *User) error {
+		user.HashedPassword = arg.HashedPassword
+		user.UpdatedAt = pgTime(arg.UpdatedAt)
+		return nil
+	})
+}
+
+func (m *MemoryStore) UpgradeUserPasswordHash(ctx context.Context, arg UpgradeUserPasswordHashParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok || user.HashedPassword != arg.OldHashedPassword {
+		return 0, nil
+	}
+	user.HashedPassword = arg.NewHashedPassword
+	m.users[arg.ID] = user
+	return 1, nil
+}
+
+func (m *MemoryStore) UpdateUserSetChirpyRed(ctx context.Context, arg UpdateUserSetChirpyRedParams) (User, error) {
+	return m.updateUser(arg.ID, func(user *User) error {
+		user.IsChirpyRed = true
+		user.UpdatedAt = pgTime(arg.UpdatedAt)
+		return nil
+	})
+}
+
+func (m *MemoryStore) UpdateUserUnsetChirpyRed(ctx context.Context, arg UpdateUserUnsetChirpyRedParams) (User, error) {
+	return m.updateUser(arg.ID, func(user *User) error {
+		user.IsChirpyRed = false
+		user.UpdatedAt = pgTime(arg.UpdatedAt)
+		return nil
+	})
+}
+
+func (m *MemoryStore) SetUserVerifiedEmail(ctx context.Context, arg SetUserVerifiedEmailParams) (User, error) {
+	return m.updateUser(arg.ID, func(user *User) error {
+		if m.emailTaken(arg.Email, arg.ID) {
+			return uniqueViolation("users_email_unique")
+		}
+		user.Email = arg.Email
+		user.EmailVerifiedAt = sql.NullTime{Time: pgTime(arg.EmailVerifiedAt.Time), Valid: arg.EmailVerifiedAt.Valid}
+		user.UpdatedAt = pgTime(arg.EmailVerifiedAt.Time)
+		return nil
+	})
+}
+
+func (m *MemoryStore) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	return m.updateUser(arg.ID, func(user *User) error {
+		switch arg.Role {
+		case "user", "moderator", "admin":
+		default:
+			return checkViolation("users", "users_role_check")
+		}
+		user.Role = arg.Role
+		user.UpdatedAt = pgTime(arg.UpdatedAt)
+		return nil
+	})
+}
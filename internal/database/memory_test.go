@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreConcurrentChirps(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	_, err := store.CreateUser(ctx, CreateUserParams{ID: "u1", Email: "u1@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := store.CreateChirp(ctx, CreateChirpParams{
+				ID:        fmt.Sprintf("c%02d", i),
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+				Body:      "chirp",
+				UserID:    "u1",
+			})
+			if err != nil {
+				t.Errorf("Error creating chirp: %v", err)
+			}
+			store.GetAllChirps(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	chirps, _ := store.GetChirpsByUserID(ctx, "u1")
+	if len(chirps) != 50 {
+		t.Fatalf("Expected 50 chirps, got %d", len(chirps))
+	}
+}
+
+func TestMemoryStoreConstraints(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	if _, err := store.CreateChirp(ctx, CreateChirpParams{ID: "c1", UserID: "nobody"}); err == nil {
+		t.Fatalf("Expected foreign key error creating chirp for unknown user")
+	}
+	if _, err := store.CreateUser(ctx, CreateUserParams{ID: "u1", Email: "same@example.com"}); err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	if _, err := store.CreateUser(ctx, CreateUserParams{ID: "u2", Email: "same@example.com"}); err == nil {
+		t.Fatalf("Expected unique violation for duplicate email")
+	}
+	if _, err := store.CreateChirp(ctx, CreateChirpParams{ID: "c1", UserID: "u1"}); err != nil {
+		t.Fatalf("Error creating chirp: %v", err)
+	}
+
+	// deleting the user cascades to their chirps
+	if err := store.DeleteUser(ctx, "u1"); err != nil {
+		t.Fatalf("Error deleting user: %v", err)
+	}
+	if _, err := store.GetChirpByID(ctx, "c1"); err != sql.ErrNoRows {
+		t.Fatalf("Expected sql.ErrNoRows after cascade, got %v", err)
+	}
+}
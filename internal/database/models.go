@@ -10,27 +10,151 @@ import (
 )
 
 type Chirp struct {
-	ID        string
+	ID           string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       string
+	SearchVector interface{}
+	ReplyToID    sql.NullString
+	DeletedAt    sql.NullTime
+}
+
+type ChirpLike struct {
+	UserID    string
+	ChirpID   string
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
+}
+
+type ChirpRechirp struct {
 	UserID    string
+	ChirpID   string
+	CreatedAt time.Time
 }
 
-type RefreshToken struct {
-	Token     string
+type ChirpRevision struct {
+	ID         string
+	ChirpID    string
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	UserID    string
+	Email     string
 	CreatedAt time.Time
-	UpdatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Follow struct {
+	FollowerID string
+	FolloweeID string
+	CreatedAt  time.Time
+}
+
+type LoginAttempt struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+}
+
+type MagicLinkToken struct {
+	TokenHash string
 	UserID    string
+	Email     string
+	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         string
+	UserID     string
+	Name       string
+	TokenHash  string
+	Scopes     string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        string
+	UserID    string
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	UserID          string
+	ExpiresAt       time.Time
+	RevokedAt       sql.NullTime
+	FamilyID        string
+	ReplacedBy      sql.NullString
+	FamilyCreatedAt time.Time
+	UserAgent       string
+	IPAddress       string
+	ID              string
+	TokenHash       string
+}
+
+type SecurityEvent struct {
+	ID        string
+	UserID    string
+	EventType string
+	Details   string
+	CreatedAt time.Time
+}
+
+type TwoFactorChallenge struct {
+	TokenHash        string
+	UserID           string
+	ExpiresInSeconds int32
+	Attempts         int32
+	CreatedAt        time.Time
+	ExpiresAt        time.Time
+	UsedAt           sql.NullTime
 }
 
 type User struct {
-	ID             string
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID              string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsChirpyRed     bool
+	Role            string
+	EmailVerifiedAt sql.NullTime
+}
+
+type UserIdentity struct {
+	ID          string
+	UserID      string
+	Provider    string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type UserTotp struct {
+	UserID       string
+	Secret       string
+	CreatedAt    time.Time
+	EnabledAt    sql.NullTime
+	LastUsedStep int64
 }
@@ -12,41 +12,62 @@ import (
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (id, token_hash, created_at, updated_at, user_id, expires_at, family_id, family_created_at, user_agent, ip_address)
 VALUES (
     $1,
     $2,
     $3,
     $4,
-    $5
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, family_created_at, user_agent, ip_address, id, token_hash
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	UserID    string
-	ExpiresAt time.Time
+	ID              string
+	TokenHash       string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	UserID          string
+	ExpiresAt       time.Time
+	FamilyID        string
+	FamilyCreatedAt time.Time
+	UserAgent       string
+	IPAddress       string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
 	row := q.db.QueryRowContext(ctx, createRefreshToken,
-		arg.Token,
+		arg.ID,
+		arg.TokenHash,
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.UserID,
 		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.FamilyCreatedAt,
+		arg.UserAgent,
+		arg.IPAddress,
 	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.FamilyCreatedAt,
+		&i.UserAgent,
+		&i.IPAddress,
+		&i.ID,
+		&i.TokenHash,
 	)
 	return i, err
 }
@@ -60,44 +81,55 @@ func (q *Queries) DeleteAllRefreshTokens(ctx context.Context) error {
 	return err
 }
 
-const deleteExpiredRefreshTokens = `-- name: DeleteExpiredRefreshTokens :exec
-DELETE FROM refresh_tokens WHERE expires_at < $1 AND revoked_at IS NULL
+const deleteExpiredRefreshTokens = `-- name: DeleteExpiredRefreshTokens :execrows
+DELETE FROM refresh_tokens WHERE expires_at < $1
 `
 
-func (q *Queries) DeleteExpiredRefreshTokens(ctx context.Context, expiresAt time.Time) error {
-	_, err := q.db.ExecContext(ctx, deleteExpiredRefreshTokens, expiresAt)
-	return err
+// revoked tokens go too once they have expired; they are only kept to catch
+// reuse, and an expired token is refused before that is checked
+func (q *Queries) DeleteExpiredRefreshTokens(ctx context.Context, expiresAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredRefreshTokens, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const deleteRefreshToken = `-- name: DeleteRefreshToken :exec
-DELETE FROM refresh_tokens WHERE token = $1
+DELETE FROM refresh_tokens WHERE id = $1
 `
 
-func (q *Queries) DeleteRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, deleteRefreshToken, token)
+func (q *Queries) DeleteRefreshToken(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteRefreshToken, id)
 	return err
 }
 
-const getRefreshTokenByToken = `-- name: GetRefreshTokenByToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token = $1 LIMIT 1
+const getRefreshTokenByHash = `-- name: GetRefreshTokenByHash :one
+SELECT created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, family_created_at, user_agent, ip_address, id, token_hash FROM refresh_tokens WHERE token_hash = $1 LIMIT 1
 `
 
-func (q *Queries) GetRefreshTokenByToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getRefreshTokenByToken, token)
+func (q *Queries) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenByHash, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.FamilyCreatedAt,
+		&i.UserAgent,
+		&i.IPAddress,
+		&i.ID,
+		&i.TokenHash,
 	)
 	return i, err
 }
 
 const getRefreshTokenByUserID = `-- name: GetRefreshTokenByUserID :many
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens WHERE user_id = $1
+SELECT created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, family_created_at, user_agent, ip_address, id, token_hash FROM refresh_tokens WHERE user_id = $1
 `
 
 func (q *Queries) GetRefreshTokenByUserID(ctx context.Context, userID string) ([]RefreshToken, error) {
@@ -110,12 +142,18 @@ func (q *Queries) GetRefreshTokenByUserID(ctx context.Context, userID string) ([
 	for rows.Next() {
 		var i RefreshToken
 		if err := rows.Scan(
-			&i.Token,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
 			&i.ExpiresAt,
 			&i.RevokedAt,
+			&i.FamilyID,
+			&i.ReplacedBy,
+			&i.FamilyCreatedAt,
+			&i.UserAgent,
+			&i.IPAddress,
+			&i.ID,
+			&i.TokenHash,
 		); err != nil {
 			return nil, err
 		}
@@ -130,26 +168,198 @@ func (q *Queries) GetRefreshTokenByUserID(ctx context.Context, userID string) ([
 	return items, nil
 }
 
+const listActiveRefreshTokensByUserID = `-- name: ListActiveRefreshTokensByUserID :many
+SELECT created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, family_created_at, user_agent, ip_address, id, token_hash FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+    AND family_created_at > $3
+    AND created_at > $4
+ORDER BY created_at DESC, id DESC
+`
+
+type ListActiveRefreshTokensByUserIDParams struct {
+	UserID             string
+	Now                time.Time
+	FamilyCreatedAfter time.Time
+	CreatedAfter       time.Time
+}
+
+// returns the live token of each of the user's sessions. sessions that
+// started before family_created_after are past their maximum lifetime, and
+// ones whose live token was issued before created_after have been idle too
+// long
+func (q *Queries) ListActiveRefreshTokensByUserID(ctx context.Context, arg ListActiveRefreshTokensByUserIDParams) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, listActiveRefreshTokensByUserID,
+		arg.UserID,
+		arg.Now,
+		arg.FamilyCreatedAfter,
+		arg.CreatedAfter,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.FamilyID,
+			&i.ReplacedBy,
+			&i.FamilyCreatedAt,
+			&i.UserAgent,
+			&i.IPAddress,
+			&i.ID,
+			&i.TokenHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllRefreshTokensByUserID = `-- name: RevokeAllRefreshTokensByUserID :execrows
+UPDATE refresh_tokens SET revoked_at = $2, updated_at = $2
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+type RevokeAllRefreshTokensByUserIDParams struct {
+	UserID    string
+	RevokedAt sql.NullTime
+}
+
+func (q *Queries) RevokeAllRefreshTokensByUserID(ctx context.Context, arg RevokeAllRefreshTokensByUserIDParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAllRefreshTokensByUserID, arg.UserID, arg.RevokedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :one
-UPDATE refresh_tokens SET revoked_at = $2, updated_at = $3 WHERE token = $1 RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+UPDATE refresh_tokens SET revoked_at = $2, updated_at = $3 WHERE id = $1 RETURNING created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, family_created_at, user_agent, ip_address, id, token_hash
 `
 
 type RevokeRefreshTokenParams struct {
-	Token     string
+	ID        string
 	RevokedAt sql.NullTime
 	UpdatedAt time.Time
 }
 
 func (q *Queries) RevokeRefreshToken(ctx context.Context, arg RevokeRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, revokeRefreshToken, arg.Token, arg.RevokedAt, arg.UpdatedAt)
+	row := q.db.QueryRowContext(ctx, revokeRefreshToken, arg.ID, arg.RevokedAt, arg.UpdatedAt)
+	var i RefreshToken
+	err := row.Scan(
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.FamilyCreatedAt,
+		&i.UserAgent,
+		&i.IPAddress,
+		&i.ID,
+		&i.TokenHash,
+	)
+	return i, err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens SET revoked_at = $2, updated_at = $2
+WHERE family_id = $1 AND revoked_at IS NULL
+`
+
+type RevokeRefreshTokenFamilyParams struct {
+	FamilyID  string
+	RevokedAt sql.NullTime
+}
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, arg RevokeRefreshTokenFamilyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, arg.FamilyID, arg.RevokedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeRefreshTokenFamilyByUserID = `-- name: RevokeRefreshTokenFamilyByUserID :execrows
+UPDATE refresh_tokens SET revoked_at = $3, updated_at = $3
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeRefreshTokenFamilyByUserIDParams struct {
+	UserID    string
+	FamilyID  string
+	RevokedAt sql.NullTime
+}
+
+func (q *Queries) RevokeRefreshTokenFamilyByUserID(ctx context.Context, arg RevokeRefreshTokenFamilyByUserIDParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeRefreshTokenFamilyByUserID, arg.UserID, arg.FamilyID, arg.RevokedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :one
+WITH rotated AS (
+    UPDATE refresh_tokens
+    SET revoked_at = $1, updated_at = $1, replaced_by = $2
+    WHERE refresh_tokens.id = $3 AND revoked_at IS NULL
+    RETURNING user_id, family_id, family_created_at, user_agent, ip_address
+)
+INSERT INTO refresh_tokens (id, token_hash, created_at, updated_at, user_id, expires_at, family_id, family_created_at, user_agent, ip_address)
+SELECT $2, $4, $1, $1, rotated.user_id, $5, rotated.family_id,
+    rotated.family_created_at, rotated.user_agent, rotated.ip_address
+FROM rotated
+RETURNING created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, family_created_at, user_agent, ip_address, id, token_hash
+`
+
+type RotateRefreshTokenParams struct {
+	Now          time.Time
+	NewID        string
+	ID           string
+	NewTokenHash string
+	ExpiresAt    time.Time
+}
+
+// revokes the presented token and issues its successor in the same family.
+// nothing is returned if the token was already revoked, so only one of two
+// concurrent refreshes with the same token can succeed
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, rotateRefreshToken,
+		arg.Now,
+		arg.NewID,
+		arg.ID,
+		arg.NewTokenHash,
+		arg.ExpiresAt,
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.FamilyCreatedAt,
+		&i.UserAgent,
+		&i.IPAddress,
+		&i.ID,
+		&i.TokenHash,
 	)
 	return i, err
 }
@@ -0,0 +1,13 @@
+package database
+
+// Store is everything the API needs from persistence. *Queries satisfies it
+// against postgres and *MemoryStore satisfies it without a database, which
+// is what the handler tests run against.
+type Store interface {
+	Querier
+}
+
+var (
+	_ Store = (*Queries)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 )
 
@@ -19,7 +20,7 @@ VALUES (
     $4,
     $5
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at
 `
 
 type CreateUserParams struct {
@@ -46,6 +47,8 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -68,8 +71,17 @@ func (q *Queries) DeleteUser(ctx context.Context, id string) error {
 	return err
 }
 
+const deleteUsersExcept = `-- name: DeleteUsersExcept :exec
+DELETE FROM users WHERE id <> $1
+`
+
+func (q *Queries) DeleteUsersExcept(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteUsersExcept, id)
+	return err
+}
+
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE id = $1 LIMIT 1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at FROM users WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, id string) (User, error) {
@@ -82,12 +94,14 @@ func (q *Queries) GetUserByID(ctx context.Context, id string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUsersByEmail = `-- name: GetUsersByEmail :many
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUsersByEmail(ctx context.Context, email string) ([]User, error) {
@@ -106,6 +120,8 @@ func (q *Queries) GetUsersByEmail(ctx context.Context, email string) ([]User, er
 			&i.Email,
 			&i.HashedPassword,
 			&i.IsChirpyRed,
+			&i.Role,
+			&i.EmailVerifiedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -120,8 +136,36 @@ func (q *Queries) GetUsersByEmail(ctx context.Context, email string) ([]User, er
 	return items, nil
 }
 
+const setUserVerifiedEmail = `-- name: SetUserVerifiedEmail :one
+UPDATE users SET email = $2, email_verified_at = $3, updated_at = $3 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at
+`
+
+type SetUserVerifiedEmailParams struct {
+	ID              string
+	Email           string
+	EmailVerifiedAt sql.NullTime
+}
+
+// sets the email and marks it verified in one step, for both confirming the
+// current address and switching to a new one
+func (q *Queries) SetUserVerifiedEmail(ctx context.Context, arg SetUserVerifiedEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserVerifiedEmail, arg.ID, arg.Email, arg.EmailVerifiedAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
 const updateUser = `-- name: UpdateUser :one
-UPDATE users SET email = $2, hashed_password = $3, updated_at = $4 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+UPDATE users SET email = $2, hashed_password = $3, updated_at = $4 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at
 `
 
 type UpdateUserParams struct {
@@ -146,12 +190,14 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const updateUserEmailByID = `-- name: UpdateUserEmailByID :one
-UPDATE users SET email = $2, updated_at = $3 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+UPDATE users SET email = $2, updated_at = $3 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at
 `
 
 type UpdateUserEmailByIDParams struct {
@@ -170,21 +216,24 @@ func (q *Queries) UpdateUserEmailByID(ctx context.Context, arg UpdateUserEmailBy
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const updateUserPasswordByEmail = `-- name: UpdateUserPasswordByEmail :one
-UPDATE users SET hashed_password = $2 WHERE email = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+UPDATE users SET hashed_password = $2, updated_at = $3 WHERE email = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at
 `
 
 type UpdateUserPasswordByEmailParams struct {
 	Email          string
 	HashedPassword string
+	UpdatedAt      time.Time
 }
 
 func (q *Queries) UpdateUserPasswordByEmail(ctx context.Context, arg UpdateUserPasswordByEmailParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUserPasswordByEmail, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, updateUserPasswordByEmail, arg.Email, arg.HashedPassword, arg.UpdatedAt)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -193,12 +242,14 @@ func (q *Queries) UpdateUserPasswordByEmail(ctx context.Context, arg UpdateUserP
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const updateUserPasswordByID = `-- name: UpdateUserPasswordByID :one
-UPDATE users SET hashed_password = $2, updated_at = $3 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+UPDATE users SET hashed_password = $2, updated_at = $3 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at
 `
 
 type UpdateUserPasswordByIDParams struct {
@@ -217,12 +268,40 @@ func (q *Queries) UpdateUserPasswordByID(ctx context.Context, arg UpdateUserPass
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users SET role = $2, updated_at = $3 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at
+`
+
+type UpdateUserRoleParams struct {
+	ID        string
+	Role      string
+	UpdatedAt time.Time
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.ID, arg.Role, arg.UpdatedAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const updateUserSetChirpyRed = `-- name: UpdateUserSetChirpyRed :one
-UPDATE users SET is_chirpy_red = TRUE, updated_at = $2 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+UPDATE users SET is_chirpy_red = TRUE, updated_at = $2 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at
 `
 
 type UpdateUserSetChirpyRedParams struct {
@@ -240,12 +319,14 @@ func (q *Queries) UpdateUserSetChirpyRed(ctx context.Context, arg UpdateUserSetC
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const updateUserUnsetChirpyRed = `-- name: UpdateUserUnsetChirpyRed :one
-UPDATE users SET is_chirpy_red = FALSE, updated_at = $2 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+UPDATE users SET is_chirpy_red = FALSE, updated_at = $2 WHERE id = $1 RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, email_verified_at
 `
 
 type UpdateUserUnsetChirpyRedParams struct {
@@ -263,6 +344,31 @@ func (q *Queries) UpdateUserUnsetChirpyRed(ctx context.Context, arg UpdateUserUn
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
+
+const upgradeUserPasswordHash = `-- name: UpgradeUserPasswordHash :execrows
+UPDATE users SET hashed_password = $1
+WHERE id = $2 AND hashed_password = $3
+`
+
+type UpgradeUserPasswordHashParams struct {
+	NewHashedPassword string
+	ID                string
+	OldHashedPassword string
+}
+
+// swaps in a rehash of the same password only if the hash it was made from
+// is still the current one, so a password changed in the meantime isn't
+// overwritten with the old one. updated_at is left alone; the user hasn't
+// changed anything.
+func (q *Queries) UpgradeUserPasswordHash(ctx context.Context, arg UpgradeUserPasswordHashParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, upgradeUserPasswordHash, arg.NewHashedPassword, arg.ID, arg.OldHashedPassword)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
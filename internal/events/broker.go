@@ -0,0 +1,162 @@
+// Package events fans chirp changes out to live subscribers (SSE streams and
+// websocket connections) within a single server process.
+package events
+
+import (
+	"sync"
+)
+
+type Type string
+
+const (
+	ChirpCreated Type = "chirp.created"
+	ChirpUpdated Type = "chirp.updated"
+	ChirpDeleted Type = "chirp.deleted"
+	// Typing is sent with Signal while a user is writing a reply
+	Typing Type = "typing"
+)
+
+const (
+	DefaultBufferSize  = 64
+	DefaultHistorySize = 1024
+)
+
+// Event is a change to a chirp, or a signal about one. Data is the JSON
+// encoded chirp, encoded once by the publisher and shared by every subscriber.
+type Event struct {
+	// ID increases by one with every published event. it resets when the
+	// process restarts and is 0 for signals.
+	ID      uint64
+	Type    Type
+	ChirpID string
+	// AuthorID is the user who caused the event
+	AuthorID string
+	// ThreadIDs holds the chirp and every chirp above it in its thread
+	ThreadIDs []string
+	Data      []byte
+}
+
+// Broker delivers published events to subscribers. Each subscriber has a
+// bounded buffer; one that falls behind is dropped rather than allowed to
+// block publishers or grow without limit. Recent events are kept so a
+// subscriber that reconnects can pick up where it left off.
+type Broker struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	historySize int
+	bufferSize  int
+	subscribers map[*Subscription]struct{}
+}
+
+func NewBroker(bufferSize, historySize int) *Broker {
+	return &Broker{
+		historySize: historySize,
+		bufferSize:  bufferSize,
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Publish assigns the event the next id and delivers it to every matching
+// subscriber without blocking. it returns the event as delivered.
+func (b *Broker) Publish(event Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	event.ID = b.lastID
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	b.deliverLocked(event)
+	return event
+}
+
+// Signal delivers a transient event, such as a typing indicator, to the
+// current subscribers. it gets no id and is not kept for replay.
+func (b *Broker) Signal(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	event.ID = 0
+	b.deliverLocked(event)
+}
+
+func (b *Broker) deliverLocked(event Event) {
+	for sub := range b.subscribers {
+		if !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// the subscriber isn't keeping up
+			b.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for events accepted by filter (nil accepts
+// everything). when resume is true, retained events after lastEventID are
+// queued first so no event is missed between the replay and live delivery.
+func (b *Broker) Subscribe(filter func(Event) bool, lastEventID uint64, resume bool) *Subscription {
+	if filter == nil {
+		filter = func(Event) bool { return true }
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []Event
+	if resume {
+		for _, event := range b.history {
+			if event.ID > lastEventID && filter(event) {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+	sub := &Subscription{
+		broker: b,
+		filter: filter,
+		events: make(chan Event, b.bufferSize+len(backlog)),
+	}
+	for _, event := range backlog {
+		sub.events <- event
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Subscribers returns the number of live subscriptions
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+func (b *Broker) removeLocked(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+type Subscription struct {
+	broker *Broker
+	filter func(Event) bool
+	events chan Event
+}
+
+// Events delivers the subscription's events. it is closed after Close or
+// when the broker drops the subscriber for falling behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close unsubscribes. it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.removeLocked(s)
+}
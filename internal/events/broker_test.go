@@ -0,0 +1,114 @@
+package events
+
+import (
+	"testing"
+)
+
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case event, ok := <-sub.Events():
+		if !ok {
+			t.Fatalf("Subscription closed unexpectedly")
+		}
+		return event
+	default:
+		t.Fatalf("Expected an event to be queued")
+	}
+	return Event{}
+}
+
+func TestBrokerPublishFilters(t *testing.T) {
+	broker := NewBroker(4, 16)
+	all := broker.Subscribe(nil, 0, false)
+	alice := broker.Subscribe(func(e Event) bool { return e.AuthorID == "alice" }, 0, false)
+	defer all.Close()
+	defer alice.Close()
+
+	broker.Publish(Event{Type: ChirpCreated, ChirpID: "c1", AuthorID: "bob"})
+	broker.Publish(Event{Type: ChirpCreated, ChirpID: "c2", AuthorID: "alice"})
+
+	if e := receive(t, all); e.ID != 1 || e.ChirpID != "c1" {
+		t.Fatalf("Unexpected first event: %+v", e)
+	}
+	if e := receive(t, all); e.ID != 2 || e.ChirpID != "c2" {
+		t.Fatalf("Unexpected second event: %+v", e)
+	}
+	if e := receive(t, alice); e.ChirpID != "c2" {
+		t.Fatalf("Expected only alice's chirp, got %+v", e)
+	}
+	if len(alice.Events()) != 0 {
+		t.Fatalf("Expected no more events for alice")
+	}
+}
+
+func TestBrokerResume(t *testing.T) {
+	broker := NewBroker(4, 3)
+	for i := 0; i < 5; i++ {
+		broker.Publish(Event{Type: ChirpCreated})
+	}
+
+	// only the last 3 events are retained
+	sub := broker.Subscribe(nil, 1, true)
+	defer sub.Close()
+	for _, want := range []uint64{3, 4, 5} {
+		if e := receive(t, sub); e.ID != want {
+			t.Fatalf("Expected event %d, got %d", want, e.ID)
+		}
+	}
+
+	broker.Publish(Event{Type: ChirpUpdated})
+	if e := receive(t, sub); e.ID != 6 {
+		t.Fatalf("Expected live event 6, got %d", e.ID)
+	}
+
+	fresh := broker.Subscribe(nil, 0, false)
+	defer fresh.Close()
+	if len(fresh.Events()) != 0 {
+		t.Fatalf("Expected no replay without resume")
+	}
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	broker := NewBroker(2, 16)
+	slow := broker.Subscribe(nil, 0, false)
+	fast := broker.Subscribe(nil, 0, false)
+	defer fast.Close()
+
+	for i := 0; i < 3; i++ {
+		broker.Publish(Event{Type: ChirpCreated})
+		receive(t, fast)
+	}
+
+	// the two buffered events are still delivered before the channel closes
+	receive(t, slow)
+	receive(t, slow)
+	if _, ok := <-slow.Events(); ok {
+		t.Fatalf("Expected slow subscriber to be closed")
+	}
+	if n := broker.Subscribers(); n != 1 {
+		t.Fatalf("Expected 1 subscriber, got %d", n)
+	}
+	slow.Close()
+}
+
+func TestBrokerSignalIsNotRetained(t *testing.T) {
+	broker := NewBroker(4, 16)
+	sub := broker.Subscribe(nil, 0, false)
+	defer sub.Close()
+
+	broker.Signal(Event{Type: Typing, ChirpID: "c1"})
+	if e := receive(t, sub); e.ID != 0 || e.Type != Typing {
+		t.Fatalf("Unexpected signal: %+v", e)
+	}
+	broker.Publish(Event{Type: ChirpCreated})
+
+	resumed := broker.Subscribe(nil, 0, true)
+	defer resumed.Close()
+	if e := receive(t, resumed); e.ID != 1 || e.Type != ChirpCreated {
+		t.Fatalf("Expected only the published event to be replayed, got %+v", e)
+	}
+	if len(resumed.Events()) != 0 {
+		t.Fatalf("Expected the signal not to be replayed")
+	}
+}
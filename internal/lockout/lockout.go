@@ -0,0 +1,128 @@
+// Package lockout slows down password guessing. failed attempts are counted
+// per key, such as an account or a client ip, and once there are enough of
+// them each further attempt has to wait, with the wait doubling up to a full
+// lockout.
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// Policy decides how long a key has to wait given its failures
+type Policy struct {
+	// BackoffAfter is how many failures are allowed before attempts have to
+	// wait. the wait starts at BaseDelay and doubles with each failure, up to
+	// MaxDelay.
+	BackoffAfter int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// LockoutThreshold is the failure count that locks the key out for
+	// LockoutDuration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Window is how long failures are remembered. a failure after a quiet
+	// window starts the count over.
+	Window time.Duration
+}
+
+// DefaultAccountPolicy is for failures against a single account
+func DefaultAccountPolicy() Policy {
+	return Policy{
+		BackoffAfter:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		Window:           15 * time.Minute,
+	}
+}
+
+// DefaultIPPolicy is for failures from a single client address. it is looser
+// than the account policy because many users can share an address.
+func DefaultIPPolicy() Policy {
+	return Policy{
+		BackoffAfter:     10,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 100,
+		LockoutDuration:  15 * time.Minute,
+		Window:           15 * time.Minute,
+	}
+}
+
+// State is what a Tracker remembers about a key
+type State struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Locked reports whether the failures have reached a full lockout
+func (p Policy) Locked(state State) bool {
+	return p.LockoutThreshold > 0 && state.Failures >= p.LockoutThreshold
+}
+
+// RetryAfter returns how long after now the key has to wait before its next
+// attempt, or 0 if it can try straight away
+func (p Policy) RetryAfter(state State, now time.Time) time.Duration {
+	if state.Failures == 0 || now.Sub(state.LastFailure) >= p.Window {
+		return 0
+	}
+	var wait time.Duration
+	switch {
+	case p.Locked(state):
+		wait = p.LockoutDuration
+	case state.Failures >= p.BackoffAfter:
+		wait = p.BaseDelay
+		for i := p.BackoffAfter; i < state.Failures && wait < p.MaxDelay; i++ {
+			wait *= 2
+		}
+		wait = min(wait, p.MaxDelay)
+	default:
+		return 0
+	}
+	return max(state.LastFailure.Add(wait).Sub(now), 0)
+}
+
+// Tracker stores failure counts. the count for a key starts over when its
+// last failure is before windowStart.
+type Tracker interface {
+	Get(ctx context.Context, key string) (State, error)
+	Fail(ctx context.Context, key string, now, windowStart time.Time) (State, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// Limiter applies a Policy to the keys in a Tracker
+type Limiter struct {
+	tracker Tracker
+	policy  Policy
+}
+
+func NewLimiter(tracker Tracker, policy Policy) *Limiter {
+	return &Limiter{tracker: tracker, policy: policy}
+}
+
+// RetryAfter returns how long the key has to wait before its next attempt
+func (l *Limiter) RetryAfter(ctx context.Context, key string, now time.Time) (time.Duration, error) {
+	state, err := l.tracker.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return l.policy.RetryAfter(state, now), nil
+}
+
+// Fail records a failed attempt. it reports whether this failure is the one
+// that locked the key out, so callers can tell the account owner once.
+func (l *Limiter) Fail(ctx context.Context, key string, now time.Time) (bool, error) {
+	state, err := l.tracker.Fail(ctx, key, now, now.Add(-l.policy.Window))
+	if err != nil {
+		return false, err
+	}
+	return l.policy.LockoutThreshold > 0 && state.Failures == l.policy.LockoutThreshold, nil
+}
+
+// Reset forgets the key's failures, after a successful login or when an admin
+// unlocks it
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.tracker.Reset(ctx, key)
+}
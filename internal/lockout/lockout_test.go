@@ -0,0 +1,101 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+func testPolicy() Policy {
+	return Policy{
+		BackoffAfter:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         4 * time.Second,
+		LockoutThreshold: 6,
+		LockoutDuration:  time.Hour,
+		Window:           2 * time.Hour,
+	}
+}
+
+func TestPolicyRetryAfter(t *testing.T) {
+	policy := testPolicy()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, time.Second},
+		{3, 2 * time.Second},
+		{4, 4 * time.Second},
+		// capped at MaxDelay until the lockout
+		{5, 4 * time.Second},
+		{6, time.Hour},
+	}
+	for _, tt := range tests {
+		got := policy.RetryAfter(State{Failures: tt.failures, LastFailure: start}, start)
+		if got != tt.want {
+			t.Errorf("RetryAfter with %d failures = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+
+	locked := State{Failures: 6, LastFailure: start}
+	if got := policy.RetryAfter(locked, start.Add(45*time.Minute)); got != 15*time.Minute {
+		t.Errorf("Expected the lockout to count down, got %v", got)
+	}
+	if got := policy.RetryAfter(locked, start.Add(policy.Window)); got != 0 {
+		t.Errorf("Expected failures outside the window to be forgotten, got %v", got)
+	}
+}
+
+func TestTrackers(t *testing.T) {
+	trackers := map[string]Tracker{
+		"memory": NewMemoryTracker(),
+		// the memory store runs the same queries postgres does
+		"postgres": NewPostgresTracker(database.NewMemoryStore()),
+	}
+	for name, tracker := range trackers {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			limiter := NewLimiter(tracker, testPolicy())
+			now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			for i := 1; i <= 6; i++ {
+				locked, err := limiter.Fail(ctx, "account:a@example.com", now)
+				if err != nil {
+					t.Fatalf("Error recording failure: %v", err)
+				}
+				if locked != (i == 6) {
+					t.Fatalf("Expected only failure 6 to lock, failure %d locked=%v", i, locked)
+				}
+			}
+			wait, err := limiter.RetryAfter(ctx, "account:a@example.com", now)
+			if err != nil || wait != time.Hour {
+				t.Fatalf("Expected an hour lockout, got %v %v", wait, err)
+			}
+			if wait, _ := limiter.RetryAfter(ctx, "account:b@example.com", now); wait != 0 {
+				t.Fatalf("Expected other keys to be unaffected, got %v", wait)
+			}
+
+			if err := limiter.Reset(ctx, "account:a@example.com"); err != nil {
+				t.Fatalf("Error resetting: %v", err)
+			}
+			if wait, _ := limiter.RetryAfter(ctx, "account:a@example.com", now); wait != 0 {
+				t.Fatalf("Expected a reset to unlock, got %v", wait)
+			}
+
+			// a failure after a quiet window starts the count over
+			limiter.Fail(ctx, "ip:10.0.0.1", now)
+			limiter.Fail(ctx, "ip:10.0.0.1", now)
+			later := now.Add(3 * time.Hour)
+			limiter.Fail(ctx, "ip:10.0.0.1", later)
+			state, err := tracker.Get(ctx, "ip:10.0.0.1")
+			if err != nil || state.Failures != 1 {
+				t.Fatalf("Expected the count to start over, got %+v %v", state, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryTrackerSweepSize is how many keys a MemoryTracker holds before it
+// drops the ones whose window has passed
+const memoryTrackerSweepSize = 10000
+
+// MemoryTracker keeps failure counts in process. counts aren't shared between
+// instances or kept across restarts; use PostgresTracker for that.
+type MemoryTracker struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+func NewMemoryTracker() *MemoryTracker {
+	return &MemoryTracker{states: map[string]State{}}
+}
+
+func (t *MemoryTracker) Get(ctx context.Context, key string) (State, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.states[key], nil
+}
+
+func (t *MemoryTracker) Fail(ctx context.Context, key string, now, windowStart time.Time) (State, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.states) >= memoryTrackerSweepSize {
+		// keeps a spray of guesses at random emails from growing the map
+		// without bound
+		for k, state := range t.states {
+			if state.LastFailure.Before(windowStart) {
+				delete(t.states, k)
+			}
+		}
+	}
+	state := t.states[key]
+	if state.LastFailure.Before(windowStart) {
+		state = State{}
+	}
+	state.Failures++
+	state.LastFailure = now
+	t.states[key] = state
+	return state, nil
+}
+
+func (t *MemoryTracker) Reset(ctx context.Context, key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.states, key)
+	return nil
+}
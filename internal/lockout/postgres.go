@@ -0,0 +1,53 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/landanqrew/go-serve-intro/internal/database"
+)
+
+// AttemptStore is the part of database.Store a PostgresTracker needs
+type AttemptStore interface {
+	GetLoginAttempt(ctx context.Context, key string) (database.LoginAttempt, error)
+	RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginAttempt, error)
+	DeleteLoginAttempt(ctx context.Context, key string) error
+}
+
+// PostgresTracker keeps failure counts in the login_attempts table, so every
+// instance behind a load balancer sees the same counts
+type PostgresTracker struct {
+	store AttemptStore
+}
+
+func NewPostgresTracker(store AttemptStore) *PostgresTracker {
+	return &PostgresTracker{store: store}
+}
+
+func (t *PostgresTracker) Get(ctx context.Context, key string) (State, error) {
+	attempt, err := t.store.GetLoginAttempt(ctx, key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return State{}, nil
+		}
+		return State{}, err
+	}
+	return State{Failures: int(attempt.Failures), LastFailure: attempt.LastFailureAt}, nil
+}
+
+func (t *PostgresTracker) Fail(ctx context.Context, key string, now, windowStart time.Time) (State, error) {
+	attempt, err := t.store.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:         key,
+		Now:         now,
+		WindowStart: windowStart,
+	})
+	if err != nil {
+		return State{}, err
+	}
+	return State{Failures: int(attempt.Failures), LastFailure: attempt.LastFailureAt}, nil
+}
+
+func (t *PostgresTracker) Reset(ctx context.Context, key string) error {
+	return t.store.DeleteLoginAttempt(ctx, key)
+}
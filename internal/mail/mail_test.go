@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutboxMailer(t *testing.T) {
+	outbox, err := NewOutboxMailer(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error making outbox: %v", err)
+	}
+	for _, to := range []string{"first@example.com", "second@example.com"} {
+		if err := outbox.Send(context.Background(), Message{To: to, Subject: "hello", Body: "body"}); err != nil {
+			t.Fatalf("Error sending: %v", err)
+		}
+	}
+	messages, err := outbox.Messages()
+	if err != nil {
+		t.Fatalf("Error reading outbox: %v", err)
+	}
+	if len(messages) != 2 || messages[0].To != "first@example.com" || messages[1].To != "second@example.com" {
+		t.Fatalf("Expected both messages in order, got %+v", messages)
+	}
+}
+
+func TestEncodeStripsHeaderInjection(t *testing.T) {
+	msg := Message{
+		To:      "victim@example.com\r\nBcc: everyone@example.com",
+		Subject: "Reset\nBcc: everyone@example.com",
+		Body:    "line one\nline two",
+	}
+	encoded := string(encode("chirpy@example.com", msg, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)))
+	headers, body, _ := strings.Cut(encoded, "\r\n\r\n")
+	if strings.Contains(headers, "\r\nBcc:") {
+		t.Fatalf("Expected no injected headers, got %q", headers)
+	}
+	if body != "line one\r\nline two" {
+		t.Fatalf("Expected CRLF line endings in the body, got %q", body)
+	}
+}
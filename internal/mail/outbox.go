@@ -0,0 +1,66 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OutboxMailer writes each message to a JSON file in a directory instead of
+// sending it, so the links in them can be followed during local development
+// and read back in tests
+type OutboxMailer struct {
+	dir string
+
+	mu   sync.Mutex
+	sent int
+}
+
+func NewOutboxMailer(dir string) (*OutboxMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &OutboxMailer{dir: dir}, nil
+}
+
+func (m *OutboxMailer) Send(ctx context.Context, msg Message) error {
+	data, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent++
+	// the counter keeps names unique and in order within a process
+	name := fmt.Sprintf("%s-%06d.json", time.Now().UTC().Format("20060102T150405.000000000"), m.sent)
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
+
+// Messages returns every message in the outbox, oldest first
+func (m *OutboxMailer) Messages() ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names, err := filepath.Glob(filepath.Join(m.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	messages := make([]Message, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", name, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
@@ -0,0 +1,145 @@
+package oidc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/landanqrew/go-serve-intro/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://chirpy.test/api/auth/test/callback"
+
+func newTestProvider(t *testing.T, server *oidctest.Server) *Provider {
+	t.Helper()
+	return NewProvider(Config{
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  redirectURL,
+	})
+}
+
+// authorize follows the provider's authorization endpoint and returns the
+// code and state it redirects back with
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Error authorizing: %v", err)
+	}
+	res.Body.Close()
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound || !strings.HasPrefix(location.String(), redirectURL) {
+		t.Fatalf("Expected a redirect back to the callback, got %d %q", res.StatusCode, res.Header.Get("Location"))
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+// login runs the flow up to the code exchange
+func login(t *testing.T, provider *Provider, exchangeVerifier string) (*IDToken, error) {
+	t.Helper()
+	verifier, err := RandomString()
+	if err != nil {
+		t.Fatalf("Error making verifier: %v", err)
+	}
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-123", "nonce-123", CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("Error making auth url: %v", err)
+	}
+	code, state := authorize(t, authURL)
+	if state != "state-123" {
+		t.Fatalf("Expected the state to come back, got %q", state)
+	}
+	if exchangeVerifier == "" {
+		exchangeVerifier = verifier
+	}
+	return provider.Exchange(context.Background(), code, exchangeVerifier, "nonce-123")
+}
+
+func TestLogin(t *testing.T) {
+	server := oidctest.NewServer(t)
+	server.SetUser(oidctest.User{Subject: "user-1", Email: "mike@example.com", EmailVerified: true, Name: "Mike"})
+	provider := newTestProvider(t, server)
+
+	token, err := login(t, provider, "")
+	if err != nil {
+		t.Fatalf("Error logging in: %v", err)
+	}
+	if token.Subject != "user-1" || token.Email != "mike@example.com" || !token.EmailVerified || token.Name != "Mike" {
+		t.Fatalf("Unexpected claims %+v", token)
+	}
+}
+
+func TestLoginWrongVerifier(t *testing.T) {
+	server := oidctest.NewServer(t)
+	provider := newTestProvider(t, server)
+	if _, err := login(t, provider, "not-the-verifier"); err == nil {
+		t.Fatalf("Expected the exchange to fail without the right PKCE verifier")
+	}
+}
+
+func TestLoginRejectsBadIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(jwt.MapClaims)
+	}{
+		{name: "nonce", mutate: func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{name: "audience", mutate: func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{name: "issuer", mutate: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "expired", mutate: func(c jwt.MapClaims) { c["exp"] = 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := oidctest.NewServer(t)
+			server.SetClaims(tt.mutate)
+			if _, err := login(t, newTestProvider(t, server), ""); err == nil {
+				t.Fatalf("Expected the ID token to be rejected")
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	server := oidctest.NewServer(t)
+	provider := NewProvider(Config{
+		// discovery works but the document names another issuer
+		Issuer:      server.Issuer() + "/",
+		ClientID:    server.ClientID,
+		RedirectURL: redirectURL,
+	})
+	if _, err := provider.AuthCodeURL(context.Background(), "s", "n", "c"); err != nil {
+		t.Fatalf("Expected a trailing slash to be ignored, got %v", err)
+	}
+
+	// serves the real provider's discovery document from another address
+	impostor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := http.Get(server.URL + r.URL.Path)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		io.Copy(w, res.Body)
+	}))
+	defer impostor.Close()
+	provider = NewProvider(Config{Issuer: impostor.URL, ClientID: server.ClientID, RedirectURL: redirectURL})
+	if _, err := provider.AuthCodeURL(context.Background(), "s", "n", "c"); err == nil {
+		t.Fatalf("Expected discovery naming another issuer to fail")
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// the example from RFC 7636 appendix B
+	if got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Fatalf("Unexpected challenge %q", got)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"os"
 	"github.com/joho/godotenv"
 	"github.com/landanqrew/go-serve-intro/internal/api"
+	"github.com/landanqrew/go-serve-intro/internal/auth"
+	"github.com/landanqrew/go-serve-intro/internal/database"
 	_ "github.com/lib/pq"
 )
 
@@ -43,16 +45,32 @@ func main() {
 	}
 	defer db.Close()
 
+	// administrative subcommands run instead of the server
+	if len(os.Args) > 1 {
+		if err := runCommand(context.Background(), database.New(db), os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	mux := &http.ServeMux{}
-	cfg := api.GetAPIConfig(db)
+	cfg, err := api.GetAPIConfig(database.New(db))
+	if err != nil {
+		log.Fatal(err)
+	}
 	server := &http.Server{
 		Addr:    ":8080",
 		Handler: mux,
 	}
 
+	go cfg.RunRefreshTokenJanitor(context.Background())
+
 	fmt.Printf("Starting server on port %s\n", server.Addr)
 
 	mux.Handle("/app/", http.StripPrefix("/app/", cfg.MiddlewareMetricsInc(http.FileServer(http.Dir(".")))))
+	mux.HandleFunc("GET /.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleJWKS(w, r)
+	})
 	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Type", "text/plain")
@@ -64,51 +82,155 @@ func main() {
 	mux.HandleFunc("GET /api/chirps", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleGetAllChirps(w, r)
 	})
+	mux.HandleFunc("GET /api/chirps/search", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleSearchChirps(w, r)
+	})
+	mux.HandleFunc("GET /api/chirps/stream", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleChirpStream(w, r)
+	})
 	mux.HandleFunc("GET /api/chirps/{id}", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleGetChirpByID(w, r)
 	})
+	mux.HandleFunc("GET /api/chirps/{id}/thread", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleGetChirpThread(w, r)
+	})
+	mux.HandleFunc("GET /api/chirps/{id}/history", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleGetChirpHistory(w, r)
+	})
+	mux.HandleFunc("POST /api/chirps/{id}/like", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleLikeChirp(w, r)
+	})
+	mux.HandleFunc("DELETE /api/chirps/{id}/like", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleUnlikeChirp(w, r)
+	})
+	mux.HandleFunc("POST /api/chirps/{id}/rechirp", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleRechirp(w, r)
+	})
+	mux.HandleFunc("DELETE /api/chirps/{id}/rechirp", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleUndoRechirp(w, r)
+	})
 	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleCreateChirp(w, r)
 	})
-	mux.HandleFunc("PUT /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("PUT /api/chirps/{id}", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleUpdateChirp(w, r)
 	})
 	mux.HandleFunc("DELETE /api/chirps/{chirp_id}", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleDeleteChirp(w, r)
 	})
+	mux.HandleFunc("GET /api/ws", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleWebSocket(w, r)
+	})
 	mux.HandleFunc("POST /api/users", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleCreateUser(w, r)
 	})
 	mux.HandleFunc("PUT /api/users", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleUpdateUser(w, r)
 	})
+	mux.HandleFunc("POST /api/users/{id}/follow", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleFollowUser(w, r)
+	})
+	mux.HandleFunc("DELETE /api/users/{id}/follow", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleUnfollowUser(w, r)
+	})
+	mux.HandleFunc("GET /api/users/{id}/followers", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleGetFollowers(w, r)
+	})
+	mux.HandleFunc("GET /api/users/{id}/following", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleGetFollowing(w, r)
+	})
+	mux.HandleFunc("GET /api/timeline", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleGetTimeline(w, r)
+	})
 	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleAuthenticateUser(w, r)
 	})
+	mux.HandleFunc("POST /api/login/2fa", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleLoginTwoFactor(w, r)
+	})
+	mux.HandleFunc("POST /api/login/magic", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleRequestMagicLink(w, r)
+	})
+	mux.HandleFunc("GET /api/login/magic/verify", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleMagicLinkLogin(w, r)
+	})
+	mux.HandleFunc("POST /api/login/magic/verify", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleConfirmMagicLinkLogin(w, r)
+	})
+	mux.HandleFunc("GET /api/auth/{provider}/start", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleOIDCStart(w, r)
+	})
+	mux.HandleFunc("GET /api/auth/{provider}/callback", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleOIDCCallback(w, r)
+	})
+	mux.HandleFunc("POST /api/2fa/enroll", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleEnrollTwoFactor(w, r)
+	})
+	mux.HandleFunc("POST /api/2fa/confirm", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleConfirmTwoFactor(w, r)
+	})
+	mux.HandleFunc("POST /api/2fa/recovery-codes", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleRegenerateRecoveryCodes(w, r)
+	})
+	mux.HandleFunc("DELETE /api/2fa", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleDisableTwoFactor(w, r)
+	})
 	mux.HandleFunc("POST /api/refresh", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleTokenRefresh(w, r)
 	})
 	mux.HandleFunc("POST /api/revoke", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleTokenRevoke(w, r)
 	})
-	mux.HandleFunc("GET /admin/metrics", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("POST /api/email/verify", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleVerifyEmail(w, r)
+	})
+	mux.HandleFunc("POST /api/password/forgot", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleForgotPassword(w, r)
+	})
+	mux.HandleFunc("POST /api/password/reset", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleResetPassword(w, r)
+	})
+	mux.HandleFunc("POST /api/tokens", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleCreatePersonalAccessToken(w, r)
+	})
+	mux.HandleFunc("GET /api/tokens", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleListPersonalAccessTokens(w, r)
+	})
+	mux.HandleFunc("DELETE /api/tokens/{id}", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleRevokePersonalAccessToken(w, r)
+	})
+	mux.HandleFunc("GET /api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleListSessions(w, r)
+	})
+	mux.HandleFunc("DELETE /api/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleRevokeSession(w, r)
+	})
+	mux.HandleFunc("POST /api/sessions/revoke-all", func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleRevokeAllSessions(w, r)
+	})
+	mux.Handle("GET /admin/metrics", cfg.MiddlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Type", "text/html")
 		w.Write([]byte(generateAdminMetricsHTML(cfg.GetFileserverHits())))
-	})
-	mux.HandleFunc("POST /admin/reset", func(w http.ResponseWriter, r *http.Request) {
+	})))
+	mux.Handle("POST /admin/reset", cfg.MiddlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if platform != "dev" {
 			w.WriteHeader(http.StatusForbidden)
 			w.Header().Set("Content-Type", "text/plain")
 			w.Write([]byte("Forbidden"))
 			return
 		}
-		cfg.ResetFileserverHits()
-		cfg.DeleteAllUsers(context.Background())
-		w.WriteHeader(http.StatusOK)
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write([]byte("OK"))
-	})
+		cfg.HandleAdminReset(w, r)
+	})))
+	mux.Handle("PUT /admin/users/{id}/role", cfg.MiddlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleUpdateUserRole(w, r)
+	})))
+	mux.Handle("DELETE /admin/users/{id}/lockout", cfg.MiddlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleUnlockUser(w, r)
+	})))
+	mux.Handle("DELETE /admin/chirps/{id}", cfg.MiddlewareRequireRole(auth.RoleModerator, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.HandleModeratorDeleteChirp(w, r)
+	})))
 	mux.HandleFunc("POST /api/polka/webhooks", func(w http.ResponseWriter, r *http.Request) {
 		cfg.HandleUpdateUserSetChirpyRed(w, r)
 	})
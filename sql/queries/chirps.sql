@@ -1,17 +1,30 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id)
 VALUES (
     $1,
     $2,
     $3,
     $4,
-    $5
+    $5,
+    $6
 )
 RETURNING *;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps WHERE id = $1;
 
+-- name: DeleteChirpIfNoReplies :execrows
+DELETE FROM chirps
+WHERE id = $1
+    AND NOT EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.reply_to_id = $1);
+
+-- name: TombstoneChirp :one
+-- earlier revisions go too, so the deleted text can't be read from the history
+WITH revisions AS (
+    DELETE FROM chirp_revisions WHERE chirp_revisions.chirp_id = $1
+)
+UPDATE chirps SET body = '', deleted_at = $2, updated_at = $3 WHERE id = $1 RETURNING chirps.*;
+
 -- name: DeleteAllChirps :exec
 DELETE FROM chirps WHERE 1=1;
 
@@ -25,4 +38,164 @@ SELECT * FROM chirps WHERE id = $1 LIMIT 1;
 SELECT * FROM chirps WHERE user_id = $1;
 
 -- name: UpdateChirp :one
-UPDATE chirps SET body = $2, updated_at = $3 WHERE id = $1 RETURNING *;
\ No newline at end of file
+UPDATE chirps SET body = $2, updated_at = $3 WHERE id = $1 RETURNING *;
+
+-- name: UpdateChirpWithRevision :one
+-- the previous body is saved as a revision in the same statement; the row
+-- lock makes concurrent edits record each body they replaced
+WITH previous AS (
+    SELECT id, body, updated_at FROM chirps
+    WHERE id = sqlc.arg(id) AND deleted_at IS NULL
+    FOR UPDATE
+), revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT sqlc.arg(revision_id), previous.id, previous.body, previous.updated_at, sqlc.arg(updated_at) FROM previous
+)
+UPDATE chirps SET body = sqlc.arg(body), updated_at = sqlc.arg(updated_at)
+FROM previous
+WHERE chirps.id = previous.id
+RETURNING chirps.*;
+
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE (created_at, id) > (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::varchar)
+    AND created_at >= sqlc.arg(since)::timestamp
+    AND created_at < sqlc.arg(until)::timestamp
+    AND deleted_at IS NULL
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE (created_at, id) < (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::varchar)
+    AND created_at >= sqlc.arg(since)::timestamp
+    AND created_at < sqlc.arg(until)::timestamp
+    AND deleted_at IS NULL
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListChirpsByUserIDAsc :many
+-- an author's listing holds their own chirps plus the ones they rechirped,
+-- placed at the time of the rechirp. each branch applies the cursor and limit
+-- itself so that it can read just one page from its (user_id, created_at)
+-- index, and the merged branches are cut to a page again.
+SELECT sqlc.embed(chirps), listings.rechirped_at FROM (
+    (SELECT chirps.id AS chirp_id, chirps.created_at AS listed_at, NULL::timestamp AS rechirped_at FROM chirps
+    WHERE chirps.user_id = sqlc.arg(user_id)
+        AND (chirps.created_at, chirps.id) > (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::varchar)
+        AND chirps.created_at >= sqlc.arg(since)::timestamp
+        AND chirps.created_at < sqlc.arg(until)::timestamp
+        AND chirps.deleted_at IS NULL
+    ORDER BY chirps.created_at ASC, chirps.id ASC
+    LIMIT sqlc.arg(page_size))
+    UNION ALL
+    (SELECT chirp_rechirps.chirp_id, chirp_rechirps.created_at, chirp_rechirps.created_at FROM chirp_rechirps
+    JOIN chirps ON chirps.id = chirp_rechirps.chirp_id
+    WHERE chirp_rechirps.user_id = sqlc.arg(user_id)
+        AND (chirp_rechirps.created_at, chirp_rechirps.chirp_id) > (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::varchar)
+        AND chirp_rechirps.created_at >= sqlc.arg(since)::timestamp
+        AND chirp_rechirps.created_at < sqlc.arg(until)::timestamp
+        AND chirps.deleted_at IS NULL
+    ORDER BY chirp_rechirps.created_at ASC, chirp_rechirps.chirp_id ASC
+    LIMIT sqlc.arg(page_size))
+) AS listings
+JOIN chirps ON chirps.id = listings.chirp_id
+ORDER BY listings.listed_at ASC, listings.chirp_id ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListChirpsByUserIDDesc :many
+-- an author's listing holds their own chirps plus the ones they rechirped,
+-- placed at the time of the rechirp. each branch applies the cursor and limit
+-- itself so that it can read just one page from its (user_id, created_at)
+-- index, and the merged branches are cut to a page again.
+SELECT sqlc.embed(chirps), listings.rechirped_at FROM (
+    (SELECT chirps.id AS chirp_id, chirps.created_at AS listed_at, NULL::timestamp AS rechirped_at FROM chirps
+    WHERE chirps.user_id = sqlc.arg(user_id)
+        AND (chirps.created_at, chirps.id) < (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::varchar)
+        AND chirps.created_at >= sqlc.arg(since)::timestamp
+        AND chirps.created_at < sqlc.arg(until)::timestamp
+        AND chirps.deleted_at IS NULL
+    ORDER BY chirps.created_at DESC, chirps.id DESC
+    LIMIT sqlc.arg(page_size))
+    UNION ALL
+    (SELECT chirp_rechirps.chirp_id, chirp_rechirps.created_at, chirp_rechirps.created_at FROM chirp_rechirps
+    JOIN chirps ON chirps.id = chirp_rechirps.chirp_id
+    WHERE chirp_rechirps.user_id = sqlc.arg(user_id)
+        AND (chirp_rechirps.created_at, chirp_rechirps.chirp_id) < (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::varchar)
+        AND chirp_rechirps.created_at >= sqlc.arg(since)::timestamp
+        AND chirp_rechirps.created_at < sqlc.arg(until)::timestamp
+        AND chirps.deleted_at IS NULL
+    ORDER BY chirp_rechirps.created_at DESC, chirp_rechirps.chirp_id DESC
+    LIMIT sqlc.arg(page_size))
+) AS listings
+JOIN chirps ON chirps.id = listings.chirp_id
+ORDER BY listings.listed_at DESC, listings.chirp_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: SearchChirps :many
+SELECT sqlc.embed(chirps),
+    ts_rank(chirps.search_vector, search_query)::real AS rank,
+    -- the body is HTML escaped first so the snippet is safe to render
+    ts_headline('english', replace(replace(replace(chirps.body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+        search_query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')::text AS snippet
+FROM chirps, websearch_to_tsquery('english', sqlc.arg(query)::text) AS search_query
+WHERE chirps.search_vector @@ search_query
+    AND chirps.deleted_at IS NULL
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size) OFFSET sqlc.arg(page_offset);
+
+-- name: SearchChirpsByUserID :many
+SELECT sqlc.embed(chirps),
+    ts_rank(chirps.search_vector, search_query)::real AS rank,
+    -- the body is HTML escaped first so the snippet is safe to render
+    ts_headline('english', replace(replace(replace(chirps.body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+        search_query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')::text AS snippet
+FROM chirps, websearch_to_tsquery('english', sqlc.arg(query)::text) AS search_query
+WHERE chirps.user_id = sqlc.arg(user_id)
+    AND chirps.search_vector @@ search_query
+    AND chirps.deleted_at IS NULL
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size) OFFSET sqlc.arg(page_offset);
+
+-- name: ListTimelineChirps :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg(follower_id)
+    AND (chirps.created_at, chirps.id) < (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::varchar)
+    AND chirps.deleted_at IS NULL
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: CountRepliesByChirpIDs :many
+SELECT reply_to_id::varchar AS chirp_id, COUNT(*) AS reply_count FROM chirps
+WHERE reply_to_id = ANY(sqlc.arg(chirp_ids)::varchar[])
+    AND deleted_at IS NULL
+GROUP BY reply_to_id;
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors (id, depth) AS (
+    SELECT chirps.reply_to_id, 1 FROM chirps
+    WHERE chirps.id = sqlc.arg(id) AND chirps.reply_to_id IS NOT NULL
+    UNION ALL
+    SELECT chirps.reply_to_id, ancestors.depth + 1 FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.id
+    WHERE chirps.reply_to_id IS NOT NULL AND ancestors.depth < 1000
+)
+SELECT chirps.* FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC;
+
+-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants (id, depth) AS (
+    SELECT chirps.id, 1 FROM chirps
+    WHERE chirps.reply_to_id = sqlc.arg(id)
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1 FROM chirps
+    JOIN descendants ON chirps.reply_to_id = descendants.id
+    WHERE descendants.depth < 1000
+)
+SELECT sqlc.embed(chirps), descendants.depth::int AS depth FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+WHERE (chirps.created_at, chirps.id) > (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::varchar)
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg(page_size);
\ No newline at end of file
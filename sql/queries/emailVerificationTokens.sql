@@ -0,0 +1,18 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (token_hash, user_id, email, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: ConsumeEmailVerificationToken :one
+UPDATE email_verification_tokens SET used_at = $2
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+RETURNING *;
+
+-- name: DeleteEmailVerificationTokensByUserID :exec
+DELETE FROM email_verification_tokens WHERE user_id = $1;
@@ -0,0 +1,25 @@
+-- name: CreateFollow :execrows
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: DeleteFollow :execrows
+DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: ListFollowers :many
+SELECT * FROM follows
+WHERE followee_id = sqlc.arg(user_id)
+    AND (created_at, follower_id) < (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::varchar)
+ORDER BY created_at DESC, follower_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListFollowing :many
+SELECT * FROM follows
+WHERE follower_id = sqlc.arg(user_id)
+    AND (created_at, followee_id) < (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::varchar)
+ORDER BY created_at DESC, followee_id DESC
+LIMIT sqlc.arg(page_size);
\ No newline at end of file
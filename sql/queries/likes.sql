@@ -0,0 +1,21 @@
+-- name: CreateLike :execrows
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: DeleteLike :execrows
+DELETE FROM chirp_likes WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: CountLikesByChirpIDs :many
+SELECT chirp_id, COUNT(*) AS like_count FROM chirp_likes
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::varchar[])
+GROUP BY chirp_id;
+
+-- name: ListLikedChirpIDs :many
+SELECT chirp_id FROM chirp_likes
+WHERE user_id = sqlc.arg(user_id)
+    AND chirp_id = ANY(sqlc.arg(chirp_ids)::varchar[]);
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- name: GetLoginAttempt :one
+SELECT * FROM login_attempts WHERE key = $1;
+
+-- name: RecordLoginFailure :one
+-- counts a failure in one statement so concurrent attempts from several
+-- instances can't lose one. a count older than window_start starts over
+INSERT INTO login_attempts (key, failures, last_failure_at)
+VALUES (sqlc.arg(key), 1, sqlc.arg(now))
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_attempts.last_failure_at < sqlc.arg(window_start) THEN 1
+        ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = sqlc.arg(now)
+RETURNING *;
+
+-- name: DeleteLoginAttempt :exec
+DELETE FROM login_attempts WHERE key = $1;
@@ -0,0 +1,20 @@
+-- name: CreateMagicLinkToken :one
+INSERT INTO magic_link_tokens (token_hash, user_id, email, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: ConsumeMagicLinkToken :one
+-- marks an unused, unexpired link as used in one statement so that it logs
+-- in once, however many times it is opened
+UPDATE magic_link_tokens SET used_at = $2
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+RETURNING *;
+
+-- name: DeleteMagicLinkTokensByUserID :exec
+DELETE FROM magic_link_tokens WHERE user_id = $1;
@@ -0,0 +1,19 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: ConsumePasswordResetToken :one
+-- marks an unused, unexpired token as used in one statement so that two
+-- concurrent resets can't both succeed with the same token
+UPDATE password_reset_tokens SET used_at = $2
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+RETURNING *;
+
+-- name: DeletePasswordResetTokensByUserID :exec
+DELETE FROM password_reset_tokens WHERE user_id = $1;
@@ -0,0 +1,26 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+RETURNING *;
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT * FROM personal_access_tokens WHERE token_hash = $1;
+
+-- name: ListPersonalAccessTokensByUserID :many
+SELECT * FROM personal_access_tokens WHERE user_id = $1
+ORDER BY created_at DESC, id DESC;
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens SET last_used_at = $2 WHERE id = $1;
+
+-- name: DeletePersonalAccessToken :execrows
+-- scoped to the owner, so one user can't revoke another's tokens by id
+DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2;
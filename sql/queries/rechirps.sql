@@ -0,0 +1,16 @@
+-- name: CreateRechirp :execrows
+INSERT INTO chirp_rechirps (user_id, chirp_id, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirp_rechirps WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: CountRechirpsByChirpIDs :many
+SELECT chirp_id, COUNT(*) AS rechirp_count FROM chirp_rechirps
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::varchar[])
+GROUP BY chirp_id;
\ No newline at end of file
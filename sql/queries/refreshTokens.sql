@@ -1,28 +1,74 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (id, token_hash, created_at, updated_at, user_id, expires_at, family_id, family_created_at, user_agent, ip_address)
 VALUES (
     $1,
     $2,
     $3,
     $4,
-    $5
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
 )
 RETURNING *;
 
--- name: DeleteExpiredRefreshTokens :exec
-DELETE FROM refresh_tokens WHERE expires_at < $1 AND revoked_at IS NULL;
+-- name: DeleteExpiredRefreshTokens :execrows
+-- revoked tokens go too once they have expired; they are only kept to catch
+-- reuse, and an expired token is refused before that is checked
+DELETE FROM refresh_tokens WHERE expires_at < $1;
 
 -- name: DeleteRefreshToken :exec
-DELETE FROM refresh_tokens WHERE token = $1;
+DELETE FROM refresh_tokens WHERE id = $1;
 
 -- name: DeleteAllRefreshTokens :exec
 DELETE FROM refresh_tokens WHERE 1=1;
 
--- name: GetRefreshTokenByToken :one
-SELECT * FROM refresh_tokens WHERE token = $1 LIMIT 1;
+-- name: GetRefreshTokenByHash :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1 LIMIT 1;
 
 -- name: GetRefreshTokenByUserID :many
 SELECT * FROM refresh_tokens WHERE user_id = $1;
 
 -- name: RevokeRefreshToken :one
-UPDATE refresh_tokens SET revoked_at = $2, updated_at = $3 WHERE token = $1 RETURNING *;
\ No newline at end of file
+UPDATE refresh_tokens SET revoked_at = $2, updated_at = $3 WHERE id = $1 RETURNING *;
+
+-- name: RotateRefreshToken :one
+-- revokes the presented token and issues its successor in the same family.
+-- nothing is returned if the token was already revoked, so only one of two
+-- concurrent refreshes with the same token can succeed
+WITH rotated AS (
+    UPDATE refresh_tokens
+    SET revoked_at = sqlc.arg(now), updated_at = sqlc.arg(now), replaced_by = sqlc.arg(new_id)
+    WHERE refresh_tokens.id = sqlc.arg(id) AND revoked_at IS NULL
+    RETURNING user_id, family_id, family_created_at, user_agent, ip_address
+)
+INSERT INTO refresh_tokens (id, token_hash, created_at, updated_at, user_id, expires_at, family_id, family_created_at, user_agent, ip_address)
+SELECT sqlc.arg(new_id), sqlc.arg(new_token_hash), sqlc.arg(now), sqlc.arg(now), rotated.user_id, sqlc.arg(expires_at), rotated.family_id,
+    rotated.family_created_at, rotated.user_agent, rotated.ip_address
+FROM rotated
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens SET revoked_at = $2, updated_at = $2
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: ListActiveRefreshTokensByUserID :many
+-- returns the live token of each of the user's sessions. sessions that
+-- started before family_created_after are past their maximum lifetime, and
+-- ones whose live token was issued before created_after have been idle too
+-- long
+SELECT * FROM refresh_tokens
+WHERE user_id = sqlc.arg(user_id) AND revoked_at IS NULL AND expires_at > sqlc.arg(now)
+    AND family_created_at > sqlc.arg(family_created_after)
+    AND created_at > sqlc.arg(created_after)
+ORDER BY created_at DESC, id DESC;
+
+-- name: RevokeRefreshTokenFamilyByUserID :execrows
+UPDATE refresh_tokens SET revoked_at = $3, updated_at = $3
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokensByUserID :execrows
+UPDATE refresh_tokens SET revoked_at = $2, updated_at = $2
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -0,0 +1,13 @@
+-- name: CreateSecurityEvent :one
+INSERT INTO security_events (id, user_id, event_type, details, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: ListSecurityEventsByUserID :many
+SELECT * FROM security_events WHERE user_id = $1 ORDER BY created_at DESC, id DESC;
@@ -0,0 +1,71 @@
+-- name: UpsertUserTOTP :one
+-- starts or restarts enrollment with a new secret. nothing is returned when
+-- two-factor is already enabled, so a stolen access token can't replace it
+INSERT INTO user_totp (user_id, secret, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at, last_used_step = 0
+WHERE user_totp.enabled_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp WHERE user_id = $1;
+
+-- name: EnableUserTOTP :one
+UPDATE user_totp SET enabled_at = $2, last_used_step = $3
+WHERE user_id = $1 AND enabled_at IS NULL
+RETURNING *;
+
+-- name: UpdateUserTOTPLastUsedStep :execrows
+-- accepts a time step only if it is later than the last one used, so each
+-- code works once even when two logins race
+UPDATE user_totp SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :one
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: ListUnusedRecoveryCodesByUserID :many
+SELECT * FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL ORDER BY created_at, id;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = $2 WHERE id = $1 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodesByUserID :exec
+DELETE FROM recovery_codes WHERE user_id = $1;
+
+-- name: CreateTwoFactorChallenge :one
+INSERT INTO two_factor_challenges (token_hash, user_id, expires_in_seconds, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: RecordTwoFactorChallengeAttempt :one
+-- counts a guess against a live challenge. nothing is returned once the
+-- challenge is used, expired or out of attempts
+UPDATE two_factor_challenges SET attempts = attempts + 1
+WHERE token_hash = sqlc.arg(token_hash) AND used_at IS NULL
+    AND expires_at > sqlc.arg(now) AND attempts < sqlc.arg(max_attempts)
+RETURNING *;
+
+-- name: ConsumeTwoFactorChallenge :execrows
+UPDATE two_factor_challenges SET used_at = $2 WHERE token_hash = $1 AND used_at IS NULL;
@@ -15,6 +15,9 @@ DELETE FROM users WHERE id = $1;
 -- name: DeleteAllUsers :exec
 DELETE FROM users WHERE 1=1;
 
+-- name: DeleteUsersExcept :exec
+DELETE FROM users WHERE id <> $1;
+
 -- name: GetUsersByEmail :many
 SELECT * FROM users WHERE email = $1;
 
@@ -24,6 +27,14 @@ SELECT * FROM users WHERE id = $1 LIMIT 1;
 -- name: UpdateUserPasswordByID :one
 UPDATE users SET hashed_password = $2, updated_at = $3 WHERE id = $1 RETURNING *;
 
+-- name: UpgradeUserPasswordHash :execrows
+-- swaps in a rehash of the same password only if the hash it was made from
+-- is still the current one, so a password changed in the meantime isn't
+-- overwritten with the old one. updated_at is left alone; the user hasn't
+-- changed anything.
+UPDATE users SET hashed_password = sqlc.arg(new_hashed_password)
+WHERE id = sqlc.arg(id) AND hashed_password = sqlc.arg(old_hashed_password);
+
 -- name: UpdateUser :one
 UPDATE users SET email = $2, hashed_password = $3, updated_at = $4 WHERE id = $1 RETURNING *;
 
@@ -31,10 +42,18 @@ UPDATE users SET email = $2, hashed_password = $3, updated_at = $4 WHERE id = $1
 UPDATE users SET email = $2, updated_at = $3 WHERE id = $1 RETURNING *;
 
 -- name: UpdateUserPasswordByEmail :one
-UPDATE users SET hashed_password = $2 WHERE email = $1 RETURNING *;
+UPDATE users SET hashed_password = $2, updated_at = $3 WHERE email = $1 RETURNING *;
 
 -- name: UpdateUserSetChirpyRed :one
 UPDATE users SET is_chirpy_red = TRUE, updated_at = $2 WHERE id = $1 RETURNING *;
 
 -- name: UpdateUserUnsetChirpyRed :one
-UPDATE users SET is_chirpy_red = FALSE, updated_at = $2 WHERE id = $1 RETURNING *;
\ No newline at end of file
+UPDATE users SET is_chirpy_red = FALSE, updated_at = $2 WHERE id = $1 RETURNING *;
+
+-- name: UpdateUserRole :one
+UPDATE users SET role = $2, updated_at = $3 WHERE id = $1 RETURNING *;
+
+-- name: SetUserVerifiedEmail :one
+-- sets the email and marks it verified in one step, for both confirming the
+-- current address and switching to a new one
+UPDATE users SET email = $2, email_verified_at = $3, updated_at = $3 WHERE id = $1 RETURNING *;
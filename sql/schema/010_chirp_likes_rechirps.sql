@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE chirp_likes (
+    user_id VARCHAR(50) NOT NULL,
+    chirp_id VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id),
+    CONSTRAINT chirp_likes_user_id_foreign FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chirp_likes_chirp_id_foreign FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+CREATE INDEX chirp_likes_chirp_id_idx ON chirp_likes (chirp_id);
+
+CREATE TABLE chirp_rechirps (
+    user_id VARCHAR(50) NOT NULL,
+    chirp_id VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, chirp_id),
+    CONSTRAINT chirp_rechirps_user_id_foreign FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chirp_rechirps_chirp_id_foreign FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+CREATE INDEX chirp_rechirps_chirp_id_idx ON chirp_rechirps (chirp_id);
+CREATE INDEX chirp_rechirps_user_id_created_at_idx ON chirp_rechirps (user_id, created_at);
+
+-- +goose Down
+DROP TABLE chirp_rechirps;
+DROP TABLE chirp_likes;
@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE refresh_tokens ADD COLUMN family_id VARCHAR(50);
+ALTER TABLE refresh_tokens ADD COLUMN replaced_by VARCHAR(255) NULL;
+-- tokens issued before rotation each start their own family. the family id
+-- is handed out as the session id, so it must not be the token itself.
+UPDATE refresh_tokens SET family_id = gen_random_uuid()::text;
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+CREATE TABLE security_events (
+    id VARCHAR(50) PRIMARY KEY,
+    user_id VARCHAR(50) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    details TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT security_events_user_id_foreign FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX security_events_user_id_created_at_idx ON security_events (user_id, created_at);
+
+-- +goose Down
+DROP TABLE security_events;
+DROP INDEX refresh_tokens_family_id_idx;
+ALTER TABLE refresh_tokens DROP COLUMN replaced_by;
+ALTER TABLE refresh_tokens DROP COLUMN family_id;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- a session is a refresh token family; these are copied to every token in it
+ALTER TABLE refresh_tokens ADD COLUMN family_created_at TIMESTAMP;
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip_address VARCHAR(64) NOT NULL DEFAULT '';
+UPDATE refresh_tokens SET family_created_at = created_at;
+ALTER TABLE refresh_tokens ALTER COLUMN family_created_at SET NOT NULL;
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_id_idx;
+ALTER TABLE refresh_tokens DROP COLUMN ip_address;
+ALTER TABLE refresh_tokens DROP COLUMN user_agent;
+ALTER TABLE refresh_tokens DROP COLUMN family_created_at;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- existing users start unverified and can confirm by requesting a new link
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP NULL;
+
+CREATE TABLE email_verification_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(50) NOT NULL,
+    -- the address being verified, which is not the user's email yet when
+    -- they are changing it
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    CONSTRAINT email_verification_tokens_user_id_foreign FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens (user_id);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+ALTER TABLE users DROP COLUMN email_verified_at;
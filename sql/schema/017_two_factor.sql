@@ -0,0 +1,42 @@
+-- +goose Up
+-- the secret is kept in the clear because every code is checked against it.
+-- enabled_at stays null until the user confirms a code from their app.
+CREATE TABLE user_totp (
+    user_id VARCHAR(50) PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    enabled_at TIMESTAMP NULL,
+    -- the time step of the last accepted code, so a code can't be used twice
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    CONSTRAINT user_totp_user_id_foreign FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE recovery_codes (
+    id VARCHAR(50) PRIMARY KEY,
+    user_id VARCHAR(50) NOT NULL,
+    code_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    CONSTRAINT recovery_codes_user_id_foreign FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+-- issued when a password is accepted for a user with two-factor enabled, and
+-- exchanged for tokens once a code is verified
+CREATE TABLE two_factor_challenges (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(50) NOT NULL,
+    -- the access token lifetime asked for at login
+    expires_in_seconds INTEGER NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    CONSTRAINT two_factor_challenges_user_id_foreign FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX two_factor_challenges_user_id_idx ON two_factor_challenges (user_id);
+
+-- +goose Down
+DROP TABLE two_factor_challenges;
+DROP TABLE recovery_codes;
+DROP TABLE user_totp;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- failed login attempts per account or client ip, shared by every instance.
+-- key is "account:<email>" or "ip:<address>"
+CREATE TABLE login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE login_attempts;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- long lived tokens for scripts and bots. only the digest of the token is
+-- kept; the token itself is shown once when it is created.
+CREATE TABLE personal_access_tokens (
+    id VARCHAR(50) PRIMARY KEY,
+    user_id VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    -- space separated, e.g. "chirps:read chirps:write"
+    scopes TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    -- null for tokens that don't expire
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    CONSTRAINT personal_access_tokens_token_hash_unique UNIQUE (token_hash),
+    CONSTRAINT personal_access_tokens_user_id_foreign FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX personal_access_tokens_user_id_idx ON personal_access_tokens (user_id);
+
+-- +goose Down
+DROP TABLE personal_access_tokens;
@@ -0,0 +1,38 @@
+-- +goose Up
+-- refresh tokens were stored as the raw secret, so anyone who could read the
+-- table could log in as its users. rows now get an opaque id and keep only
+-- the SHA-256 digest of the token. existing tokens are re-hashed rather than
+-- thrown away, so nobody is logged out by the upgrade.
+ALTER TABLE refresh_tokens ADD COLUMN id VARCHAR(50);
+ALTER TABLE refresh_tokens ADD COLUMN token_hash VARCHAR(64);
+UPDATE refresh_tokens SET id = gen_random_uuid()::text, token_hash = encode(sha256(token::bytea), 'hex');
+-- replaced_by pointed at the successor's raw token; point it at its id
+UPDATE refresh_tokens r SET replaced_by = n.id
+FROM refresh_tokens n WHERE r.replaced_by = n.token;
+UPDATE refresh_tokens SET replaced_by = NULL
+WHERE replaced_by IS NOT NULL AND replaced_by NOT IN (SELECT id FROM refresh_tokens);
+-- databases migrated by an earlier 012 named families from before rotation
+-- after their first token, which the sessions api hands out as the session
+-- id. give them fresh ids.
+UPDATE refresh_tokens r SET family_id = f.new_id
+FROM (
+    SELECT family_id, gen_random_uuid()::text AS new_id
+    FROM refresh_tokens WHERE length(family_id) <> 36 GROUP BY family_id
+) f
+WHERE r.family_id = f.family_id;
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_pkey;
+ALTER TABLE refresh_tokens DROP COLUMN token;
+ALTER TABLE refresh_tokens ALTER COLUMN id SET NOT NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN token_hash SET NOT NULL;
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_pkey PRIMARY KEY (id);
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_token_hash_unique UNIQUE (token_hash);
+
+-- +goose Down
+-- the raw tokens can't be recovered from their digests, so every session
+-- has to log in again
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_token_hash_unique;
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_pkey;
+ALTER TABLE refresh_tokens DROP COLUMN token_hash;
+ALTER TABLE refresh_tokens DROP COLUMN id;
+ALTER TABLE refresh_tokens ADD COLUMN token VARCHAR(255) PRIMARY KEY NOT NULL;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- accounts at OpenID Connect providers that users log in with. subject is
+-- the provider's id for the user, which unlike the email never changes.
+CREATE TABLE user_identities (
+    id VARCHAR(50) PRIMARY KEY,
+    user_id VARCHAR(50) NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    -- the email the provider gave when the identity was last used
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_login_at TIMESTAMP NOT NULL,
+    CONSTRAINT user_identities_provider_subject_unique UNIQUE (provider, subject),
+    CONSTRAINT user_identities_user_id_foreign FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+-- +goose Down
+DROP TABLE user_identities;
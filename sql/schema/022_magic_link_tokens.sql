@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE magic_link_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(50) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    CONSTRAINT magic_link_tokens_user_id_foreign FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX magic_link_tokens_user_id_idx ON magic_link_tokens (user_id);
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- rechirping your own chirp listed it twice under you, and is now refused
+DELETE FROM chirp_rechirps
+USING chirps
+WHERE chirps.id = chirp_rechirps.chirp_id AND chirps.user_id = chirp_rechirps.user_id;
+
+-- +goose Down
+-- the deleted rechirps can't be restored